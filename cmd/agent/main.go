@@ -10,20 +10,27 @@ import (
 	"os/exec"
 	"os/signal"
 	"path/filepath"
+	"runtime"
 	"strconv"
 	"strings"
 	"syscall"
 	"time"
 
-	"gohub/internal/api"
+	"github.com/vovakirdan/gohub/internal/api"
+	"github.com/vovakirdan/gohub/internal/diagnostics"
+	"github.com/vovakirdan/gohub/internal/labels"
+	"github.com/vovakirdan/gohub/internal/transport"
 
 	"github.com/shirou/gopsutil/v3/cpu"
 	"github.com/shirou/gopsutil/v3/disk"
+	"github.com/shirou/gopsutil/v3/host"
+	"github.com/shirou/gopsutil/v3/load"
 	"github.com/shirou/gopsutil/v3/mem"
 	"github.com/shirou/gopsutil/v3/net"
 
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/protobuf/types/known/timestamppb"
 )
 
 var (
@@ -31,6 +38,24 @@ var (
 	TAG_FILE              = "/tmp/my_agent.tag"
 	DEFAULT_SEND_INTERVAL = 5 * time.Second
 	SEND_INTERVAL         time.Duration
+
+	DEFAULT_GRPC_ADDR       = "localhost:50051"
+	DEFAULT_HTTP_INGEST_URL = "http://localhost:8080/api/ingest"
+	GRPC_RETRY_INTERVAL     = 5 * time.Minute
+
+	// Интервал heartbeat (независим от отправки метрик)
+	DEFAULT_HEARTBEAT_INTERVAL = 10 * time.Second
+
+	// Ограничения диагностических команд
+	DEFAULT_DIAG_TIMEOUT    = 30 * time.Second
+	DEFAULT_DIAG_MAX_OUTPUT = 64 * 1024
+
+	// Верхняя граница интервала при slow_down от сервера
+	MAX_SEND_INTERVAL = 5 * time.Minute
+	// Нижняя граница интервала, заданного сервером
+	MIN_SEND_INTERVAL = time.Second
+	// Версия агента (задаётся при сборке: -ldflags "-X main.AGENT_VERSION=...")
+	AGENT_VERSION = "dev"
 )
 
 func main() {
@@ -83,34 +108,234 @@ func main() {
 		}
 	}
 
+	// Лейблы агента: флаг --labels или переменная AGENT_LABELS ("env=prod,role=db")
+	agentLabels, err := labels.Parse(getEnvOrDefault("AGENT_LABELS", flags["labels"].(string)))
+	if err != nil {
+		log.Fatalf("Invalid labels: %v", err)
+	}
+
 	// Подключаемся к gRPC-серверу
-	conn, err := grpc.NewClient("localhost:50051", grpc.WithTransportCredentials(insecure.NewCredentials()))
+	conn, err := grpc.NewClient(getEnvOrDefault("GRPC_ADDR", DEFAULT_GRPC_ADDR), grpc.WithTransportCredentials(insecure.NewCredentials()))
 	if err != nil {
 		log.Fatalf("Failed to connect to gRPC server: %v", err)
 	}
 	defer conn.Close()
 
-	client := api.NewMetricsServiceClient(conn)
+	// Если gRPC недоступен (например, HTTP/2 режется прокси), шлём по HTTP на /api/ingest
+	grpcClient := api.NewMetricsServiceClient(conn)
+	client := transport.NewFallbackClient(
+		grpcClient,
+		transport.NewHTTPClient(getEnvOrDefault("HTTP_INGEST_URL", DEFAULT_HTTP_INGEST_URL)),
+		GRPC_RETRY_INTERVAL,
+	)
 	ticker := time.NewTicker(SEND_INTERVAL)
 	defer ticker.Stop()
 
-	log.Printf("Agent started with tag=%s, interval=%s", tag, SEND_INTERVAL)
+	log.Printf("Agent started with tag=%s, labels={%s}, interval=%s", tag, agentLabels, SEND_INTERVAL)
 
 	// Graceful shutdown
 	ctx, cancel := context.WithCancel(context.Background())
 	go listenForSignals(cancel)
 
+	// Heartbeat шлём по своему расписанию: агент считается живым, даже если сбор метрик сломан
+	go runHeartbeat(ctx, client, tag, getHeartbeatInterval())
+
+	// Диагностика включается явно: DIAGNOSTICS=1 (встроенный allowlist) или DIAG_ALLOWLIST=<файл>
+	if runner := newDiagnosticsRunner(); runner != nil {
+		go runDiagnostics(ctx, grpcClient, tag, runner)
+	}
+
+	// Инвентарь отправляем с первым запросом и по просьбе сервера
+	sendInventory := true
+	interval := SEND_INTERVAL
+
 	for {
 		select {
 		case <-ctx.Done():
 			log.Println("Agent shutting down...")
 			return
 		case <-ticker.C:
-			sendSystemMetrics(client, tag)
+			resp := sendSystemMetrics(client, tag, agentLabels, sendInventory)
+			if resp == nil {
+				continue
+			}
+			sendInventory = resp.ResendInventory
+
+			// Подстраиваем интервал по указаниям сервера
+			if next := nextSendInterval(interval, resp); next != interval {
+				log.Printf("Send interval changed by server: %s -> %s (slow_down=%t)", interval, next, resp.SlowDown)
+				interval = next
+				ticker.Reset(interval)
+			}
 		}
 	}
 }
 
+// runHeartbeat периодически отправляет heartbeat до отмены ctx
+func runHeartbeat(ctx context.Context, client transport.AgentClient, tag string, interval time.Duration) {
+	started := time.Now()
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = "unknown-host"
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		hbCtx, cancel := context.WithTimeout(ctx, 3*time.Second)
+		_, err := client.Heartbeat(hbCtx, &api.HeartbeatRequest{
+			ServerId:      hostname,
+			Tag:           tag,
+			IntervalMs:    interval.Milliseconds(),
+			UptimeSeconds: int64(time.Since(started).Seconds()),
+			AgentVersion:  AGENT_VERSION,
+			SentAt:        timestamppb.Now(),
+		})
+		cancel()
+		if err != nil && ctx.Err() == nil {
+			log.Printf("Heartbeat error: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// newDiagnosticsRunner создаёт исполнитель диагностических команд или nil, если диагностика выключена
+func newDiagnosticsRunner() *diagnostics.Runner {
+	var allowlist *diagnostics.Allowlist
+	if path := os.Getenv("DIAG_ALLOWLIST"); path != "" {
+		var err error
+		if allowlist, err = diagnostics.LoadAllowlist(path); err != nil {
+			log.Fatalf("Failed to load diagnostics allowlist: %v", err)
+		}
+	} else if os.Getenv("DIAGNOSTICS") == "1" {
+		allowlist = diagnostics.NewAllowlist(diagnostics.DefaultAllowlist)
+	} else {
+		return nil
+	}
+
+	timeout := DEFAULT_DIAG_TIMEOUT
+	if ms, err := strconv.Atoi(os.Getenv("DIAG_TIMEOUT")); err == nil && ms > 0 {
+		timeout = time.Duration(ms) * time.Millisecond
+	}
+	maxOutput := DEFAULT_DIAG_MAX_OUTPUT
+	if n, err := strconv.Atoi(os.Getenv("DIAG_MAX_OUTPUT")); err == nil && n > 0 {
+		maxOutput = n
+	}
+	return &diagnostics.Runner{
+		Allowlist: allowlist,
+		Timeout:   timeout,
+		MaxOutput: maxOutput,
+		ChunkSize: 4096,
+	}
+}
+
+// runDiagnostics держит подписку на запросы диагностики и переподключается при обрыве
+func runDiagnostics(ctx context.Context, client api.MetricsServiceClient, tag string, runner *diagnostics.Runner) {
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = "unknown-host"
+	}
+
+	backoff := 5 * time.Second
+	for ctx.Err() == nil {
+		stream, err := client.WatchDiagnostics(ctx, &api.WatchDiagnosticsRequest{ServerId: hostname, Tag: tag})
+		if err == nil {
+			log.Println("Subscribed to diagnostics requests")
+			for {
+				var dr *api.DiagnosticRequest
+				if dr, err = stream.Recv(); err != nil {
+					break
+				}
+				backoff = 5 * time.Second
+				runDiagnostic(ctx, client, runner, hostname, tag, dr)
+			}
+		}
+		if ctx.Err() != nil {
+			return
+		}
+		log.Printf("Diagnostics stream error: %v (reconnect in %s)", err, backoff)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+		if backoff < time.Minute {
+			backoff *= 2
+		}
+	}
+}
+
+// runDiagnostic выполняет одну команду и передаёт её вывод на сервер
+func runDiagnostic(ctx context.Context, client api.MetricsServiceClient, runner *diagnostics.Runner, serverID, tag string, dr *api.DiagnosticRequest) {
+	log.Printf("Diagnostic request id=%d: %q", dr.Id, dr.Command)
+
+	reportCtx, cancel := context.WithTimeout(ctx, runner.Timeout+30*time.Second)
+	defer cancel()
+	report, err := client.ReportDiagnostic(reportCtx)
+	if err != nil {
+		log.Printf("Failed to open diagnostic report stream: %v", err)
+		return
+	}
+
+	res := runner.Run(ctx, dr.Command, func(chunk []byte) error {
+		return report.Send(&api.DiagnosticOutput{Id: dr.Id, ServerId: serverID, Tag: tag, Data: chunk})
+	})
+
+	final := &api.DiagnosticOutput{
+		Id:        dr.Id,
+		ServerId:  serverID,
+		Tag:       tag,
+		Done:      true,
+		ExitCode:  int32(res.ExitCode),
+		Truncated: res.Truncated,
+		Rejected:  res.Err == diagnostics.ErrNotAllowed,
+		TimedOut:  res.TimedOut,
+	}
+	if res.Err != nil {
+		final.Error = res.Err.Error()
+		log.Printf("Diagnostic id=%d: %v", dr.Id, res.Err)
+	}
+	if err := report.Send(final); err != nil {
+		log.Printf("Failed to send diagnostic result: %v", err)
+		return
+	}
+	if _, err := report.CloseAndRecv(); err != nil {
+		log.Printf("Failed to close diagnostic report stream: %v", err)
+	}
+}
+
+// nextSendInterval вычисляет интервал отправки по указаниям сервера.
+// При slow_down интервал удваивается (до MAX_SEND_INTERVAL), после — постепенно возвращается к базовому.
+// Интервал от сервера не короче MIN_SEND_INTERVAL.
+func nextSendInterval(current time.Duration, resp *api.MetricsResponse) time.Duration {
+	base := SEND_INTERVAL
+	if resp.SendIntervalMs > 0 {
+		base = max(time.Duration(resp.SendIntervalMs)*time.Millisecond, MIN_SEND_INTERVAL)
+	}
+	if resp.SlowDown {
+		next := current * 2
+		if next < base {
+			next = base
+		}
+		if next > MAX_SEND_INTERVAL {
+			next = MAX_SEND_INTERVAL
+		}
+		return next
+	}
+	if current > base {
+		if next := current / 2; next > base {
+			return next
+		}
+	}
+	return base
+}
+
 func generateRandomTag() string {
 	adjectives := []string{
 		"shiny", "silent", "brave", "loyal", "fuzzy",
@@ -148,6 +373,7 @@ func parseFlags(args []string) map[string]interface{} {
 		stop                        bool
 		intervalShort, intervalLong int
 		tagShort, tagLong           string
+		labelsShort, labelsLong     string
 		resetTag                    bool
 	)
 
@@ -159,6 +385,8 @@ func parseFlags(args []string) map[string]interface{} {
 	fs.IntVar(&intervalLong, "interval", 5000, "Set send interval (ms)")
 	fs.StringVar(&tagShort, "t", "default_tag", "Set agent tag")
 	fs.StringVar(&tagLong, "tag", "default_tag", "Set agent tag")
+	fs.StringVar(&labelsShort, "l", "", "Set agent labels (key=value,...)")
+	fs.StringVar(&labelsLong, "labels", "", "Set agent labels (key=value,...)")
 	fs.BoolVar(&resetTag, "reset-tag", false, "Reset saved agent tag")
 	fs.Parse(args)
 
@@ -173,6 +401,11 @@ func parseFlags(args []string) map[string]interface{} {
 		lastTag = tagLong
 	}
 
+	lastLabels := labelsShort
+	if strings.LastIndex(lastArgs, "--labels") > strings.LastIndex(lastArgs, "-l") {
+		lastLabels = labelsLong
+	}
+
 	lastDetach := detachShort || detachLong
 	if strings.LastIndex(lastArgs, "--detach") > strings.LastIndex(lastArgs, "-d") {
 		lastDetach = detachLong
@@ -183,6 +416,7 @@ func parseFlags(args []string) map[string]interface{} {
 		"stop":     stop,
 		"interval": lastInterval,
 		"tag":      lastTag,
+		"labels":   lastLabels,
 		"resetTag": resetTag,
 	}
 }
@@ -196,6 +430,15 @@ func getSendInterval(flags map[string]interface{}) time.Duration {
 	return time.Duration(flags["interval"].(int)) * time.Millisecond
 }
 
+func getHeartbeatInterval() time.Duration {
+	if env := os.Getenv("HEARTBEAT_INTERVAL"); env != "" {
+		if ms, err := strconv.Atoi(env); err == nil && ms > 0 {
+			return time.Duration(ms) * time.Millisecond
+		}
+	}
+	return DEFAULT_HEARTBEAT_INTERVAL
+}
+
 func getEnvOrDefault(key, fallback string) string {
 	if val := os.Getenv(key); val != "" {
 		return val
@@ -285,30 +528,72 @@ func isHelpRequested() bool {
 	return false
 }
 
-// sendSystemMetrics собирает метрики и отправляет на сервер
-func sendSystemMetrics(client api.MetricsServiceClient, tag string) {
+// collectInventory собирает сведения о хосте
+func collectInventory(hostname string, diskTotal uint64, memTotal uint64) *api.Inventory {
+	inv := &api.Inventory{
+		Hostname:     hostname,
+		Os:           runtime.GOOS,
+		Arch:         runtime.GOARCH,
+		CpuCores:     int32(runtime.NumCPU()),
+		MemoryTotal:  memTotal,
+		DiskTotal:    diskTotal,
+		AgentVersion: AGENT_VERSION,
+	}
+	if info, err := host.Info(); err == nil {
+		inv.Platform = info.Platform
+		inv.PlatformVersion = info.PlatformVersion
+		inv.KernelVersion = info.KernelVersion
+	} else {
+		log.Printf("Could not read host info: %v", err)
+	}
+	return inv
+}
+
+// collectSamples собирает дополнительные измерения, не входящие в фиксированные поля
+func collectSamples(now *timestamppb.Timestamp, memStat *mem.VirtualMemoryStat, bytesSent, bytesRecv uint64) []*api.Sample {
+	samples := []*api.Sample{
+		{Name: "memory_available", Value: float64(memStat.Available), Unit: "bytes", Type: api.SampleType_GAUGE, Timestamp: now},
+		{Name: "net_bytes_sent", Value: float64(bytesSent), Unit: "bytes", Type: api.SampleType_COUNTER, Timestamp: now},
+		{Name: "net_bytes_recv", Value: float64(bytesRecv), Unit: "bytes", Type: api.SampleType_COUNTER, Timestamp: now},
+	}
+
+	// Средняя загрузка есть не на всех платформах
+	if avg, err := load.Avg(); err == nil {
+		samples = append(samples,
+			&api.Sample{Name: "load1", Value: avg.Load1, Type: api.SampleType_GAUGE, Timestamp: now},
+			&api.Sample{Name: "load5", Value: avg.Load5, Type: api.SampleType_GAUGE, Timestamp: now},
+			&api.Sample{Name: "load15", Value: avg.Load15, Type: api.SampleType_GAUGE, Timestamp: now},
+		)
+	}
+	return samples
+}
+
+// sendSystemMetrics собирает метрики и отправляет на сервер; возвращает ответ сервера или nil при ошибке
+func sendSystemMetrics(client transport.AgentClient, tag string, agentLabels labels.Labels, withInventory bool) *api.MetricsResponse {
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
+	collectedAt := timestamppb.Now()
+
 	// 1) CPU usage (средний процент использования с момента последнего вызова)
 	cpuPercent, err := cpu.Percent(0, false)
 	if err != nil || len(cpuPercent) == 0 {
 		log.Printf("Could not read CPU usage: %v", err)
-		return
+		return nil
 	}
 
 	// 2) Memory usage
 	memStat, err := mem.VirtualMemory()
 	if err != nil {
 		log.Printf("Could not read memory usage: %v", err)
-		return
+		return nil
 	}
 
 	// 3) Disk usage (корневой раздел "/")
 	diskStat, err := disk.Usage("/")
 	if err != nil {
 		log.Printf("Could not read disk usage: %v", err)
-		return
+		return nil
 	}
 
 	// 4) Network usage (количество байт по интерфейсам с момента запуска)
@@ -317,7 +602,7 @@ func sendSystemMetrics(client api.MetricsServiceClient, tag string) {
 	netCounters, err := net.IOCounters(false)
 	if err != nil || len(netCounters) == 0 {
 		log.Printf("Could not read network usage: %v", err)
-		return
+		return nil
 	}
 
 	hostname, err := os.Hostname()
@@ -337,16 +622,24 @@ func sendSystemMetrics(client api.MetricsServiceClient, tag string) {
 		MemoryUsage:  memStat.UsedPercent,
 		DiskUsage:    diskStat.UsedPercent,
 		NetworkUsage: float64(bytesSent + bytesRecv),
+		Labels:       agentLabels,
+		CollectedAt:  collectedAt,
+	}
+	if withInventory {
+		req.Inventory = collectInventory(hostname, diskStat.Total, memStat.Total)
 	}
+	req.Samples = collectSamples(collectedAt, memStat, bytesSent, bytesRecv)
+	req.SentAt = timestamppb.Now()
 
 	// Отправляем данные на gRPC-сервер
 	resp, err := client.SendMetrics(ctx, req)
 	if err != nil {
 		log.Printf("SendMetrics error: %v", err)
-		return
+		return nil
 	}
 
 	log.Printf("SendMetrics response: %s, tag=%s, CPU=%.2f%%, MEM=%.2f%%, Disk=%.2f%%, Network=%.2f bytes",
 		resp.Status, tag, req.CpuUsage, req.MemoryUsage, req.DiskUsage, req.NetworkUsage,
 	)
+	return resp
 }
@@ -3,16 +3,22 @@ package main
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
+	"os"
+	"os/signal"
 	"strconv"
+	"syscall"
 	"time"
 
-	"gohub/internal/config"
-	"gohub/internal/db"
-	"gohub/internal/server"
-	ws "gohub/internal/websocket"
+	"github.com/vovakirdan/gohub/internal/config"
+	"github.com/vovakirdan/gohub/internal/db"
+	"github.com/vovakirdan/gohub/internal/labels"
+	"github.com/vovakirdan/gohub/internal/notify"
+	"github.com/vovakirdan/gohub/internal/server"
+	ws "github.com/vovakirdan/gohub/internal/websocket"
 
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 )
@@ -23,9 +29,11 @@ func corsMiddleware(next http.Handler) http.Handler {
 		// Разрешаем запросы с любого домена
 		w.Header().Set("Access-Control-Allow-Origin", "*")
 		// Разрешённые HTTP-методы
-		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, OPTIONS")
+		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, DELETE, OPTIONS")
 		// Разрешённые заголовки
 		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
+		// Заголовки ответа, доступные скриптам
+		w.Header().Set("Access-Control-Expose-Headers", "X-Next-Page-Token")
 		// Если это preflight-запрос, возвращаем 200
 		if r.Method == http.MethodOptions {
 			w.WriteHeader(http.StatusOK)
@@ -35,6 +43,28 @@ func corsMiddleware(next http.Handler) http.Handler {
 	})
 }
 
+// parseTimeParam разбирает время из query-параметра: RFC 3339 или unix-секунды.
+// Пустая строка — нулевое время (без ограничения).
+func parseTimeParam(v string) (time.Time, error) {
+	if v == "" {
+		return time.Time{}, nil
+	}
+	if sec, err := strconv.ParseInt(v, 10, 64); err == nil {
+		return time.Unix(sec, 0), nil
+	}
+	return time.Parse(time.RFC3339Nano, v)
+}
+
+// newHTTPServer создаёт http.Server с таймаутами из конфига; Handler задаётся при запуске
+func newHTTPServer(cfg config.HTTPListenerConfig) *http.Server {
+	return &http.Server{
+		ReadHeaderTimeout: cfg.ReadHeaderTimeout,
+		ReadTimeout:       cfg.ReadTimeout,
+		WriteTimeout:      cfg.WriteTimeout,
+		IdleTimeout:       cfg.IdleTimeout,
+	}
+}
+
 func main() {
 	cfg, err := config.LoadConfig("./config")
 	if err != nil {
@@ -74,72 +104,775 @@ func main() {
 	hub := ws.NewHub()
 
 	// Инициализируем gRPC-сервер
+	srv, err := server.NewMetricsServer(storage, hub, cfg)
+	if err != nil {
+		log.Fatalf("Failed to create server: %v", err)
+	}
+	ctx, cancel = context.WithTimeout(context.Background(), 5*time.Second)
+	err = srv.LoadAssignedLabels(ctx)
+	cancel()
+	if err != nil {
+		log.Fatalf("Failed to load server labels: %v", err)
+	}
+	ctx, cancel = context.WithTimeout(context.Background(), 5*time.Second)
+	err = srv.LoadHeartbeats(ctx)
+	cancel()
+	if err != nil {
+		log.Fatalf("Failed to load heartbeats: %v", err)
+	}
+	ctx, cancel = context.WithTimeout(context.Background(), 30*time.Second)
+	err = srv.WarmLatest(ctx)
+	cancel()
+	if err != nil {
+		log.Fatalf("Failed to load latest values: %v", err)
+	}
+	ctx, cancel = context.WithTimeout(context.Background(), 5*time.Second)
+	err = srv.LoadServerStates(ctx)
+	cancel()
+	if err != nil {
+		log.Fatalf("Failed to load server states: %v", err)
+	}
+	ctx, cancel = context.WithTimeout(context.Background(), 5*time.Second)
+	err = srv.LoadAlerting(ctx)
+	cancel()
+	if err != nil {
+		log.Fatalf("Failed to load alert rules: %v", err)
+	}
+	ctx, cancel = context.WithTimeout(context.Background(), 5*time.Second)
+	err = srv.LoadSilences(ctx)
+	if err == nil {
+		err = srv.LoadMaintenanceWindows(ctx)
+	}
+	cancel()
+	if err != nil {
+		log.Fatalf("Failed to load silences and maintenance windows: %v", err)
+	}
+	ctx, cancel = context.WithTimeout(context.Background(), 30*time.Second)
+	err = srv.LoadAnomalyBaselines(ctx)
+	cancel()
+	if err != nil {
+		log.Fatalf("Failed to load anomaly baselines: %v", err)
+	}
+
+	// Остановка по SIGINT/SIGTERM
+	sigCtx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	// Слушатели открываем до запуска, чтобы ошибка адреса остановила старт сразу
+	httpListener, err := server.Listen(cfg.Server.HTTP.Addr)
+	if err != nil {
+		log.Fatalf("HTTP server: %v", err)
+	}
+	metricsListener, err := server.Listen(cfg.Server.Metrics.Addr)
+	if err != nil {
+		log.Fatalf("Prometheus metrics server: %v", err)
+	}
+	httpServer := newHTTPServer(cfg.Server.HTTP)
+	metricsServer := newHTTPServer(cfg.Server.Metrics)
+
 	go func() {
 		// Создаём новый mux для регистрации маршрутов
 		mux := http.NewServeMux()
 
 		mux.HandleFunc("/api/metrics", func(w http.ResponseWriter, r *http.Request) {
-			// Прочитаем query-параметры: server_id, tag, limit
+			// Прочитаем query-параметры: server_id, tag, labels, limit, from, to, order, page_token
 			q := r.URL.Query()
-			serverID := q.Get("server_id")
-			tag := q.Get("tag")
+			selector, err := labels.Parse(q.Get("labels"))
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
 			limitStr := q.Get("limit")
 			if limitStr == "" {
 				limitStr = "50"
 			}
 			limit, _ := strconv.ParseInt(limitStr, 10, 64)
 
+			query := db.MetricsQuery{
+				ServerID:  q.Get("server_id"),
+				Tag:       q.Get("tag"),
+				Labels:    selector,
+				Ascending: q.Get("order") == "asc",
+				Limit:     limit,
+				PageToken: q.Get("page_token"),
+			}
+			if query.From, err = parseTimeParam(q.Get("from")); err != nil {
+				http.Error(w, "invalid from: "+err.Error(), http.StatusBadRequest)
+				return
+			}
+			if query.To, err = parseTimeParam(q.Get("to")); err != nil {
+				http.Error(w, "invalid to: "+err.Error(), http.StatusBadRequest)
+				return
+			}
+
 			// Вызываем LoadMetrics
-			data, err := storage.LoadMetrics(r.Context(), serverID, tag, limit)
+			data, next, err := storage.LoadMetrics(r.Context(), query)
+			if errors.Is(err, db.ErrInvalidPageToken) {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
 			if err != nil {
 				w.WriteHeader(http.StatusInternalServerError)
 				fmt.Fprintf(w, "DB error: %v", err)
 				return
 			}
 
+			// Токен следующей страницы — в заголовке, чтобы тело осталось массивом
+			if next != "" {
+				w.Header().Set("X-Next-Page-Token", next)
+			}
 			// Возвращаем JSON
 			w.Header().Set("Content-Type", "application/json")
 			json.NewEncoder(w).Encode(data)
 		})
+		// Произвольные сэмплы: ?server_id=&tag=&name=&labels=&limit=
+		mux.HandleFunc("/api/samples", func(w http.ResponseWriter, r *http.Request) {
+			q := r.URL.Query()
+			selector, err := labels.Parse(q.Get("labels"))
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			limit, err := strconv.ParseInt(q.Get("limit"), 10, 64)
+			if err != nil || limit <= 0 {
+				limit = 50
+			}
+			data, err := storage.LoadSamples(r.Context(), q.Get("server_id"), q.Get("tag"), q.Get("name"), selector, limit)
+			if err != nil {
+				w.WriteHeader(http.StatusInternalServerError)
+				fmt.Fprintf(w, "DB error: %v", err)
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(data)
+		})
+		// Агрегированные ряды: ?metric=&from=&to=&step=&agg=avg|min|max|p95|last&server_id=&tag=&labels=
+		mux.HandleFunc("/api/query_range", func(w http.ResponseWriter, r *http.Request) {
+			q := r.URL.Query()
+			selector, err := labels.Parse(q.Get("labels"))
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			query := db.RangeQuery{
+				ServerID:    q.Get("server_id"),
+				Tag:         q.Get("tag"),
+				Labels:      selector,
+				Metric:      q.Get("metric"),
+				Aggregation: q.Get("agg"),
+			}
+			if query.Aggregation == "" {
+				query.Aggregation = db.AggAvg
+			}
+			if query.From, err = parseTimeParam(q.Get("from")); err != nil {
+				http.Error(w, "invalid from: "+err.Error(), http.StatusBadRequest)
+				return
+			}
+			if query.To, err = parseTimeParam(q.Get("to")); err != nil {
+				http.Error(w, "invalid to: "+err.Error(), http.StatusBadRequest)
+				return
+			}
+			// Шаг: длительность ("5m") или число секунд
+			step := q.Get("step")
+			if sec, err := strconv.ParseInt(step, 10, 64); err == nil {
+				query.Step = time.Duration(sec) * time.Second
+			} else if query.Step, err = time.ParseDuration(step); err != nil {
+				http.Error(w, "invalid step: "+err.Error(), http.StatusBadRequest)
+				return
+			}
+			if err := query.Validate(); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+
+			data, err := storage.QueryRange(r.Context(), query)
+			if err != nil {
+				w.WriteHeader(http.StatusInternalServerError)
+				fmt.Fprintf(w, "DB error: %v", err)
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(data)
+		})
 		mux.HandleFunc("/api/list_servers", func(w http.ResponseWriter, r *http.Request) {
-			data, err := storage.LoadServersWithTags(r.Context())
+			selector, err := labels.Parse(r.URL.Query().Get("labels"))
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			data, err := srv.ServersWithMaintenance(r.Context(), selector)
+			if err != nil {
+				w.WriteHeader(http.StatusInternalServerError)
+				fmt.Fprintf(w, "DB error: %v", err)
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(data)
+		})
+		// Лейблы, назначенные серверам: GET — список, POST — назначить
+		// (тело {"server_id": "...", "tag": "...", "labels": {...}}, пустые labels — удалить)
+		mux.HandleFunc("/api/server_labels", func(w http.ResponseWriter, r *http.Request) {
+			switch r.Method {
+			case http.MethodGet:
+				data, err := storage.LoadServerLabels(r.Context())
+				if err != nil {
+					w.WriteHeader(http.StatusInternalServerError)
+					fmt.Fprintf(w, "DB error: %v", err)
+					return
+				}
+				w.Header().Set("Content-Type", "application/json")
+				json.NewEncoder(w).Encode(data)
+			case http.MethodPost:
+				var body db.ServerLabelsRow
+				if err := json.NewDecoder(r.Body).Decode(&body); err != nil || body.ServerID == "" {
+					http.Error(w, "expected JSON body with server_id and labels", http.StatusBadRequest)
+					return
+				}
+				if err := srv.SetAssignedLabels(r.Context(), body.ServerID, body.Tag, body.Labels); err != nil {
+					http.Error(w, err.Error(), http.StatusBadRequest)
+					return
+				}
+				w.WriteHeader(http.StatusNoContent)
+			default:
+				w.WriteHeader(http.StatusMethodNotAllowed)
+			}
+		})
+
+		// Реестр серверов: GET без server_id — список (?labels=), GET ?server_id=&tag= — один сервер,
+		// DELETE ?server_id=&tag=&purge=true — вывод из эксплуатации (purge — удалить и историю)
+		mux.HandleFunc("/api/servers", func(w http.ResponseWriter, r *http.Request) {
+			q := r.URL.Query()
+			serverID := q.Get("server_id")
+			switch {
+			case r.Method == http.MethodGet && serverID == "":
+				selector, err := labels.Parse(q.Get("labels"))
+				if err != nil {
+					http.Error(w, err.Error(), http.StatusBadRequest)
+					return
+				}
+				data, err := srv.Servers(r.Context(), selector)
+				if err != nil {
+					w.WriteHeader(http.StatusInternalServerError)
+					fmt.Fprintf(w, "DB error: %v", err)
+					return
+				}
+				w.Header().Set("Content-Type", "application/json")
+				json.NewEncoder(w).Encode(data)
+			case r.Method == http.MethodGet:
+				info, err := srv.Server(r.Context(), serverID, q.Get("tag"))
+				if err != nil {
+					w.WriteHeader(http.StatusInternalServerError)
+					fmt.Fprintf(w, "DB error: %v", err)
+					return
+				}
+				if info == nil {
+					http.Error(w, "server not found", http.StatusNotFound)
+					return
+				}
+				w.Header().Set("Content-Type", "application/json")
+				json.NewEncoder(w).Encode(info)
+			case r.Method == http.MethodDelete:
+				if serverID == "" {
+					http.Error(w, "server_id is required", http.StatusBadRequest)
+					return
+				}
+				ok, err := srv.Decommission(r.Context(), serverID, q.Get("tag"), q.Get("purge") == "true")
+				if err != nil {
+					w.WriteHeader(http.StatusInternalServerError)
+					fmt.Fprintf(w, "DB error: %v", err)
+					return
+				}
+				if !ok {
+					http.Error(w, "server not found", http.StatusNotFound)
+					return
+				}
+				w.WriteHeader(http.StatusNoContent)
+			default:
+				w.WriteHeader(http.StatusMethodNotAllowed)
+			}
+		})
+
+		// Последние значения всех серверов из кеша (?tag=prod&labels=env=prod)
+		mux.HandleFunc("/api/servers/latest", func(w http.ResponseWriter, r *http.Request) {
+			if r.Method != http.MethodGet {
+				w.WriteHeader(http.StatusMethodNotAllowed)
+				return
+			}
+			selector, err := labels.Parse(r.URL.Query().Get("labels"))
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(srv.FleetSnapshot(r.URL.Query().Get("tag"), selector))
+		})
+
+		// Смены состояния online/stale/offline (?server_id=&tag=&limit=)
+		mux.HandleFunc("/api/servers/events", func(w http.ResponseWriter, r *http.Request) {
+			if r.Method != http.MethodGet {
+				w.WriteHeader(http.StatusMethodNotAllowed)
+				return
+			}
+			q := r.URL.Query()
+			limit := int64(100)
+			if v := q.Get("limit"); v != "" {
+				n, err := strconv.ParseInt(v, 10, 64)
+				if err != nil || n <= 0 {
+					http.Error(w, "invalid limit", http.StatusBadRequest)
+					return
+				}
+				limit = n
+			}
+			events, err := srv.ServerEvents(r.Context(), q.Get("server_id"), q.Get("tag"), limit)
 			if err != nil {
 				w.WriteHeader(http.StatusInternalServerError)
 				fmt.Fprintf(w, "DB error: %v", err)
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(events)
+		})
+
+		// Оповещения: активные из памяти (?server_id=) или история из БД (?history=true&state=resolved&limit=)
+		mux.HandleFunc("/api/alerts", func(w http.ResponseWriter, r *http.Request) {
+			if r.Method != http.MethodGet {
+				w.WriteHeader(http.StatusMethodNotAllowed)
+				return
+			}
+			q := r.URL.Query()
+			if q.Get("history") != "true" {
+				w.Header().Set("Content-Type", "application/json")
+				json.NewEncoder(w).Encode(srv.ActiveAlerts(q.Get("server_id")))
+				return
+			}
+			limit, err := strconv.ParseInt(q.Get("limit"), 10, 64)
+			if err != nil || limit <= 0 {
+				limit = 100
+			}
+			var states []string
+			if st := q.Get("state"); st != "" {
+				states = []string{st}
+			}
+			alerts, err := srv.AlertHistory(r.Context(), states, q.Get("server_id"), limit)
+			if err != nil {
+				w.WriteHeader(http.StatusInternalServerError)
+				fmt.Fprintf(w, "DB error: %v", err)
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(alerts)
+		})
+
+		// Правила оповещений: GET — список, POST — создать/заменить
+		// (тело {"name": "high_cpu", "expr": "cpu_usage > 90 for 5m on tag=prod", "severity": "critical"}),
+		// DELETE ?name= — удалить
+		mux.HandleFunc("/api/alerts/rules", func(w http.ResponseWriter, r *http.Request) {
+			switch r.Method {
+			case http.MethodGet:
+				w.Header().Set("Content-Type", "application/json")
+				json.NewEncoder(w).Encode(srv.AlertRules())
+			case http.MethodPost:
+				var rule db.AlertRuleRow
+				if err := json.NewDecoder(r.Body).Decode(&rule); err != nil {
+					http.Error(w, "invalid JSON: "+err.Error(), http.StatusBadRequest)
+					return
+				}
+				err := srv.SetAlertRule(r.Context(), rule)
+				switch {
+				case errors.Is(err, server.ErrInvalidAlertRule):
+					http.Error(w, err.Error(), http.StatusBadRequest)
+				case errors.Is(err, server.ErrReadOnlyAlertRule):
+					http.Error(w, err.Error(), http.StatusConflict)
+				case err != nil:
+					w.WriteHeader(http.StatusInternalServerError)
+					fmt.Fprintf(w, "DB error: %v", err)
+				default:
+					w.WriteHeader(http.StatusNoContent)
+				}
+			case http.MethodDelete:
+				ok, err := srv.DeleteAlertRule(r.Context(), r.URL.Query().Get("name"))
+				switch {
+				case errors.Is(err, server.ErrReadOnlyAlertRule):
+					http.Error(w, err.Error(), http.StatusConflict)
+				case err != nil:
+					w.WriteHeader(http.StatusInternalServerError)
+					fmt.Fprintf(w, "DB error: %v", err)
+				case !ok:
+					http.Error(w, "rule not found", http.StatusNotFound)
+				default:
+					w.WriteHeader(http.StatusNoContent)
+				}
+			default:
+				w.WriteHeader(http.StatusMethodNotAllowed)
+			}
+		})
+
+		// Заглушки уведомлений: GET — действующие (?all=true — все из БД), POST — создать
+		// (тело {"server_id": "db-1", "labels": {...}, "duration": "2h", "comment": "..."} или с "ends_at"),
+		// DELETE ?id= — завершить досрочно
+		mux.HandleFunc("/api/silences", func(w http.ResponseWriter, r *http.Request) {
+			switch r.Method {
+			case http.MethodGet:
+				data, err := srv.Silences(r.Context(), r.URL.Query().Get("all") == "true")
+				if err != nil {
+					w.WriteHeader(http.StatusInternalServerError)
+					fmt.Fprintf(w, "DB error: %v", err)
+					return
+				}
+				w.Header().Set("Content-Type", "application/json")
+				json.NewEncoder(w).Encode(data)
+			case http.MethodPost:
+				var body struct {
+					db.SilenceRow
+					Duration string `json:"duration"`
+				}
+				if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+					http.Error(w, "invalid JSON: "+err.Error(), http.StatusBadRequest)
+					return
+				}
+				if body.Duration != "" {
+					d, err := time.ParseDuration(body.Duration)
+					if err != nil || d <= 0 {
+						http.Error(w, "invalid duration: "+body.Duration, http.StatusBadRequest)
+						return
+					}
+					start := body.StartsAt
+					if start.IsZero() {
+						start = time.Now()
+					}
+					body.EndsAt = start.Add(d)
+				}
+				sil, err := srv.CreateSilence(r.Context(), body.SilenceRow)
+				switch {
+				case errors.Is(err, server.ErrInvalidSilence):
+					http.Error(w, err.Error(), http.StatusBadRequest)
+				case err != nil:
+					w.WriteHeader(http.StatusInternalServerError)
+					fmt.Fprintf(w, "DB error: %v", err)
+				default:
+					w.Header().Set("Content-Type", "application/json")
+					w.WriteHeader(http.StatusCreated)
+					json.NewEncoder(w).Encode(sil)
+				}
+			case http.MethodDelete:
+				id, err := strconv.ParseInt(r.URL.Query().Get("id"), 10, 64)
+				if err != nil {
+					http.Error(w, "id is required", http.StatusBadRequest)
+					return
+				}
+				ok, err := srv.ExpireSilence(r.Context(), id)
+				switch {
+				case err != nil:
+					w.WriteHeader(http.StatusInternalServerError)
+					fmt.Fprintf(w, "DB error: %v", err)
+				case !ok:
+					http.Error(w, "silence not found or already expired", http.StatusNotFound)
+				default:
+					w.WriteHeader(http.StatusNoContent)
+				}
+			default:
+				w.WriteHeader(http.StatusMethodNotAllowed)
+			}
+		})
+
+		// Окна обслуживания: GET — список с признаком active, POST — создать/заменить
+		// (тело {"name": "patching", "schedule": "0 3 * * 0", "duration": "2h", "labels": {"env": "prod"}}),
+		// DELETE ?name= — удалить
+		mux.HandleFunc("/api/maintenance", func(w http.ResponseWriter, r *http.Request) {
+			switch r.Method {
+			case http.MethodGet:
+				w.Header().Set("Content-Type", "application/json")
+				json.NewEncoder(w).Encode(srv.MaintenanceWindows())
+			case http.MethodPost:
+				var window db.MaintenanceWindowRow
+				if err := json.NewDecoder(r.Body).Decode(&window); err != nil {
+					http.Error(w, "invalid JSON: "+err.Error(), http.StatusBadRequest)
+					return
+				}
+				err := srv.SetMaintenanceWindow(r.Context(), window)
+				switch {
+				case errors.Is(err, server.ErrInvalidMaintenanceWindow):
+					http.Error(w, err.Error(), http.StatusBadRequest)
+				case err != nil:
+					w.WriteHeader(http.StatusInternalServerError)
+					fmt.Fprintf(w, "DB error: %v", err)
+				default:
+					w.WriteHeader(http.StatusNoContent)
+				}
+			case http.MethodDelete:
+				ok, err := srv.DeleteMaintenanceWindow(r.Context(), r.URL.Query().Get("name"))
+				switch {
+				case err != nil:
+					w.WriteHeader(http.StatusInternalServerError)
+					fmt.Fprintf(w, "DB error: %v", err)
+				case !ok:
+					http.Error(w, "maintenance window not found", http.StatusNotFound)
+				default:
+					w.WriteHeader(http.StatusNoContent)
+				}
+			default:
+				w.WriteHeader(http.StatusMethodNotAllowed)
+			}
+		})
+
+		// Оценки аномалий из БД (?server_id=&tag=&metric=&limit=; по умолчанию только аномалии, ?all=true — все)
+		mux.HandleFunc("/api/anomalies", func(w http.ResponseWriter, r *http.Request) {
+			if r.Method != http.MethodGet {
+				w.WriteHeader(http.StatusMethodNotAllowed)
+				return
+			}
+			q := r.URL.Query()
+			limit, err := strconv.ParseInt(q.Get("limit"), 10, 64)
+			if err != nil || limit <= 0 {
+				limit = 100
+			}
+			data, err := srv.AnomalyScores(r.Context(), q.Get("server_id"), q.Get("tag"), q.Get("metric"), q.Get("all") == "true", limit)
+			if err != nil {
+				w.WriteHeader(http.StatusInternalServerError)
+				fmt.Fprintf(w, "DB error: %v", err)
+				return
 			}
 			w.Header().Set("Content-Type", "application/json")
 			json.NewEncoder(w).Encode(data)
 		})
 
+		// Текущие базовые линии рядов (?server_id=&tag=)
+		mux.HandleFunc("/api/anomalies/baselines", func(w http.ResponseWriter, r *http.Request) {
+			if r.Method != http.MethodGet {
+				w.WriteHeader(http.StatusMethodNotAllowed)
+				return
+			}
+			q := r.URL.Query()
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(srv.AnomalyBaselines(q.Get("server_id"), q.Get("tag")))
+		})
+
+		// Прогнозы заполнения по всем окнам (?server_id=&tag=&metric=)
+		mux.HandleFunc("/api/forecast", func(w http.ResponseWriter, r *http.Request) {
+			if r.Method != http.MethodGet {
+				w.WriteHeader(http.StatusMethodNotAllowed)
+				return
+			}
+			q := r.URL.Query()
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(srv.Forecasts(q.Get("server_id"), q.Get("tag"), q.Get("metric")))
+		})
+
+		// Отчёт по парку: самые срочные прогнозы первыми (?metric=&within=72h&limit=)
+		mux.HandleFunc("/api/forecast/report", func(w http.ResponseWriter, r *http.Request) {
+			if r.Method != http.MethodGet {
+				w.WriteHeader(http.StatusMethodNotAllowed)
+				return
+			}
+			q := r.URL.Query()
+			var within time.Duration
+			if v := q.Get("within"); v != "" {
+				d, err := time.ParseDuration(v)
+				if err != nil || d <= 0 {
+					http.Error(w, "invalid within: expected a positive duration such as 72h", http.StatusBadRequest)
+					return
+				}
+				within = d
+			}
+			limit, err := strconv.Atoi(q.Get("limit"))
+			if err != nil || limit < 0 {
+				limit = 0
+			}
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(srv.ForecastReport(q.Get("metric"), within, limit))
+		})
+
+		// Каналы уведомлений
+		mux.HandleFunc("/api/notify/channels", func(w http.ResponseWriter, r *http.Request) {
+			if r.Method != http.MethodGet {
+				w.WriteHeader(http.StatusMethodNotAllowed)
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(srv.NotifyChannels())
+		})
+
+		// Пробное уведомление: POST ?channel=<имя>; ответ после отправки со всеми повторами
+		mux.HandleFunc("/api/notify/test", func(w http.ResponseWriter, r *http.Request) {
+			if r.Method != http.MethodPost {
+				w.WriteHeader(http.StatusMethodNotAllowed)
+				return
+			}
+			err := srv.TestNotify(r.Context(), r.URL.Query().Get("channel"))
+			switch {
+			case errors.Is(err, notify.ErrUnknownChannel):
+				http.Error(w, err.Error(), http.StatusNotFound)
+			case err != nil:
+				http.Error(w, "notification failed: "+err.Error(), http.StatusBadGateway)
+			default:
+				w.WriteHeader(http.StatusNoContent)
+			}
+		})
+
+		// Указания агентам: GET — текущие, POST — задать
+		// (тело {"server_id": "", "send_interval_ms": 10000, "slow_down": false}, пустой server_id — весь парк)
+		mux.HandleFunc("/api/agents/directives", func(w http.ResponseWriter, r *http.Request) {
+			switch r.Method {
+			case http.MethodGet:
+				fleet, perServer := srv.FleetDirectives()
+				w.Header().Set("Content-Type", "application/json")
+				json.NewEncoder(w).Encode(map[string]interface{}{
+					"fleet":   fleet,
+					"servers": perServer,
+				})
+			case http.MethodPost:
+				var body struct {
+					ServerID string `json:"server_id"`
+					server.Directives
+				}
+				if err := json.NewDecoder(r.Body).Decode(&body); err != nil || body.SendIntervalMs < 0 {
+					http.Error(w, "expected JSON body with send_interval_ms and slow_down", http.StatusBadRequest)
+					return
+				}
+				if body.SendIntervalMs > 0 && body.SendIntervalMs < server.MinSendIntervalMs {
+					http.Error(w, fmt.Sprintf("send_interval_ms must be 0 or at least %d", server.MinSendIntervalMs), http.StatusBadRequest)
+					return
+				}
+				srv.SetDirectives(body.ServerID, body.Directives)
+				w.WriteHeader(http.StatusNoContent)
+			default:
+				w.WriteHeader(http.StatusMethodNotAllowed)
+			}
+		})
+		// Запросить у агента повторную отправку инвентаря: POST ?server_id=&tag=
+		mux.HandleFunc("/api/agents/resend_inventory", func(w http.ResponseWriter, r *http.Request) {
+			if r.Method != http.MethodPost {
+				w.WriteHeader(http.StatusMethodNotAllowed)
+				return
+			}
+			q := r.URL.Query()
+			if q.Get("server_id") == "" {
+				http.Error(w, "server_id is required", http.StatusBadRequest)
+				return
+			}
+			srv.RequestInventory(q.Get("server_id"), q.Get("tag"))
+			w.WriteHeader(http.StatusNoContent)
+		})
+
+		// Последние heartbeat агентов с признаком доступности
+		mux.HandleFunc("/api/agents/heartbeats", func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(srv.HeartbeatStatuses())
+		})
+
+		// Диагностика: GET — список запросов (?server_id=&tag=&status=&limit=),
+		// POST — поставить команду в очередь агента (тело {"server_id", "tag", "command", "requested_by"})
+		mux.HandleFunc("/api/diagnostics", func(w http.ResponseWriter, r *http.Request) {
+			switch r.Method {
+			case http.MethodGet:
+				q := r.URL.Query()
+				limit, err := strconv.ParseInt(q.Get("limit"), 10, 64)
+				if err != nil || limit <= 0 {
+					limit = 50
+				}
+				data, err := storage.LoadDiagnostics(r.Context(), q.Get("server_id"), q.Get("tag"), q.Get("status"), limit)
+				if err != nil {
+					w.WriteHeader(http.StatusInternalServerError)
+					fmt.Fprintf(w, "DB error: %v", err)
+					return
+				}
+				w.Header().Set("Content-Type", "application/json")
+				json.NewEncoder(w).Encode(data)
+			case http.MethodPost:
+				var body struct {
+					ServerID    string `json:"server_id"`
+					Tag         string `json:"tag"`
+					Command     string `json:"command"`
+					RequestedBy string `json:"requested_by"`
+				}
+				if err := json.NewDecoder(r.Body).Decode(&body); err != nil || body.ServerID == "" || body.Command == "" {
+					http.Error(w, "expected JSON body with server_id and command", http.StatusBadRequest)
+					return
+				}
+				actor := fmt.Sprintf("%s (%s)", body.RequestedBy, r.RemoteAddr)
+				id, err := srv.QueueDiagnostic(r.Context(), body.ServerID, body.Tag, body.Command, actor)
+				if err != nil {
+					w.WriteHeader(http.StatusInternalServerError)
+					fmt.Fprintf(w, "DB error: %v", err)
+					return
+				}
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(http.StatusAccepted)
+				json.NewEncoder(w).Encode(map[string]int64{"id": id})
+			default:
+				w.WriteHeader(http.StatusMethodNotAllowed)
+			}
+		})
+		// Журнал аудита диагностики: ?id= (необязательно), ?limit=
+		mux.HandleFunc("/api/diagnostics/audit", func(w http.ResponseWriter, r *http.Request) {
+			q := r.URL.Query()
+			id, _ := strconv.ParseInt(q.Get("id"), 10, 64)
+			limit, err := strconv.ParseInt(q.Get("limit"), 10, 64)
+			if err != nil || limit <= 0 {
+				limit = 100
+			}
+			data, err := storage.LoadDiagnosticAudit(r.Context(), id, limit)
+			if err != nil {
+				w.WriteHeader(http.StatusInternalServerError)
+				fmt.Fprintf(w, "DB error: %v", err)
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(data)
+		})
+
+		// Оценка расхождения часов агентов
+		mux.HandleFunc("/api/agents/clock", func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(srv.ClockStatuses())
+		})
+
+		// HTTP-фолбэк для агентов, которым недоступен gRPC
+		mux.HandleFunc("/api/ingest", srv.IngestHandler())
+		mux.HandleFunc("/api/heartbeat", srv.HeartbeatHandler())
+
 		mux.HandleFunc("/ws", hub.HandleConnections)
-		mux.Handle("/", http.FileServer(http.Dir("./web"))) // статика в ./web
+		mux.Handle("/", http.FileServer(http.Dir(cfg.Server.StaticDir))) // статика веб-интерфейса
 
-		corsMux := corsMiddleware(mux)
+		// gRPC-Web: браузер и скрипты вызывают MetricsService напрямую на этом же порту
+		handler := srv.GRPCWebHandler(corsMiddleware(mux))
+		if cfg.Server.SinglePort {
+			// Агенты подключаются по gRPC к этому же порту
+			handler = srv.SinglePortHandler(handler)
+		}
 
-		log.Println("HTTP/WebSocket server on :8080")
-		if err := http.ListenAndServe(":8080", corsMux); err != nil {
-			log.Fatalf("ListenAndServe error: %v", err)
+		log.Printf("HTTP/WebSocket server on %s", cfg.Server.HTTP.Addr)
+		httpServer.Handler = handler
+		if err := httpServer.Serve(httpListener); err != nil && err != http.ErrServerClosed {
+			log.Fatalf("HTTP server error: %v", err)
 		}
 	}()
 
-	srv := server.NewMetricsServer(storage, hub)
-
 	go func() {
-		http.Handle("/metrics", promhttp.Handler())
-		log.Println("Prometheus metrics on :2112/metrics")
-		if err := http.ListenAndServe(":2112", nil); err != nil {
+		metricsMux := http.NewServeMux()
+		metricsMux.Handle("/metrics", promhttp.Handler())
+		metricsServer.Handler = metricsMux
+		log.Printf("Prometheus metrics on %s/metrics", cfg.Server.Metrics.Addr)
+		if err := metricsServer.Serve(metricsListener); err != nil && err != http.ErrServerClosed {
 			log.Fatalf("Prometheus metrics server error: %v", err)
 		}
 	}()
 
-	// Запускаем периодическую очистку старых метрик
+	// Запускаем периодическую очистку старых метрик: раз в срок хранения
+	retention := srv.Retention()
+	log.Printf("Keeping metrics history for %s", retention)
 	go func() {
-		cleanupTicker := time.NewTicker(3 * 24 * time.Hour) // каждые 3 дня
+		cleanupTicker := time.NewTicker(retention)
 		defer cleanupTicker.Stop()
 
-		for range cleanupTicker.C {
-			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
-			count, err := storage.CleanOldMetrics(ctx, 3*24*time.Hour) // хранить данные за 3 дня
+		for {
+			select {
+			case <-sigCtx.Done():
+				return
+			case <-cleanupTicker.C:
+			}
+			ctx, cancel := context.WithTimeout(sigCtx, 5*time.Minute)
+			count, err := storage.CleanOldMetrics(ctx, retention)
 			cancel()
 
 			if err != nil {
@@ -152,7 +885,7 @@ func main() {
 
 	// Запускаем первую очистку сразу при старте
 	ctx, cancel = context.WithTimeout(context.Background(), 5*time.Minute)
-	count, err := storage.CleanOldMetrics(ctx, 3*24*time.Hour)
+	count, err := storage.CleanOldMetrics(ctx, retention)
 	cancel()
 	if err != nil {
 		log.Printf("Initial cleanup failed: %v", err)
@@ -160,8 +893,38 @@ func main() {
 		log.Printf("Initial cleanup: removed %d old metrics records", count)
 	}
 
-	// Запускаем gRPC
-	if err := srv.Start(); err != nil {
-		log.Fatalf("Failed to start gRPC server: %v", err)
+	// Запускаем gRPC на отдельном порту, если он не совмещён с HTTP
+	if !cfg.Server.SinglePort {
+		go func() {
+			if err := srv.Start(); err != nil {
+				log.Fatalf("Failed to start gRPC server: %v", err)
+			}
+		}()
+	}
+
+	<-sigCtx.Done()
+	stop()
+	log.Printf("Shutting down (timeout %s)...", cfg.Server.ShutdownTimeout)
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.Server.ShutdownTimeout)
+	defer cancel()
+
+	// Перестаём принимать агентов, потоки подписчиков завершаются
+	srv.StopAccepting()
+	// Затем останавливаем HTTP: через него идут gRPC-Web и (при single_port) агенты,
+	// их вызовы должны завершиться до остановки gRPC-сервера. WebSocket-клиенты получают close frame.
+	hub.Close()
+	if err := httpServer.Shutdown(shutdownCtx); err != nil {
+		log.Printf("HTTP server shutdown error: %v", err)
+	}
+	// Затем gRPC: дожидаемся начатых запросов и дописываем очередь приёма
+	srv.Shutdown(shutdownCtx)
+
+	// Метрики отдаём до последнего, затем закрываем пул БД
+	if err := metricsServer.Shutdown(shutdownCtx); err != nil {
+		log.Printf("Prometheus metrics server shutdown error: %v", err)
+	}
+	if err := storage.Close(); err != nil {
+		log.Printf("Failed to close DB: %v", err)
 	}
+	log.Println("Server stopped")
 }
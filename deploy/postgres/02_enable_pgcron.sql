@@ -11,6 +11,7 @@ SELECT cron.schedule(
   'biweekly_cleanup',
   '0 3 * * 0',  -- This will run at 03:00 every two weeks on Sunday
   $$
-    DELETE FROM metrics WHERE created_at < NOW() - INTERVAL '30 days'
+    DELETE FROM metrics WHERE created_at < NOW() - INTERVAL '30 days';
+    DELETE FROM samples WHERE ts < NOW() - INTERVAL '30 days'
   $$
 );
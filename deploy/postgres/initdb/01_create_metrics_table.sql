@@ -8,3 +8,175 @@ CREATE TABLE IF NOT EXISTS metrics (
     network_usage DOUBLE PRECISION NOT NULL,
     created_at TIMESTAMPTZ DEFAULT now()
 );
+
+ALTER TABLE metrics ADD COLUMN IF NOT EXISTS labels JSONB NOT NULL DEFAULT '{}';
+CREATE INDEX IF NOT EXISTS metrics_labels_idx ON metrics USING GIN (labels);
+CREATE INDEX IF NOT EXISTS metrics_created_idx ON metrics (created_at, id);
+CREATE INDEX IF NOT EXISTS metrics_server_idx ON metrics (server_id, tag, created_at);
+
+CREATE TABLE IF NOT EXISTS server_labels (
+    server_id TEXT NOT NULL,
+    tag TEXT NOT NULL DEFAULT '',
+    labels JSONB NOT NULL DEFAULT '{}',
+    updated_at TIMESTAMPTZ DEFAULT now(),
+    PRIMARY KEY (server_id, tag)
+);
+
+CREATE TABLE IF NOT EXISTS server_inventory (
+    server_id TEXT NOT NULL,
+    tag TEXT NOT NULL DEFAULT '',
+    inventory JSONB NOT NULL,
+    updated_at TIMESTAMPTZ DEFAULT now(),
+    PRIMARY KEY (server_id, tag)
+);
+
+CREATE TABLE IF NOT EXISTS agent_heartbeats (
+    server_id TEXT NOT NULL,
+    tag TEXT NOT NULL DEFAULT '',
+    last_seen TIMESTAMPTZ NOT NULL,
+    interval_ms BIGINT NOT NULL DEFAULT 0,
+    uptime_seconds BIGINT NOT NULL DEFAULT 0,
+    agent_version TEXT NOT NULL DEFAULT '',
+    remote_addr TEXT NOT NULL DEFAULT '',
+    PRIMARY KEY (server_id, tag)
+);
+
+CREATE TABLE IF NOT EXISTS diagnostics (
+    id BIGSERIAL PRIMARY KEY,
+    server_id TEXT NOT NULL,
+    tag TEXT NOT NULL DEFAULT '',
+    command TEXT NOT NULL,
+    status TEXT NOT NULL,
+    requested_by TEXT NOT NULL DEFAULT '',
+    requested_at TIMESTAMPTZ DEFAULT now(),
+    finished_at TIMESTAMPTZ,
+    exit_code INTEGER,
+    error TEXT NOT NULL DEFAULT '',
+    truncated BOOLEAN NOT NULL DEFAULT false,
+    output TEXT NOT NULL DEFAULT ''
+);
+CREATE INDEX IF NOT EXISTS diagnostics_server_idx ON diagnostics (server_id, tag, status);
+
+CREATE TABLE IF NOT EXISTS diagnostic_audit (
+    id BIGSERIAL PRIMARY KEY,
+    diagnostic_id BIGINT NOT NULL,
+    event TEXT NOT NULL,
+    actor TEXT NOT NULL DEFAULT '',
+    details TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMPTZ DEFAULT now()
+);
+
+CREATE TABLE IF NOT EXISTS samples (
+    id BIGSERIAL PRIMARY KEY,
+    server_id TEXT NOT NULL,
+    tag TEXT NOT NULL DEFAULT '',
+    name TEXT NOT NULL,
+    labels JSONB NOT NULL DEFAULT '{}',
+    value DOUBLE PRECISION NOT NULL,
+    type TEXT NOT NULL DEFAULT 'gauge',
+    unit TEXT NOT NULL DEFAULT '',
+    ts TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+CREATE INDEX IF NOT EXISTS samples_series_idx ON samples (server_id, tag, name, ts);
+CREATE INDEX IF NOT EXISTS samples_labels_idx ON samples USING GIN (labels);
+
+CREATE TABLE IF NOT EXISTS servers (
+    server_id TEXT NOT NULL,
+    tag TEXT NOT NULL DEFAULT '',
+    labels JSONB NOT NULL DEFAULT '{}',
+    first_seen TIMESTAMPTZ NOT NULL DEFAULT now(),
+    last_seen TIMESTAMPTZ NOT NULL DEFAULT now(),
+    PRIMARY KEY (server_id, tag)
+);
+CREATE INDEX IF NOT EXISTS servers_labels_idx ON servers USING GIN (labels);
+
+CREATE TABLE IF NOT EXISTS server_events (
+    id BIGSERIAL PRIMARY KEY,
+    server_id TEXT NOT NULL,
+    tag TEXT NOT NULL DEFAULT '',
+    from_state TEXT NOT NULL DEFAULT '',
+    to_state TEXT NOT NULL,
+    last_seen TIMESTAMPTZ,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+CREATE INDEX IF NOT EXISTS server_events_server_idx ON server_events (server_id, tag, created_at);
+
+CREATE TABLE IF NOT EXISTS alert_rules (
+    name TEXT PRIMARY KEY,
+    expr TEXT NOT NULL,
+    severity TEXT NOT NULL DEFAULT 'warning',
+    labels JSONB NOT NULL DEFAULT '{}',
+    annotations JSONB NOT NULL DEFAULT '{}',
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+ALTER TABLE alert_rules ADD COLUMN IF NOT EXISTS channels JSONB NOT NULL DEFAULT '[]';
+
+CREATE TABLE IF NOT EXISTS alerts (
+    id BIGSERIAL PRIMARY KEY,
+    fingerprint TEXT NOT NULL,
+    rule TEXT NOT NULL,
+    severity TEXT NOT NULL,
+    server_id TEXT NOT NULL,
+    tag TEXT NOT NULL DEFAULT '',
+    metric TEXT NOT NULL,
+    labels JSONB NOT NULL DEFAULT '{}',
+    annotations JSONB NOT NULL DEFAULT '{}',
+    state TEXT NOT NULL,
+    value DOUBLE PRECISION NOT NULL,
+    started_at TIMESTAMPTZ NOT NULL,
+    fired_at TIMESTAMPTZ,
+    resolved_at TIMESTAMPTZ,
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    UNIQUE (fingerprint, started_at)
+);
+CREATE INDEX IF NOT EXISTS alerts_state_idx ON alerts (state, updated_at);
+
+CREATE TABLE IF NOT EXISTS silences (
+    id BIGSERIAL PRIMARY KEY,
+    server_id TEXT NOT NULL DEFAULT '',
+    tag TEXT NOT NULL DEFAULT '',
+    labels JSONB NOT NULL DEFAULT '{}',
+    comment TEXT NOT NULL DEFAULT '',
+    created_by TEXT NOT NULL DEFAULT '',
+    starts_at TIMESTAMPTZ NOT NULL,
+    ends_at TIMESTAMPTZ NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+CREATE INDEX IF NOT EXISTS silences_ends_idx ON silences (ends_at);
+
+CREATE TABLE IF NOT EXISTS maintenance_windows (
+    name TEXT PRIMARY KEY,
+    schedule TEXT NOT NULL,
+    duration TEXT NOT NULL,
+    timezone TEXT NOT NULL DEFAULT '',
+    server_id TEXT NOT NULL DEFAULT '',
+    tag TEXT NOT NULL DEFAULT '',
+    labels JSONB NOT NULL DEFAULT '{}',
+    comment TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE TABLE IF NOT EXISTS anomaly_scores (
+    id BIGSERIAL PRIMARY KEY,
+    server_id TEXT NOT NULL,
+    tag TEXT NOT NULL DEFAULT '',
+    metric TEXT NOT NULL,
+    labels JSONB NOT NULL DEFAULT '{}',
+    value DOUBLE PRECISION NOT NULL,
+    expected DOUBLE PRECISION NOT NULL,
+    stddev DOUBLE PRECISION NOT NULL,
+    score DOUBLE PRECISION NOT NULL,
+    anomalous BOOLEAN NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL
+);
+CREATE INDEX IF NOT EXISTS anomaly_scores_server_idx ON anomaly_scores (server_id, tag, created_at);
+
+CREATE TABLE IF NOT EXISTS anomaly_baselines (
+    key TEXT PRIMARY KEY,
+    server_id TEXT NOT NULL,
+    tag TEXT NOT NULL DEFAULT '',
+    metric TEXT NOT NULL,
+    labels JSONB NOT NULL DEFAULT '{}',
+    state JSONB NOT NULL,
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
@@ -19,23 +19,51 @@ import (
 const _ = grpc.SupportPackageIsVersion9
 
 const (
-	MetricsService_SendMetrics_FullMethodName   = "/api.MetricsService/SendMetrics"
-	MetricsService_StreamMetrics_FullMethodName = "/api.MetricsService/StreamMetrics"
-	MetricsService_ListMetrics_FullMethodName   = "/api.MetricsService/ListMetrics"
+	MetricsService_SendMetrics_FullMethodName      = "/api.MetricsService/SendMetrics"
+	MetricsService_StreamMetrics_FullMethodName    = "/api.MetricsService/StreamMetrics"
+	MetricsService_ListMetrics_FullMethodName      = "/api.MetricsService/ListMetrics"
+	MetricsService_Heartbeat_FullMethodName        = "/api.MetricsService/Heartbeat"
+	MetricsService_WatchDiagnostics_FullMethodName = "/api.MetricsService/WatchDiagnostics"
+	MetricsService_ReportDiagnostic_FullMethodName = "/api.MetricsService/ReportDiagnostic"
+	MetricsService_ListSamples_FullMethodName      = "/api.MetricsService/ListSamples"
+	MetricsService_QueryRange_FullMethodName       = "/api.MetricsService/QueryRange"
+	MetricsService_ListServers_FullMethodName      = "/api.MetricsService/ListServers"
+	MetricsService_GetServer_FullMethodName        = "/api.MetricsService/GetServer"
+	MetricsService_DeleteServer_FullMethodName     = "/api.MetricsService/DeleteServer"
+	MetricsService_GetFleetSnapshot_FullMethodName = "/api.MetricsService/GetFleetSnapshot"
 )
 
 // MetricsServiceClient is the client API for MetricsService service.
 //
 // For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
 //
-// Сервис с отправкой/получением метрик
+// Сервис с отправкой/получением метрик.
+// Устаревший API: новые клиенты используют gohub.metrics.v1 (proto/gohub/metrics/v1/metrics.proto),
+// номера полей в обоих пакетах совпадают.
 type MetricsServiceClient interface {
 	// 1) Отправка метрик
 	SendMetrics(ctx context.Context, in *MetricsRequest, opts ...grpc.CallOption) (*MetricsResponse, error)
-	// 2) Потоковый пример (заглушка)
-	StreamMetrics(ctx context.Context, in *StreamRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[MetricsResponse], error)
+	// 2) Поток измерений по мере приёма (с фильтрами и догрузкой истории)
+	StreamMetrics(ctx context.Context, in *StreamRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[StoredSample], error)
 	// 3) Получение метрик (новый метод)
 	ListMetrics(ctx context.Context, in *ListMetricsRequest, opts ...grpc.CallOption) (*ListMetricsResponse, error)
+	// 4) Heartbeat агента, независимый от сбора метрик
+	Heartbeat(ctx context.Context, in *HeartbeatRequest, opts ...grpc.CallOption) (*HeartbeatResponse, error)
+	// 5) Диагностика: агент подписывается на запросы выполнения команд
+	WatchDiagnostics(ctx context.Context, in *WatchDiagnosticsRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[DiagnosticRequest], error)
+	// 6) Агент передаёт вывод диагностической команды частями
+	ReportDiagnostic(ctx context.Context, opts ...grpc.CallOption) (grpc.ClientStreamingClient[DiagnosticOutput, DiagnosticAck], error)
+	// 7) Получение произвольных сэмплов
+	ListSamples(ctx context.Context, in *ListSamplesRequest, opts ...grpc.CallOption) (*ListSamplesResponse, error)
+	// 8) Агрегированные ряды за диапазон времени с заданным шагом
+	QueryRange(ctx context.Context, in *QueryRangeRequest, opts ...grpc.CallOption) (*QueryRangeResponse, error)
+	// 9) Реестр серверов
+	ListServers(ctx context.Context, in *ListServersRequest, opts ...grpc.CallOption) (*ListServersResponse, error)
+	GetServer(ctx context.Context, in *GetServerRequest, opts ...grpc.CallOption) (*ServerInfo, error)
+	// Вывод сервера из эксплуатации
+	DeleteServer(ctx context.Context, in *DeleteServerRequest, opts ...grpc.CallOption) (*DeleteServerResponse, error)
+	// 10) Последние значения всех серверов из кеша сервера, без запросов к БД
+	GetFleetSnapshot(ctx context.Context, in *FleetSnapshotRequest, opts ...grpc.CallOption) (*FleetSnapshot, error)
 }
 
 type metricsServiceClient struct {
@@ -56,13 +84,13 @@ func (c *metricsServiceClient) SendMetrics(ctx context.Context, in *MetricsReque
 	return out, nil
 }
 
-func (c *metricsServiceClient) StreamMetrics(ctx context.Context, in *StreamRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[MetricsResponse], error) {
+func (c *metricsServiceClient) StreamMetrics(ctx context.Context, in *StreamRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[StoredSample], error) {
 	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
 	stream, err := c.cc.NewStream(ctx, &MetricsService_ServiceDesc.Streams[0], MetricsService_StreamMetrics_FullMethodName, cOpts...)
 	if err != nil {
 		return nil, err
 	}
-	x := &grpc.GenericClientStream[StreamRequest, MetricsResponse]{ClientStream: stream}
+	x := &grpc.GenericClientStream[StreamRequest, StoredSample]{ClientStream: stream}
 	if err := x.ClientStream.SendMsg(in); err != nil {
 		return nil, err
 	}
@@ -73,7 +101,7 @@ func (c *metricsServiceClient) StreamMetrics(ctx context.Context, in *StreamRequ
 }
 
 // This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
-type MetricsService_StreamMetricsClient = grpc.ServerStreamingClient[MetricsResponse]
+type MetricsService_StreamMetricsClient = grpc.ServerStreamingClient[StoredSample]
 
 func (c *metricsServiceClient) ListMetrics(ctx context.Context, in *ListMetricsRequest, opts ...grpc.CallOption) (*ListMetricsResponse, error) {
 	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
@@ -85,18 +113,139 @@ func (c *metricsServiceClient) ListMetrics(ctx context.Context, in *ListMetricsR
 	return out, nil
 }
 
+func (c *metricsServiceClient) Heartbeat(ctx context.Context, in *HeartbeatRequest, opts ...grpc.CallOption) (*HeartbeatResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(HeartbeatResponse)
+	err := c.cc.Invoke(ctx, MetricsService_Heartbeat_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *metricsServiceClient) WatchDiagnostics(ctx context.Context, in *WatchDiagnosticsRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[DiagnosticRequest], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &MetricsService_ServiceDesc.Streams[1], MetricsService_WatchDiagnostics_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[WatchDiagnosticsRequest, DiagnosticRequest]{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type MetricsService_WatchDiagnosticsClient = grpc.ServerStreamingClient[DiagnosticRequest]
+
+func (c *metricsServiceClient) ReportDiagnostic(ctx context.Context, opts ...grpc.CallOption) (grpc.ClientStreamingClient[DiagnosticOutput, DiagnosticAck], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &MetricsService_ServiceDesc.Streams[2], MetricsService_ReportDiagnostic_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[DiagnosticOutput, DiagnosticAck]{ClientStream: stream}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type MetricsService_ReportDiagnosticClient = grpc.ClientStreamingClient[DiagnosticOutput, DiagnosticAck]
+
+func (c *metricsServiceClient) ListSamples(ctx context.Context, in *ListSamplesRequest, opts ...grpc.CallOption) (*ListSamplesResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ListSamplesResponse)
+	err := c.cc.Invoke(ctx, MetricsService_ListSamples_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *metricsServiceClient) QueryRange(ctx context.Context, in *QueryRangeRequest, opts ...grpc.CallOption) (*QueryRangeResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(QueryRangeResponse)
+	err := c.cc.Invoke(ctx, MetricsService_QueryRange_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *metricsServiceClient) ListServers(ctx context.Context, in *ListServersRequest, opts ...grpc.CallOption) (*ListServersResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ListServersResponse)
+	err := c.cc.Invoke(ctx, MetricsService_ListServers_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *metricsServiceClient) GetServer(ctx context.Context, in *GetServerRequest, opts ...grpc.CallOption) (*ServerInfo, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ServerInfo)
+	err := c.cc.Invoke(ctx, MetricsService_GetServer_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *metricsServiceClient) DeleteServer(ctx context.Context, in *DeleteServerRequest, opts ...grpc.CallOption) (*DeleteServerResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(DeleteServerResponse)
+	err := c.cc.Invoke(ctx, MetricsService_DeleteServer_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *metricsServiceClient) GetFleetSnapshot(ctx context.Context, in *FleetSnapshotRequest, opts ...grpc.CallOption) (*FleetSnapshot, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(FleetSnapshot)
+	err := c.cc.Invoke(ctx, MetricsService_GetFleetSnapshot_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 // MetricsServiceServer is the server API for MetricsService service.
 // All implementations must embed UnimplementedMetricsServiceServer
 // for forward compatibility.
 //
-// Сервис с отправкой/получением метрик
+// Сервис с отправкой/получением метрик.
+// Устаревший API: новые клиенты используют gohub.metrics.v1 (proto/gohub/metrics/v1/metrics.proto),
+// номера полей в обоих пакетах совпадают.
 type MetricsServiceServer interface {
 	// 1) Отправка метрик
 	SendMetrics(context.Context, *MetricsRequest) (*MetricsResponse, error)
-	// 2) Потоковый пример (заглушка)
-	StreamMetrics(*StreamRequest, grpc.ServerStreamingServer[MetricsResponse]) error
+	// 2) Поток измерений по мере приёма (с фильтрами и догрузкой истории)
+	StreamMetrics(*StreamRequest, grpc.ServerStreamingServer[StoredSample]) error
 	// 3) Получение метрик (новый метод)
 	ListMetrics(context.Context, *ListMetricsRequest) (*ListMetricsResponse, error)
+	// 4) Heartbeat агента, независимый от сбора метрик
+	Heartbeat(context.Context, *HeartbeatRequest) (*HeartbeatResponse, error)
+	// 5) Диагностика: агент подписывается на запросы выполнения команд
+	WatchDiagnostics(*WatchDiagnosticsRequest, grpc.ServerStreamingServer[DiagnosticRequest]) error
+	// 6) Агент передаёт вывод диагностической команды частями
+	ReportDiagnostic(grpc.ClientStreamingServer[DiagnosticOutput, DiagnosticAck]) error
+	// 7) Получение произвольных сэмплов
+	ListSamples(context.Context, *ListSamplesRequest) (*ListSamplesResponse, error)
+	// 8) Агрегированные ряды за диапазон времени с заданным шагом
+	QueryRange(context.Context, *QueryRangeRequest) (*QueryRangeResponse, error)
+	// 9) Реестр серверов
+	ListServers(context.Context, *ListServersRequest) (*ListServersResponse, error)
+	GetServer(context.Context, *GetServerRequest) (*ServerInfo, error)
+	// Вывод сервера из эксплуатации
+	DeleteServer(context.Context, *DeleteServerRequest) (*DeleteServerResponse, error)
+	// 10) Последние значения всех серверов из кеша сервера, без запросов к БД
+	GetFleetSnapshot(context.Context, *FleetSnapshotRequest) (*FleetSnapshot, error)
 	mustEmbedUnimplementedMetricsServiceServer()
 }
 
@@ -110,12 +259,39 @@ type UnimplementedMetricsServiceServer struct{}
 func (UnimplementedMetricsServiceServer) SendMetrics(context.Context, *MetricsRequest) (*MetricsResponse, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method SendMetrics not implemented")
 }
-func (UnimplementedMetricsServiceServer) StreamMetrics(*StreamRequest, grpc.ServerStreamingServer[MetricsResponse]) error {
+func (UnimplementedMetricsServiceServer) StreamMetrics(*StreamRequest, grpc.ServerStreamingServer[StoredSample]) error {
 	return status.Errorf(codes.Unimplemented, "method StreamMetrics not implemented")
 }
 func (UnimplementedMetricsServiceServer) ListMetrics(context.Context, *ListMetricsRequest) (*ListMetricsResponse, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method ListMetrics not implemented")
 }
+func (UnimplementedMetricsServiceServer) Heartbeat(context.Context, *HeartbeatRequest) (*HeartbeatResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Heartbeat not implemented")
+}
+func (UnimplementedMetricsServiceServer) WatchDiagnostics(*WatchDiagnosticsRequest, grpc.ServerStreamingServer[DiagnosticRequest]) error {
+	return status.Errorf(codes.Unimplemented, "method WatchDiagnostics not implemented")
+}
+func (UnimplementedMetricsServiceServer) ReportDiagnostic(grpc.ClientStreamingServer[DiagnosticOutput, DiagnosticAck]) error {
+	return status.Errorf(codes.Unimplemented, "method ReportDiagnostic not implemented")
+}
+func (UnimplementedMetricsServiceServer) ListSamples(context.Context, *ListSamplesRequest) (*ListSamplesResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListSamples not implemented")
+}
+func (UnimplementedMetricsServiceServer) QueryRange(context.Context, *QueryRangeRequest) (*QueryRangeResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method QueryRange not implemented")
+}
+func (UnimplementedMetricsServiceServer) ListServers(context.Context, *ListServersRequest) (*ListServersResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListServers not implemented")
+}
+func (UnimplementedMetricsServiceServer) GetServer(context.Context, *GetServerRequest) (*ServerInfo, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetServer not implemented")
+}
+func (UnimplementedMetricsServiceServer) DeleteServer(context.Context, *DeleteServerRequest) (*DeleteServerResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method DeleteServer not implemented")
+}
+func (UnimplementedMetricsServiceServer) GetFleetSnapshot(context.Context, *FleetSnapshotRequest) (*FleetSnapshot, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetFleetSnapshot not implemented")
+}
 func (UnimplementedMetricsServiceServer) mustEmbedUnimplementedMetricsServiceServer() {}
 func (UnimplementedMetricsServiceServer) testEmbeddedByValue()                        {}
 
@@ -160,11 +336,11 @@ func _MetricsService_StreamMetrics_Handler(srv interface{}, stream grpc.ServerSt
 	if err := stream.RecvMsg(m); err != nil {
 		return err
 	}
-	return srv.(MetricsServiceServer).StreamMetrics(m, &grpc.GenericServerStream[StreamRequest, MetricsResponse]{ServerStream: stream})
+	return srv.(MetricsServiceServer).StreamMetrics(m, &grpc.GenericServerStream[StreamRequest, StoredSample]{ServerStream: stream})
 }
 
 // This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
-type MetricsService_StreamMetricsServer = grpc.ServerStreamingServer[MetricsResponse]
+type MetricsService_StreamMetricsServer = grpc.ServerStreamingServer[StoredSample]
 
 func _MetricsService_ListMetrics_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
 	in := new(ListMetricsRequest)
@@ -184,6 +360,150 @@ func _MetricsService_ListMetrics_Handler(srv interface{}, ctx context.Context, d
 	return interceptor(ctx, in, info, handler)
 }
 
+func _MetricsService_Heartbeat_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(HeartbeatRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(MetricsServiceServer).Heartbeat(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: MetricsService_Heartbeat_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(MetricsServiceServer).Heartbeat(ctx, req.(*HeartbeatRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _MetricsService_WatchDiagnostics_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(WatchDiagnosticsRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(MetricsServiceServer).WatchDiagnostics(m, &grpc.GenericServerStream[WatchDiagnosticsRequest, DiagnosticRequest]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type MetricsService_WatchDiagnosticsServer = grpc.ServerStreamingServer[DiagnosticRequest]
+
+func _MetricsService_ReportDiagnostic_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(MetricsServiceServer).ReportDiagnostic(&grpc.GenericServerStream[DiagnosticOutput, DiagnosticAck]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type MetricsService_ReportDiagnosticServer = grpc.ClientStreamingServer[DiagnosticOutput, DiagnosticAck]
+
+func _MetricsService_ListSamples_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListSamplesRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(MetricsServiceServer).ListSamples(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: MetricsService_ListSamples_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(MetricsServiceServer).ListSamples(ctx, req.(*ListSamplesRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _MetricsService_QueryRange_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(QueryRangeRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(MetricsServiceServer).QueryRange(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: MetricsService_QueryRange_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(MetricsServiceServer).QueryRange(ctx, req.(*QueryRangeRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _MetricsService_ListServers_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListServersRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(MetricsServiceServer).ListServers(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: MetricsService_ListServers_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(MetricsServiceServer).ListServers(ctx, req.(*ListServersRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _MetricsService_GetServer_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetServerRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(MetricsServiceServer).GetServer(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: MetricsService_GetServer_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(MetricsServiceServer).GetServer(ctx, req.(*GetServerRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _MetricsService_DeleteServer_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(DeleteServerRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(MetricsServiceServer).DeleteServer(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: MetricsService_DeleteServer_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(MetricsServiceServer).DeleteServer(ctx, req.(*DeleteServerRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _MetricsService_GetFleetSnapshot_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(FleetSnapshotRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(MetricsServiceServer).GetFleetSnapshot(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: MetricsService_GetFleetSnapshot_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(MetricsServiceServer).GetFleetSnapshot(ctx, req.(*FleetSnapshotRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
 // MetricsService_ServiceDesc is the grpc.ServiceDesc for MetricsService service.
 // It's only intended for direct use with grpc.RegisterService,
 // and not to be introspected or modified (even as a copy)
@@ -199,6 +519,34 @@ var MetricsService_ServiceDesc = grpc.ServiceDesc{
 			MethodName: "ListMetrics",
 			Handler:    _MetricsService_ListMetrics_Handler,
 		},
+		{
+			MethodName: "Heartbeat",
+			Handler:    _MetricsService_Heartbeat_Handler,
+		},
+		{
+			MethodName: "ListSamples",
+			Handler:    _MetricsService_ListSamples_Handler,
+		},
+		{
+			MethodName: "QueryRange",
+			Handler:    _MetricsService_QueryRange_Handler,
+		},
+		{
+			MethodName: "ListServers",
+			Handler:    _MetricsService_ListServers_Handler,
+		},
+		{
+			MethodName: "GetServer",
+			Handler:    _MetricsService_GetServer_Handler,
+		},
+		{
+			MethodName: "DeleteServer",
+			Handler:    _MetricsService_DeleteServer_Handler,
+		},
+		{
+			MethodName: "GetFleetSnapshot",
+			Handler:    _MetricsService_GetFleetSnapshot_Handler,
+		},
 	},
 	Streams: []grpc.StreamDesc{
 		{
@@ -206,6 +554,16 @@ var MetricsService_ServiceDesc = grpc.ServiceDesc{
 			Handler:       _MetricsService_StreamMetrics_Handler,
 			ServerStreams: true,
 		},
+		{
+			StreamName:    "WatchDiagnostics",
+			Handler:       _MetricsService_WatchDiagnostics_Handler,
+			ServerStreams: true,
+		},
+		{
+			StreamName:    "ReportDiagnostic",
+			Handler:       _MetricsService_ReportDiagnostic_Handler,
+			ClientStreams: true,
+		},
 	},
 	Metadata: "internal/api/metrics.proto",
 }
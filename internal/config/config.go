@@ -3,6 +3,7 @@ package config
 import (
 	"fmt"
 	"strings"
+	"time"
 
 	"github.com/spf13/viper"
 )
@@ -21,11 +22,222 @@ type DatabaseConfig struct {
 	Password string `mapstructure:"password"`
 	DBName   string `mapstructure:"dbname"`
 	SSLMode  string `mapstructure:"sslmode"`
+
+	// Сколько хранить metrics и samples; 0 — 72h или самое длинное окно прогноза, если оно больше
+	Retention time.Duration `mapstructure:"retention"`
+}
+
+// AgentsConfig — указания, которые сервер раздаёт агентам в ответ на SendMetrics
+type AgentsConfig struct {
+	// Интервал отправки для всего парка (мс), 0 — агенты используют свой
+	SendIntervalMs int64 `mapstructure:"send_interval_ms"`
+	// Сколько одновременных SendMetrics считается перегрузкой (агентам отвечаем slow_down), 0 — без ограничения
+	MaxInflight int64 `mapstructure:"max_inflight"`
+	// Допустимое расхождение часов агента с сервером; при превышении агент помечается,
+	// а время измерений берётся по часам сервера. 0 — не проверять
+	MaxClockSkew time.Duration `mapstructure:"max_clock_skew"`
+}
+
+// ValidationConfig — ограничения на входящие данные агентов
+type ValidationConfig struct {
+	// Максимальная длина server_id и tag
+	MaxServerIDLength int `mapstructure:"max_server_id_length"`
+	MaxTagLength      int `mapstructure:"max_tag_length"`
+	// Регулярное выражение допустимых символов server_id и tag
+	IDCharset string `mapstructure:"id_charset"`
+	// Максимальная длина значения лейбла
+	MaxLabelValueLength int `mapstructure:"max_label_value_length"`
+	// Максимальное число сэмплов в одном запросе
+	MaxSamples int `mapstructure:"max_samples"`
+	// Проценты больше 100 урезать до 100 (false — отклонять запрос)
+	ClampPercent bool `mapstructure:"clamp_percent"`
+}
+
+// IngestConfig — очередь приёма измерений: запросы агентов подтверждаются сразу,
+// а запись в БД идёт пачками в фоне
+type IngestConfig struct {
+	// Ёмкость очереди в запросах агентов
+	QueueSize int `mapstructure:"queue_size"`
+	// Число горутин, пишущих в БД
+	Workers int `mapstructure:"workers"`
+	// Строк в одной пачке COPY
+	BatchSize int `mapstructure:"batch_size"`
+	// Как долго копить неполную пачку
+	FlushInterval time.Duration `mapstructure:"flush_interval"`
+	// Повторы записи пачки при ошибке БД, затем пачка теряется
+	MaxRetries int `mapstructure:"max_retries"`
+	// Первая пауза перед повтором; каждая следующая вдвое дольше, но не больше MaxRetryBackoff
+	RetryBackoff    time.Duration `mapstructure:"retry_backoff"`
+	MaxRetryBackoff time.Duration `mapstructure:"max_retry_backoff"`
+	// Что делать при полной очереди: block, drop_oldest или reject
+	FullPolicy string `mapstructure:"full_policy"`
+}
+
+// MonitorConfig — отслеживание online/stale/offline по давности последних данных агента
+type MonitorConfig struct {
+	// Как часто проверять серверы
+	CheckInterval time.Duration `mapstructure:"check_interval"`
+	// Ожидаемый интервал отправки, если агент не сообщил свой в heartbeat
+	DefaultInterval time.Duration `mapstructure:"default_interval"`
+	// Сколько интервалов без данных до stale и до offline
+	StaleAfter   int `mapstructure:"stale_after"`
+	OfflineAfter int `mapstructure:"offline_after"`
+}
+
+// AlertsConfig — правила оповещений
+type AlertsConfig struct {
+	// YAML-файл с правилами (необязательно); такие правила нельзя менять через API
+	RulesFile string `mapstructure:"rules_file"`
+	// Как часто проверять длительность условий (for) и обновлять gohub_alerts
+	EvalInterval time.Duration `mapstructure:"eval_interval"`
+}
+
+// AnomalyConfig — поиск аномалий по скользящим базовым линиям рядов
+type AnomalyConfig struct {
+	Enabled bool `mapstructure:"enabled"`
+	// Какие метрики отслеживать (по умолчанию cpu_usage, memory_usage, disk_usage, network_usage)
+	Metrics []string `mapstructure:"metrics"`
+	// Вес нового значения в EWMA (0..1): больше — базовая линия быстрее забывает прошлое
+	Alpha float64 `mapstructure:"alpha"`
+	// Отклонение больше Sigma стандартных отклонений считается аномалией
+	Sigma float64 `mapstructure:"sigma"`
+	// Сколько значений нужно базовой линии (и каждому часу недели), прежде чем ей доверять
+	MinSamples int `mapstructure:"min_samples"`
+	// Учитывать сезонность по часу недели
+	Seasonal bool `mapstructure:"seasonal"`
+	// Вес новой недели в базовой линии часа недели: час недели обновляется раз в неделю средним за этот час
+	SeasonalAlpha float64 `mapstructure:"seasonal_alpha"`
+	// Сколько недель нужно часу недели, прежде чем ему доверять
+	SeasonalMinWeeks int `mapstructure:"seasonal_min_weeks"`
+	// Часовой пояс для часа недели (IANA), пусто — UTC
+	Timezone string `mapstructure:"timezone"`
+	// Сохранять в anomaly_scores все оценки, а не только аномалии
+	StoreAll bool `mapstructure:"store_all"`
+	// Как часто сохранять базовые линии в БД
+	SaveInterval time.Duration `mapstructure:"save_interval"`
+	// Ёмкость очереди оценок на запись
+	QueueSize int `mapstructure:"queue_size"`
+}
+
+// ForecastConfig — прогноз заполнения по линейному тренду истории metrics
+type ForecastConfig struct {
+	Enabled bool `mapstructure:"enabled"`
+	// Какие поля metrics прогнозировать, в процентах (по умолчанию disk_usage, memory_usage)
+	Metrics []string `mapstructure:"metrics"`
+	// Окна истории, по которым строится тренд (по умолчанию 24h и 168h)
+	Windows []time.Duration `mapstructure:"windows"`
+	// Как часто пересчитывать прогноз
+	Interval time.Duration `mapstructure:"interval"`
+	// Сколько точек нужно в окне, чтобы прогнозу доверять
+	MinPoints int `mapstructure:"min_points"`
+	// Дальше этого срока прогноз не выдаётся: рост считается несущественным
+	Horizon time.Duration `mapstructure:"horizon"`
+}
+
+// NotifyConfig — каналы уведомлений об оповещениях и маршрутизация по ним
+type NotifyConfig struct {
+	Channels []NotifyChannelConfig `mapstructure:"channels"`
+	// Маршруты для правил без своего списка каналов; срабатывают все подходящие
+	Routes []NotifyRouteConfig `mapstructure:"routes"`
+}
+
+// NotifyChannelConfig — канал уведомлений: webhook, email, slack или telegram
+type NotifyChannelConfig struct {
+	Name string `mapstructure:"name"`
+	Type string `mapstructure:"type"`
+
+	// webhook и slack — адрес запроса, telegram — адрес Bot API (по умолчанию https://api.telegram.org)
+	URL string `mapstructure:"url"`
+	// Дополнительные заголовки запроса webhook
+	Headers map[string]string `mapstructure:"headers"`
+
+	// telegram
+	BotToken string `mapstructure:"bot_token"`
+	ChatID   string `mapstructure:"chat_id"`
+
+	// email: SMTP-сервер "host:port", отправитель и получатели
+	SMTPAddr string   `mapstructure:"smtp_addr"`
+	Username string   `mapstructure:"username"`
+	Password string   `mapstructure:"password"`
+	From     string   `mapstructure:"from"`
+	To       []string `mapstructure:"to"`
+	// Сразу TLS (порт 465); иначе STARTTLS, если сервер его предлагает
+	TLS                bool `mapstructure:"tls"`
+	InsecureSkipVerify bool `mapstructure:"insecure_skip_verify"`
+
+	// Шаблоны text/template заголовка (тема письма) и текста сообщения
+	Title    string `mapstructure:"title"`
+	Template string `mapstructure:"template"`
+	// Уведомлять о закрытии оповещения
+	SendResolved bool `mapstructure:"send_resolved"`
+
+	// Таймаут одной попытки отправки
+	Timeout time.Duration `mapstructure:"timeout"`
+	// Повторы при ошибке; первая пауза RetryBackoff, каждая следующая вдвое дольше, но не больше MaxRetryBackoff
+	MaxRetries      int           `mapstructure:"max_retries"`
+	RetryBackoff    time.Duration `mapstructure:"retry_backoff"`
+	MaxRetryBackoff time.Duration `mapstructure:"max_retry_backoff"`
+	// Не больше RateLimit сообщений за RatePeriod (0 — без ограничения); лишние ждут в очереди
+	RateLimit  int           `mapstructure:"rate_limit"`
+	RatePeriod time.Duration `mapstructure:"rate_period"`
+	// Ёмкость очереди канала; при переполнении уведомления теряются
+	QueueSize int `mapstructure:"queue_size"`
+}
+
+// NotifyRouteConfig — маршрут: уведомления, подходящие под Match, уходят в Channels.
+// Ключи Match: rule, severity, state, server_id, tag, остальные — лейблы оповещения.
+// Пустой Match подходит всем уведомлениям.
+type NotifyRouteConfig struct {
+	Match    map[string]string `mapstructure:"match"`
+	Channels []string          `mapstructure:"channels"`
+}
+
+// GRPCListenerConfig — порт агентов (gRPC)
+type GRPCListenerConfig struct {
+	// "host:port" или "unix:/path/to.sock"
+	Addr string `mapstructure:"addr"`
+	// Сколько ждать установления соединения (TLS/HTTP2 handshake)
+	ConnectionTimeout time.Duration `mapstructure:"connection_timeout"`
+	// Закрывать соединения без вызовов дольше этого времени (0 — не закрывать)
+	MaxConnectionIdle time.Duration `mapstructure:"max_connection_idle"`
+}
+
+// HTTPListenerConfig — HTTP-порт (API, WebSocket, статика или метрики Prometheus)
+type HTTPListenerConfig struct {
+	// "host:port" или "unix:/path/to.sock"
+	Addr              string        `mapstructure:"addr"`
+	ReadHeaderTimeout time.Duration `mapstructure:"read_header_timeout"`
+	ReadTimeout       time.Duration `mapstructure:"read_timeout"`
+	// 0 — без ограничения (нужно для WebSocket и потоков gRPC-Web)
+	WriteTimeout time.Duration `mapstructure:"write_timeout"`
+	IdleTimeout  time.Duration `mapstructure:"idle_timeout"`
+}
+
+// ServerConfig — параметры запуска сервера
+type ServerConfig struct {
+	GRPC    GRPCListenerConfig `mapstructure:"grpc"`
+	HTTP    HTTPListenerConfig `mapstructure:"http"`
+	Metrics HTTPListenerConfig `mapstructure:"metrics"`
+	// Каталог статики веб-интерфейса
+	StaticDir string `mapstructure:"static_dir"`
+	// Обслуживать gRPC на HTTP-порту (h2c), отдельный gRPC-порт не открывается
+	SinglePort bool `mapstructure:"single_port"`
+	// Сколько ждать завершения начатых запросов при остановке
+	ShutdownTimeout time.Duration `mapstructure:"shutdown_timeout"`
 }
 
 type Config struct {
-	App      AppConfig      `mapstructure:"app"`
-	Database DatabaseConfig `mapstructure:"database"`
+	App        AppConfig        `mapstructure:"app"`
+	Server     ServerConfig     `mapstructure:"server"`
+	Database   DatabaseConfig   `mapstructure:"database"`
+	Agents     AgentsConfig     `mapstructure:"agents"`
+	Validation ValidationConfig `mapstructure:"validation"`
+	Ingest     IngestConfig     `mapstructure:"ingest"`
+	Monitor    MonitorConfig    `mapstructure:"monitor"`
+	Alerts     AlertsConfig     `mapstructure:"alerts"`
+	Notify     NotifyConfig     `mapstructure:"notify"`
+	Anomaly    AnomalyConfig    `mapstructure:"anomaly"`
+	Forecast   ForecastConfig   `mapstructure:"forecast"`
 }
 
 // LoadConfig читает config.yaml, переменные окружения и формирует Config
@@ -40,6 +252,26 @@ func LoadConfig(path string) (*Config, error) {
 	viper.SetEnvKeyReplacer(strings.NewReplacer(".", "__"))
 	viper.AutomaticEnv()
 
+	// Значения по умолчанию для старых config.yaml без секции server;
+	// заодно переменные окружения SERVER__* работают и без ключей в файле
+	viper.SetDefault("server.grpc.addr", ":50051")
+	viper.SetDefault("server.grpc.connection_timeout", "10s")
+	viper.SetDefault("server.grpc.max_connection_idle", "0s")
+	viper.SetDefault("server.http.addr", ":8080")
+	viper.SetDefault("server.http.read_header_timeout", "10s")
+	viper.SetDefault("server.http.read_timeout", "0s")
+	viper.SetDefault("server.http.write_timeout", "0s")
+	viper.SetDefault("server.http.idle_timeout", "120s")
+	viper.SetDefault("server.metrics.addr", ":2112")
+	viper.SetDefault("server.metrics.read_header_timeout", "10s")
+	viper.SetDefault("server.metrics.read_timeout", "30s")
+	viper.SetDefault("server.metrics.write_timeout", "30s")
+	viper.SetDefault("server.metrics.idle_timeout", "120s")
+	viper.SetDefault("server.static_dir", "./web")
+	viper.SetDefault("server.single_port", false)
+	viper.SetDefault("server.shutdown_timeout", "30s")
+	viper.SetDefault("database.retention", "0s")
+
 	// читаем config.yaml
 	err := viper.ReadInConfig()
 	if err != nil {
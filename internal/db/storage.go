@@ -3,11 +3,16 @@ package db
 import (
 	"context"
 	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"strings"
 	"time"
 
-	_ "github.com/jackc/pgx/v5/stdlib" // pgx driver
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/stdlib" // pgx driver
 )
 
 // Модель для результата
@@ -20,6 +25,187 @@ type MetricRow struct {
 	DiskUsage    float64
 	NetworkUsage float64
 	CreatedAt    string
+	Labels       map[string]string
+}
+
+// MetricRecord — запись фиксированных метрик для пакетной вставки
+type MetricRecord struct {
+	ServerID     string
+	Tag          string
+	CPUUsage     float64
+	MemoryUsage  float64
+	DiskUsage    float64
+	NetworkUsage float64
+	Labels       map[string]string
+	CreatedAt    time.Time
+}
+
+// ServerEventRow — смена состояния сервера (online/stale/offline)
+type ServerEventRow struct {
+	ID        int64      `json:"id"`
+	ServerID  string     `json:"server_id"`
+	Tag       string     `json:"tag"`
+	FromState string     `json:"from_state"` // пусто — первое состояние
+	ToState   string     `json:"to_state"`
+	LastSeen  *time.Time `json:"last_seen,omitempty"`
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+// AlertRuleRow — правило оповещения
+type AlertRuleRow struct {
+	Name string `json:"name" mapstructure:"name"`
+	// Условие: "cpu_usage > 90 for 5m on tag=prod"
+	Expr        string            `json:"expr" mapstructure:"expr"`
+	Severity    string            `json:"severity" mapstructure:"severity"`
+	Labels      map[string]string `json:"labels,omitempty" mapstructure:"labels"`
+	Annotations map[string]string `json:"annotations,omitempty" mapstructure:"annotations"`
+	// Каналы уведомлений; пусто — по маршрутам notify.routes
+	Channels []string `json:"channels,omitempty" mapstructure:"channels"`
+	// Откуда правило: "api" (таблица alert_rules) или "file" (файл правил, только чтение)
+	Source string `json:"source" mapstructure:"-"`
+}
+
+// AlertRow — оповещение по ряду: pending, firing или resolved
+type AlertRow struct {
+	ID int64 `json:"id,omitempty"`
+	// Правило и ряд (server_id, tag, метрика, лейблы), однозначно задающие оповещение
+	Fingerprint string            `json:"fingerprint"`
+	Rule        string            `json:"rule"`
+	Severity    string            `json:"severity"`
+	ServerID    string            `json:"server_id"`
+	Tag         string            `json:"tag"`
+	Metric      string            `json:"metric"`
+	Labels      map[string]string `json:"labels"`
+	Annotations map[string]string `json:"annotations,omitempty"`
+	State       string            `json:"state"`
+	Value       float64           `json:"value"`
+	StartedAt   time.Time         `json:"started_at"`
+	FiredAt     *time.Time        `json:"fired_at,omitempty"`
+	ResolvedAt  *time.Time        `json:"resolved_at,omitempty"`
+	UpdatedAt   time.Time         `json:"updated_at"`
+}
+
+// SilenceRow — заглушка уведомлений до EndsAt; пустые server_id, tag и labels подходят всем
+type SilenceRow struct {
+	ID        int64             `json:"id"`
+	ServerID  string            `json:"server_id"`
+	Tag       string            `json:"tag"`
+	Labels    map[string]string `json:"labels,omitempty"`
+	Comment   string            `json:"comment"`
+	CreatedBy string            `json:"created_by"`
+	StartsAt  time.Time         `json:"starts_at"`
+	EndsAt    time.Time         `json:"ends_at"`
+	CreatedAt time.Time         `json:"created_at"`
+}
+
+// MaintenanceWindowRow — повторяющееся окно обслуживания: начинается по расписанию cron
+// и длится Duration; пустые server_id, tag и labels подходят всем серверам
+type MaintenanceWindowRow struct {
+	Name string `json:"name"`
+	// Расписание начала: "минута час день месяц день_недели", например "0 3 * * 0"
+	Schedule string `json:"schedule"`
+	// Длительность в формате Go: "2h", "90m"
+	Duration string `json:"duration"`
+	// Часовой пояс расписания (IANA), пусто — UTC
+	Timezone  string            `json:"timezone"`
+	ServerID  string            `json:"server_id"`
+	Tag       string            `json:"tag"`
+	Labels    map[string]string `json:"labels,omitempty"`
+	Comment   string            `json:"comment"`
+	CreatedAt time.Time         `json:"created_at"`
+}
+
+// AnomalyScoreRow — оценка отклонения сэмпла от базовой линии ряда
+type AnomalyScoreRow struct {
+	ID       int64             `json:"id,omitempty"`
+	ServerID string            `json:"server_id"`
+	Tag      string            `json:"tag"`
+	Metric   string            `json:"metric"`
+	Labels   map[string]string `json:"labels,omitempty"`
+	Value    float64           `json:"value"`
+	// Ожидаемое значение и стандартное отклонение базовой линии
+	Expected float64 `json:"expected"`
+	StdDev   float64 `json:"stddev"`
+	// (value - expected) / stddev
+	Score     float64   `json:"score"`
+	Anomalous bool      `json:"anomalous"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// AnomalyBaselineRow — сохранённое состояние базовой линии ряда
+type AnomalyBaselineRow struct {
+	Key       string
+	ServerID  string
+	Tag       string
+	Metric    string
+	Labels    map[string]string
+	State     json.RawMessage
+	UpdatedAt time.Time
+}
+
+// ServerRow — сервер/тег с лейблами последней записи
+type ServerRow struct {
+	ServerID string            `json:"server_id"`
+	Tag      string            `json:"tag"`
+	Labels   map[string]string `json:"labels"`
+	// Сервер сейчас в окне обслуживания (заполняет сервер, в БД не хранится)
+	InMaintenance bool `json:"in_maintenance"`
+}
+
+// SampleRow — произвольное измерение
+type SampleRow struct {
+	ID        int64             `json:"id"`
+	ServerID  string            `json:"server_id"`
+	Tag       string            `json:"tag"`
+	Name      string            `json:"name"`
+	Labels    map[string]string `json:"labels"`
+	Value     float64           `json:"value"`
+	Type      string            `json:"type"`
+	Unit      string            `json:"unit"`
+	Timestamp time.Time         `json:"timestamp"`
+}
+
+// HeartbeatRow — последний heartbeat агента
+type HeartbeatRow struct {
+	ServerID      string    `json:"server_id"`
+	Tag           string    `json:"tag"`
+	LastSeen      time.Time `json:"last_seen"`
+	IntervalMs    int64     `json:"interval_ms"`
+	UptimeSeconds int64     `json:"uptime_seconds"`
+	AgentVersion  string    `json:"agent_version"`
+	RemoteAddr    string    `json:"remote_addr"`
+}
+
+// DiagnosticRow — запрос на выполнение диагностической команды и его результат
+type DiagnosticRow struct {
+	ID          int64      `json:"id"`
+	ServerID    string     `json:"server_id"`
+	Tag         string     `json:"tag"`
+	Command     string     `json:"command"`
+	Status      string     `json:"status"`
+	RequestedBy string     `json:"requested_by"`
+	RequestedAt time.Time  `json:"requested_at"`
+	FinishedAt  *time.Time `json:"finished_at,omitempty"`
+	ExitCode    *int32     `json:"exit_code,omitempty"`
+	Error       string     `json:"error,omitempty"`
+	Truncated   bool       `json:"truncated"`
+	Output      string     `json:"output"`
+}
+
+// DiagnosticAuditRow — запись журнала аудита диагностики
+type DiagnosticAuditRow struct {
+	DiagnosticID int64     `json:"diagnostic_id"`
+	Event        string    `json:"event"`
+	Actor        string    `json:"actor"`
+	Details      string    `json:"details"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+// ServerLabelsRow — лейблы, назначенные серверу на стороне gohub
+type ServerLabelsRow struct {
+	ServerID string            `json:"server_id"`
+	Tag      string            `json:"tag"`
+	Labels   map[string]string `json:"labels"`
 }
 
 type Storage struct {
@@ -39,6 +225,16 @@ func NewStorage(dsn string) (*Storage, error) {
 	return &Storage{db: db}, nil
 }
 
+// Close закрывает пул соединений
+func (s *Storage) Close() error {
+	return s.db.Close()
+}
+
+// Ping проверяет соединение с БД
+func (s *Storage) Ping(ctx context.Context) error {
+	return s.db.PingContext(ctx)
+}
+
 // Проверим, создана ли таблица metrics
 func (s *Storage) EnsureSchema(ctx context.Context) error {
 	query := `
@@ -52,6 +248,188 @@ func (s *Storage) EnsureSchema(ctx context.Context) error {
 		network_usage DOUBLE PRECISION NOT NULL,
 		created_at TIMESTAMPTZ DEFAULT now()
 	);
+	ALTER TABLE metrics ADD COLUMN IF NOT EXISTS labels JSONB NOT NULL DEFAULT '{}';
+	CREATE INDEX IF NOT EXISTS metrics_labels_idx ON metrics USING GIN (labels);
+	CREATE INDEX IF NOT EXISTS metrics_created_idx ON metrics (created_at, id);
+	CREATE INDEX IF NOT EXISTS metrics_server_idx ON metrics (server_id, tag, created_at);
+
+	CREATE TABLE IF NOT EXISTS samples (
+		id BIGSERIAL PRIMARY KEY,
+		server_id TEXT NOT NULL,
+		tag TEXT NOT NULL DEFAULT '',
+		name TEXT NOT NULL,
+		labels JSONB NOT NULL DEFAULT '{}',
+		value DOUBLE PRECISION NOT NULL,
+		type TEXT NOT NULL DEFAULT 'gauge',
+		unit TEXT NOT NULL DEFAULT '',
+		ts TIMESTAMPTZ NOT NULL DEFAULT now()
+	);
+	CREATE INDEX IF NOT EXISTS samples_series_idx ON samples (server_id, tag, name, ts);
+	CREATE INDEX IF NOT EXISTS samples_labels_idx ON samples USING GIN (labels);
+
+	CREATE TABLE IF NOT EXISTS server_labels (
+		server_id TEXT NOT NULL,
+		tag TEXT NOT NULL DEFAULT '',
+		labels JSONB NOT NULL DEFAULT '{}',
+		updated_at TIMESTAMPTZ DEFAULT now(),
+		PRIMARY KEY (server_id, tag)
+	);
+
+	CREATE TABLE IF NOT EXISTS agent_heartbeats (
+		server_id TEXT NOT NULL,
+		tag TEXT NOT NULL DEFAULT '',
+		last_seen TIMESTAMPTZ NOT NULL,
+		interval_ms BIGINT NOT NULL DEFAULT 0,
+		uptime_seconds BIGINT NOT NULL DEFAULT 0,
+		agent_version TEXT NOT NULL DEFAULT '',
+		remote_addr TEXT NOT NULL DEFAULT '',
+		PRIMARY KEY (server_id, tag)
+	);
+
+	CREATE TABLE IF NOT EXISTS diagnostics (
+		id BIGSERIAL PRIMARY KEY,
+		server_id TEXT NOT NULL,
+		tag TEXT NOT NULL DEFAULT '',
+		command TEXT NOT NULL,
+		status TEXT NOT NULL,
+		requested_by TEXT NOT NULL DEFAULT '',
+		requested_at TIMESTAMPTZ DEFAULT now(),
+		finished_at TIMESTAMPTZ,
+		exit_code INTEGER,
+		error TEXT NOT NULL DEFAULT '',
+		truncated BOOLEAN NOT NULL DEFAULT false,
+		output TEXT NOT NULL DEFAULT ''
+	);
+	CREATE INDEX IF NOT EXISTS diagnostics_server_idx ON diagnostics (server_id, tag, status);
+
+	CREATE TABLE IF NOT EXISTS diagnostic_audit (
+		id BIGSERIAL PRIMARY KEY,
+		diagnostic_id BIGINT NOT NULL,
+		event TEXT NOT NULL,
+		actor TEXT NOT NULL DEFAULT '',
+		details TEXT NOT NULL DEFAULT '',
+		created_at TIMESTAMPTZ DEFAULT now()
+	);
+
+	CREATE TABLE IF NOT EXISTS server_inventory (
+		server_id TEXT NOT NULL,
+		tag TEXT NOT NULL DEFAULT '',
+		inventory JSONB NOT NULL,
+		updated_at TIMESTAMPTZ DEFAULT now(),
+		PRIMARY KEY (server_id, tag)
+	);
+
+	CREATE TABLE IF NOT EXISTS servers (
+		server_id TEXT NOT NULL,
+		tag TEXT NOT NULL DEFAULT '',
+		labels JSONB NOT NULL DEFAULT '{}',
+		first_seen TIMESTAMPTZ NOT NULL DEFAULT now(),
+		last_seen TIMESTAMPTZ NOT NULL DEFAULT now(),
+		PRIMARY KEY (server_id, tag)
+	);
+	CREATE INDEX IF NOT EXISTS servers_labels_idx ON servers USING GIN (labels);
+
+	CREATE TABLE IF NOT EXISTS server_events (
+		id BIGSERIAL PRIMARY KEY,
+		server_id TEXT NOT NULL,
+		tag TEXT NOT NULL DEFAULT '',
+		from_state TEXT NOT NULL DEFAULT '',
+		to_state TEXT NOT NULL,
+		last_seen TIMESTAMPTZ,
+		created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+	);
+	CREATE INDEX IF NOT EXISTS server_events_server_idx ON server_events (server_id, tag, created_at);
+
+	CREATE TABLE IF NOT EXISTS alert_rules (
+		name TEXT PRIMARY KEY,
+		expr TEXT NOT NULL,
+		severity TEXT NOT NULL DEFAULT 'warning',
+		labels JSONB NOT NULL DEFAULT '{}',
+		annotations JSONB NOT NULL DEFAULT '{}',
+		created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+	);
+	ALTER TABLE alert_rules ADD COLUMN IF NOT EXISTS channels JSONB NOT NULL DEFAULT '[]';
+
+	CREATE TABLE IF NOT EXISTS alerts (
+		id BIGSERIAL PRIMARY KEY,
+		fingerprint TEXT NOT NULL,
+		rule TEXT NOT NULL,
+		severity TEXT NOT NULL,
+		server_id TEXT NOT NULL,
+		tag TEXT NOT NULL DEFAULT '',
+		metric TEXT NOT NULL,
+		labels JSONB NOT NULL DEFAULT '{}',
+		annotations JSONB NOT NULL DEFAULT '{}',
+		state TEXT NOT NULL,
+		value DOUBLE PRECISION NOT NULL,
+		started_at TIMESTAMPTZ NOT NULL,
+		fired_at TIMESTAMPTZ,
+		resolved_at TIMESTAMPTZ,
+		updated_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+		UNIQUE (fingerprint, started_at)
+	);
+	CREATE INDEX IF NOT EXISTS alerts_state_idx ON alerts (state, updated_at);
+
+	CREATE TABLE IF NOT EXISTS silences (
+		id BIGSERIAL PRIMARY KEY,
+		server_id TEXT NOT NULL DEFAULT '',
+		tag TEXT NOT NULL DEFAULT '',
+		labels JSONB NOT NULL DEFAULT '{}',
+		comment TEXT NOT NULL DEFAULT '',
+		created_by TEXT NOT NULL DEFAULT '',
+		starts_at TIMESTAMPTZ NOT NULL,
+		ends_at TIMESTAMPTZ NOT NULL,
+		created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+	);
+	CREATE INDEX IF NOT EXISTS silences_ends_idx ON silences (ends_at);
+
+	CREATE TABLE IF NOT EXISTS maintenance_windows (
+		name TEXT PRIMARY KEY,
+		schedule TEXT NOT NULL,
+		duration TEXT NOT NULL,
+		timezone TEXT NOT NULL DEFAULT '',
+		server_id TEXT NOT NULL DEFAULT '',
+		tag TEXT NOT NULL DEFAULT '',
+		labels JSONB NOT NULL DEFAULT '{}',
+		comment TEXT NOT NULL DEFAULT '',
+		created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+	);
+
+	CREATE TABLE IF NOT EXISTS anomaly_scores (
+		id BIGSERIAL PRIMARY KEY,
+		server_id TEXT NOT NULL,
+		tag TEXT NOT NULL DEFAULT '',
+		metric TEXT NOT NULL,
+		labels JSONB NOT NULL DEFAULT '{}',
+		value DOUBLE PRECISION NOT NULL,
+		expected DOUBLE PRECISION NOT NULL,
+		stddev DOUBLE PRECISION NOT NULL,
+		score DOUBLE PRECISION NOT NULL,
+		anomalous BOOLEAN NOT NULL,
+		created_at TIMESTAMPTZ NOT NULL
+	);
+	CREATE INDEX IF NOT EXISTS anomaly_scores_server_idx ON anomaly_scores (server_id, tag, created_at);
+
+	CREATE TABLE IF NOT EXISTS anomaly_baselines (
+		key TEXT PRIMARY KEY,
+		server_id TEXT NOT NULL,
+		tag TEXT NOT NULL DEFAULT '',
+		metric TEXT NOT NULL,
+		labels JSONB NOT NULL DEFAULT '{}',
+		state JSONB NOT NULL,
+		updated_at TIMESTAMPTZ NOT NULL DEFAULT now()
+	);
+
+	-- Первичное заполнение реестра из истории (только пока реестр пуст)
+	INSERT INTO servers (server_id, tag, labels, first_seen, last_seen)
+	SELECT DISTINCT ON (server_id, COALESCE(tag, ''))
+		server_id, COALESCE(tag, ''), labels,
+		min(created_at) OVER (PARTITION BY server_id, COALESCE(tag, '')),
+		created_at
+	FROM metrics
+	WHERE NOT EXISTS (SELECT 1 FROM servers)
+	ORDER BY server_id, COALESCE(tag, ''), created_at DESC
+	ON CONFLICT DO NOTHING;
 	`
 	_, err := s.db.ExecContext(ctx, query)
 	return err
@@ -62,48 +440,218 @@ func (s *Storage) SaveMetrics(
 	ctx context.Context,
 	serverID, tag string,
 	cpu, mem, disk, net float64,
+	labels map[string]string,
+	createdAt time.Time,
 ) error {
 	const query = `
 INSERT INTO metrics (
-  server_id, tag, cpu_usage, memory_usage, disk_usage, network_usage
+  server_id, tag, cpu_usage, memory_usage, disk_usage, network_usage, labels, created_at
 ) 
-VALUES($1, $2, $3, $4, $5, $6)
+VALUES($1, $2, $3, $4, $5, $6, $7, $8)
 `
-	_, err := s.db.ExecContext(ctx, query,
-		serverID, tag, cpu, mem, disk, net,
+	labelsJSON, err := marshalLabels(labels)
+	if err != nil {
+		return err
+	}
+	_, err = s.db.ExecContext(ctx, query,
+		serverID, tag, cpu, mem, disk, net, labelsJSON, createdAt,
 	)
 	return err
 }
 
-// LoadMetrics получает последние N записей (можно фильтровать по server_id/tag)
-func (s *Storage) LoadMetrics(ctx context.Context, serverID, tag string, limit int64) ([]MetricRow, error) {
+// SaveSamples сохраняет пачку сэмплов одним запросом
+func (s *Storage) SaveSamples(ctx context.Context, samples []SampleRow) error {
+	if len(samples) == 0 {
+		return nil
+	}
+	const columns = 8
+	query := "INSERT INTO samples (server_id, tag, name, labels, value, type, unit, ts) VALUES "
+	args := make([]interface{}, 0, len(samples)*columns)
+	values := make([]string, 0, len(samples))
+	for i, smp := range samples {
+		labelsJSON, err := marshalLabels(smp.Labels)
+		if err != nil {
+			return err
+		}
+		base := i * columns
+		values = append(values, fmt.Sprintf("($%d, $%d, $%d, $%d, $%d, $%d, $%d, $%d)",
+			base+1, base+2, base+3, base+4, base+5, base+6, base+7, base+8))
+		args = append(args, smp.ServerID, smp.Tag, smp.Name, labelsJSON, smp.Value, smp.Type, smp.Unit, smp.Timestamp)
+	}
+	query += joinConditions(values, ", ")
+	_, err := s.db.ExecContext(ctx, query, args...)
+	return err
+}
+
+// IsDataError — Postgres отклонил сами данные (классы 22 «data exception» и 23 «integrity constraint violation»):
+// повтор той же записи не поможет
+func IsDataError(err error) bool {
+	var pgErr *pgconn.PgError
+	if !errors.As(err, &pgErr) {
+		return false
+	}
+	return strings.HasPrefix(pgErr.Code, "22") || strings.HasPrefix(pgErr.Code, "23")
+}
+
+// WriteBatch записывает пачку метрик и сэмплов через COPY в одной транзакции:
+// при ошибке не записывается ничего, и пачку можно повторить целиком
+func (s *Storage) WriteBatch(ctx context.Context, metrics []MetricRecord, samples []SampleRow) error {
+	if len(metrics) == 0 && len(samples) == 0 {
+		return nil
+	}
+	metricRows := make([][]interface{}, 0, len(metrics))
+	for _, m := range metrics {
+		labelsJSON, err := marshalLabels(m.Labels)
+		if err != nil {
+			return err
+		}
+		metricRows = append(metricRows, []interface{}{
+			m.ServerID, m.Tag, m.CPUUsage, m.MemoryUsage, m.DiskUsage, m.NetworkUsage, labelsJSON, m.CreatedAt,
+		})
+	}
+	sampleRows := make([][]interface{}, 0, len(samples))
+	for _, smp := range samples {
+		labelsJSON, err := marshalLabels(smp.Labels)
+		if err != nil {
+			return err
+		}
+		sampleRows = append(sampleRows, []interface{}{
+			smp.ServerID, smp.Tag, smp.Name, labelsJSON, smp.Value, smp.Type, smp.Unit, smp.Timestamp,
+		})
+	}
+
+	conn, err := s.db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	return conn.Raw(func(driverConn any) error {
+		pc := driverConn.(*stdlib.Conn).Conn()
+		return pgx.BeginFunc(ctx, pc, func(tx pgx.Tx) error {
+			if len(metricRows) > 0 {
+				if _, err := tx.CopyFrom(ctx, pgx.Identifier{"metrics"},
+					[]string{"server_id", "tag", "cpu_usage", "memory_usage", "disk_usage", "network_usage", "labels", "created_at"},
+					pgx.CopyFromRows(metricRows),
+				); err != nil {
+					return fmt.Errorf("copy metrics: %w", err)
+				}
+			}
+			if len(sampleRows) > 0 {
+				if _, err := tx.CopyFrom(ctx, pgx.Identifier{"samples"},
+					[]string{"server_id", "tag", "name", "labels", "value", "type", "unit", "ts"},
+					pgx.CopyFromRows(sampleRows),
+				); err != nil {
+					return fmt.Errorf("copy samples: %w", err)
+				}
+			}
+			return nil
+		})
+	})
+}
+
+// LoadSamples получает последние N сэмплов (фильтры по server_id/tag/name/лейблам необязательны)
+func (s *Storage) LoadSamples(ctx context.Context, serverID, tag, name string, labels map[string]string, limit int64) ([]SampleRow, error) {
 	query := `
-SELECT id, server_id, tag, cpu_usage, memory_usage, disk_usage, network_usage, created_at
-FROM metrics
+SELECT id, server_id, tag, name, labels, value, type, unit, ts
+FROM samples
 `
 	args := []interface{}{}
 	conditions := []string{}
 	paramIndex := 1
-
-	// Фильтр по server_id
-	if serverID != "" {
-		conditions = append(conditions, fmt.Sprintf("server_id = $%d", paramIndex))
-		args = append(args, serverID)
+	for _, f := range []struct{ column, value string }{
+		{"server_id", serverID}, {"tag", tag}, {"name", name},
+	} {
+		if f.value == "" {
+			continue
+		}
+		conditions = append(conditions, fmt.Sprintf("%s = $%d", f.column, paramIndex))
+		args = append(args, f.value)
 		paramIndex++
 	}
-	// Фильтр по tag
-	if tag != "" {
-		conditions = append(conditions, fmt.Sprintf("tag = $%d", paramIndex))
-		args = append(args, tag)
+	if len(labels) > 0 {
+		labelsJSON, err := marshalLabels(labels)
+		if err != nil {
+			return nil, err
+		}
+		conditions = append(conditions, fmt.Sprintf("labels @> $%d::jsonb", paramIndex))
+		args = append(args, labelsJSON)
 		paramIndex++
 	}
-
 	if len(conditions) > 0 {
 		query += " WHERE " + joinConditions(conditions, " AND ")
 	}
+	query += fmt.Sprintf(" ORDER BY ts DESC LIMIT $%d::bigint", paramIndex)
+	args = append(args, limit)
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var results []SampleRow
+	for rows.Next() {
+		var r SampleRow
+		var labelsJSON []byte
+		if err := rows.Scan(
+			&r.ID, &r.ServerID, &r.Tag, &r.Name, &labelsJSON, &r.Value, &r.Type, &r.Unit, &r.Timestamp,
+		); err != nil {
+			return nil, err
+		}
+		if r.Labels, err = unmarshalLabels(labelsJSON); err != nil {
+			return nil, err
+		}
+		results = append(results, r)
+	}
+	return results, rows.Err()
+}
+
+// HistoryFilter — фильтр для догрузки истории по возрастанию времени
+type HistoryFilter struct {
+	ServerID string
+	Tag      string
+	Labels   map[string]string
+	Names    []string // только для сэмплов
+}
+
+// historyConditions строит общие условия WHERE для истории; timeColumn — колонка времени
+func historyConditions(f HistoryFilter, timeColumn string, afterTime time.Time, afterID int64) ([]string, []interface{}, error) {
+	conditions := []string{fmt.Sprintf("(%s, id) > ($1, $2)", timeColumn)}
+	args := []interface{}{afterTime, afterID}
+	if f.ServerID != "" {
+		args = append(args, f.ServerID)
+		conditions = append(conditions, fmt.Sprintf("server_id = $%d", len(args)))
+	}
+	if f.Tag != "" {
+		args = append(args, f.Tag)
+		conditions = append(conditions, fmt.Sprintf("tag = $%d", len(args)))
+	}
+	if len(f.Labels) > 0 {
+		labelsJSON, err := marshalLabels(f.Labels)
+		if err != nil {
+			return nil, nil, err
+		}
+		args = append(args, labelsJSON)
+		conditions = append(conditions, fmt.Sprintf("labels @> $%d::jsonb", len(args)))
+	}
+	return conditions, args, nil
+}
 
-	query += fmt.Sprintf(" ORDER BY created_at DESC LIMIT $%d::bigint", paramIndex)
+// LoadMetricsAfter получает до limit записей metrics после курсора (created_at, id) по возрастанию.
+// CreatedAt в результате — в формате RFC3339Nano.
+func (s *Storage) LoadMetricsAfter(ctx context.Context, f HistoryFilter, afterTime time.Time, afterID int64, limit int64) ([]MetricRow, error) {
+	conditions, args, err := historyConditions(f, "created_at", afterTime, afterID)
+	if err != nil {
+		return nil, err
+	}
 	args = append(args, limit)
+	query := fmt.Sprintf(`
+SELECT id, server_id, COALESCE(tag, ''), cpu_usage, memory_usage, disk_usage, network_usage, created_at, labels
+FROM metrics
+WHERE %s
+ORDER BY created_at, id
+LIMIT $%d::bigint
+`, joinConditions(conditions, " AND "), len(args))
 
 	rows, err := s.db.QueryContext(ctx, query, args...)
 	if err != nil {
@@ -114,62 +662,1443 @@ FROM metrics
 	var results []MetricRow
 	for rows.Next() {
 		var r MetricRow
-		err := rows.Scan(
+		var createdAt time.Time
+		var labelsJSON []byte
+		if err := rows.Scan(
 			&r.ID, &r.ServerID, &r.Tag,
 			&r.CPUUsage, &r.MemoryUsage, &r.DiskUsage, &r.NetworkUsage,
-			&r.CreatedAt,
-		)
-		if err != nil {
+			&createdAt, &labelsJSON,
+		); err != nil {
+			return nil, err
+		}
+		if r.Labels, err = unmarshalLabels(labelsJSON); err != nil {
 			return nil, err
 		}
+		r.CreatedAt = createdAt.Format(time.RFC3339Nano)
 		results = append(results, r)
 	}
-	return results, nil
+	return results, rows.Err()
 }
 
-// LoadServers получает список всех серверов с тегами
-func (s *Storage) LoadServersWithTags(ctx context.Context) ([]struct{ ServerID, Tag string }, error) {
-	query := `
-	SELECT DISTINCT server_id, tag FROM metrics
-	`
-	rows, err := s.db.QueryContext(ctx, query)
+// LoadSamplesAfter получает до limit сэмплов после курсора (ts, id) по возрастанию
+func (s *Storage) LoadSamplesAfter(ctx context.Context, f HistoryFilter, afterTime time.Time, afterID int64, limit int64) ([]SampleRow, error) {
+	conditions, args, err := historyConditions(f, "ts", afterTime, afterID)
+	if err != nil {
+		return nil, err
+	}
+	if len(f.Names) > 0 {
+		args = append(args, f.Names)
+		conditions = append(conditions, fmt.Sprintf("name = ANY($%d)", len(args)))
+	}
+	args = append(args, limit)
+	query := fmt.Sprintf(`
+SELECT id, server_id, tag, name, labels, value, type, unit, ts
+FROM samples
+WHERE %s
+ORDER BY ts, id
+LIMIT $%d::bigint
+`, joinConditions(conditions, " AND "), len(args))
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 
-	var servers []struct{ ServerID, Tag string }
+	var results []SampleRow
 	for rows.Next() {
-		var serverID string
-		var tag string
-		if err := rows.Scan(&serverID, &tag); err != nil {
+		var r SampleRow
+		var labelsJSON []byte
+		if err := rows.Scan(
+			&r.ID, &r.ServerID, &r.Tag, &r.Name, &labelsJSON, &r.Value, &r.Type, &r.Unit, &r.Timestamp,
+		); err != nil {
+			return nil, err
+		}
+		if r.Labels, err = unmarshalLabels(labelsJSON); err != nil {
 			return nil, err
 		}
-		servers = append(servers, struct{ ServerID, Tag string }{ServerID: serverID, Tag: tag})
+		results = append(results, r)
 	}
-	return servers, nil
+	return results, rows.Err()
 }
 
-// joinConditions объединяет условия SQL
-func joinConditions(conds []string, sep string) string {
-	return strings.Join(conds, sep)
+// LoadLatestMetrics получает последнюю запись metrics каждого сервера/тега не старше since
+func (s *Storage) LoadLatestMetrics(ctx context.Context, since time.Time) ([]MetricRow, error) {
+	const query = `
+SELECT DISTINCT ON (server_id, COALESCE(tag, ''))
+	id, server_id, COALESCE(tag, ''), cpu_usage, memory_usage, disk_usage, network_usage, created_at, labels
+FROM metrics
+WHERE created_at >= $1
+ORDER BY server_id, COALESCE(tag, ''), created_at DESC, id DESC
+`
+	rows, err := s.db.QueryContext(ctx, query, since)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var results []MetricRow
+	for rows.Next() {
+		var r MetricRow
+		var createdAt time.Time
+		var labelsJSON []byte
+		if err := rows.Scan(
+			&r.ID, &r.ServerID, &r.Tag,
+			&r.CPUUsage, &r.MemoryUsage, &r.DiskUsage, &r.NetworkUsage,
+			&createdAt, &labelsJSON,
+		); err != nil {
+			return nil, err
+		}
+		if r.Labels, err = unmarshalLabels(labelsJSON); err != nil {
+			return nil, err
+		}
+		r.CreatedAt = createdAt.Format(time.RFC3339Nano)
+		results = append(results, r)
+	}
+	return results, rows.Err()
 }
 
-// CleanOldMetrics удаляет метрики старше указанного периода
-func (s *Storage) CleanOldMetrics(ctx context.Context, olderThan time.Duration) (int64, error) {
-	query := `
-	DELETE FROM metrics 
-	WHERE created_at < NOW() - $1::interval
-	`
-	result, err := s.db.ExecContext(ctx, query, olderThan.String())
+// LoadLatestSamples получает последнее значение каждого ряда (server_id, tag, name, labels) не старше since
+func (s *Storage) LoadLatestSamples(ctx context.Context, since time.Time) ([]SampleRow, error) {
+	const query = `
+SELECT DISTINCT ON (server_id, tag, name, labels)
+	id, server_id, tag, name, labels, value, type, unit, ts
+FROM samples
+WHERE ts >= $1
+ORDER BY server_id, tag, name, labels, ts DESC, id DESC
+`
+	rows, err := s.db.QueryContext(ctx, query, since)
 	if err != nil {
-		return 0, fmt.Errorf("failed to clean old metrics: %w", err)
+		return nil, err
 	}
+	defer rows.Close()
 
-	count, err := result.RowsAffected()
+	var results []SampleRow
+	for rows.Next() {
+		var r SampleRow
+		var labelsJSON []byte
+		if err := rows.Scan(
+			&r.ID, &r.ServerID, &r.Tag, &r.Name, &labelsJSON, &r.Value, &r.Type, &r.Unit, &r.Timestamp,
+		); err != nil {
+			return nil, err
+		}
+		if r.Labels, err = unmarshalLabels(labelsJSON); err != nil {
+			return nil, err
+		}
+		results = append(results, r)
+	}
+	return results, rows.Err()
+}
+
+// MetricsQuery — параметры выборки из metrics
+type MetricsQuery struct {
+	ServerID string
+	Tag      string
+	Labels   map[string]string
+	// Диапазон времени [From, To); нулевое значение — без ограничения
+	From time.Time
+	To   time.Time
+	// По умолчанию — от новых к старым
+	Ascending bool
+	Limit     int64
+	// Токен страницы из предыдущего ответа
+	PageToken string
+}
+
+// ErrInvalidPageToken — токен страницы повреждён или выдан для другого порядка сортировки
+var ErrInvalidPageToken = errors.New("invalid page token")
+
+// pageCursor — позиция последней записи страницы, зашифрованная в токен
+type pageCursor struct {
+	Time      int64 `json:"t"`
+	ID        int64 `json:"id"`
+	Ascending bool  `json:"asc"`
+}
+
+func encodePageToken(c pageCursor) string {
+	data, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodePageToken(token string) (pageCursor, error) {
+	var c pageCursor
+	data, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return c, ErrInvalidPageToken
+	}
+	if err := json.Unmarshal(data, &c); err != nil {
+		return c, ErrInvalidPageToken
+	}
+	return c, nil
+}
+
+// LoadMetrics получает записи с фильтрами по server_id/tag/лейблам и диапазону времени.
+// Возвращает токен следующей страницы (пустой — записей больше нет).
+func (s *Storage) LoadMetrics(ctx context.Context, q MetricsQuery) ([]MetricRow, string, error) {
+	if q.Limit <= 0 {
+		q.Limit = 50
+	}
+	query := `
+SELECT id, server_id, COALESCE(tag, ''), cpu_usage, memory_usage, disk_usage, network_usage, created_at, labels
+FROM metrics
+`
+	args := []interface{}{}
+	conditions := []string{}
+	paramIndex := 1
+
+	// Фильтр по server_id
+	if q.ServerID != "" {
+		conditions = append(conditions, fmt.Sprintf("server_id = $%d", paramIndex))
+		args = append(args, q.ServerID)
+		paramIndex++
+	}
+	// Фильтр по tag
+	if q.Tag != "" {
+		conditions = append(conditions, fmt.Sprintf("tag = $%d", paramIndex))
+		args = append(args, q.Tag)
+		paramIndex++
+	}
+	// Фильтр по лейблам: запись должна содержать все пары
+	if len(q.Labels) > 0 {
+		labelsJSON, err := marshalLabels(q.Labels)
+		if err != nil {
+			return nil, "", err
+		}
+		conditions = append(conditions, fmt.Sprintf("labels @> $%d::jsonb", paramIndex))
+		args = append(args, labelsJSON)
+		paramIndex++
+	}
+	// Диапазон времени
+	if !q.From.IsZero() {
+		conditions = append(conditions, fmt.Sprintf("created_at >= $%d", paramIndex))
+		args = append(args, q.From)
+		paramIndex++
+	}
+	if !q.To.IsZero() {
+		conditions = append(conditions, fmt.Sprintf("created_at < $%d", paramIndex))
+		args = append(args, q.To)
+		paramIndex++
+	}
+	// Продолжение с позиции предыдущей страницы
+	if q.PageToken != "" {
+		c, err := decodePageToken(q.PageToken)
+		if err != nil {
+			return nil, "", err
+		}
+		if c.Ascending != q.Ascending {
+			return nil, "", ErrInvalidPageToken
+		}
+		op := "<"
+		if q.Ascending {
+			op = ">"
+		}
+		conditions = append(conditions, fmt.Sprintf("(created_at, id) %s ($%d, $%d)", op, paramIndex, paramIndex+1))
+		args = append(args, time.Unix(0, c.Time), c.ID)
+		paramIndex += 2
+	}
+
+	if len(conditions) > 0 {
+		query += " WHERE " + joinConditions(conditions, " AND ")
+	}
+
+	order := "DESC"
+	if q.Ascending {
+		order = "ASC"
+	}
+	// Берём на одну запись больше, чтобы понять, есть ли следующая страница
+	query += fmt.Sprintf(" ORDER BY created_at %s, id %s LIMIT $%d::bigint", order, order, paramIndex)
+	args = append(args, q.Limit+1)
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
 	if err != nil {
-		return 0, fmt.Errorf("failed to get affected rows: %w", err)
+		return nil, "", err
 	}
+	defer rows.Close()
 
-	return count, nil
+	var results []MetricRow
+	var lastTime time.Time
+	for rows.Next() {
+		var r MetricRow
+		var createdAt time.Time
+		var labelsJSON []byte
+		err := rows.Scan(
+			&r.ID, &r.ServerID, &r.Tag,
+			&r.CPUUsage, &r.MemoryUsage, &r.DiskUsage, &r.NetworkUsage,
+			&createdAt, &labelsJSON,
+		)
+		if err != nil {
+			return nil, "", err
+		}
+		if int64(len(results)) == q.Limit {
+			// Лишняя запись: страница заполнена, есть продолжение
+			last := results[len(results)-1]
+			next := pageCursor{Time: lastTime.UnixNano(), ID: last.ID, Ascending: q.Ascending}
+			return results, encodePageToken(next), rows.Err()
+		}
+		if r.Labels, err = unmarshalLabels(labelsJSON); err != nil {
+			return nil, "", err
+		}
+		r.CreatedAt = createdAt.Format(time.RFC3339Nano)
+		lastTime = createdAt
+		results = append(results, r)
+	}
+	return results, "", rows.Err()
+}
+
+// LoadServersWithTags получает список всех серверов с тегами и лейблами из реестра
+func (s *Storage) LoadServersWithTags(ctx context.Context, labels map[string]string) ([]ServerRow, error) {
+	query := `SELECT server_id, tag, labels FROM servers`
+	order := " ORDER BY server_id, tag"
+	args := []interface{}{}
+	if len(labels) > 0 {
+		labelsJSON, err := marshalLabels(labels)
+		if err != nil {
+			return nil, err
+		}
+		query += " WHERE labels @> $1::jsonb"
+		args = append(args, labelsJSON)
+	}
+	rows, err := s.db.QueryContext(ctx, query+order, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var servers []ServerRow
+	for rows.Next() {
+		var r ServerRow
+		var labelsJSON []byte
+		if err := rows.Scan(&r.ServerID, &r.Tag, &labelsJSON); err != nil {
+			return nil, err
+		}
+		if r.Labels, err = unmarshalLabels(labelsJSON); err != nil {
+			return nil, err
+		}
+		servers = append(servers, r)
+	}
+	return servers, rows.Err()
+}
+
+// ServerInfoRow — запись реестра серверов
+type ServerInfoRow struct {
+	ServerID  string            `json:"server_id"`
+	Tag       string            `json:"tag"`
+	Labels    map[string]string `json:"labels"`
+	FirstSeen time.Time         `json:"first_seen"`
+	LastSeen  time.Time         `json:"last_seen"`
+	Inventory json.RawMessage   `json:"inventory,omitempty"`
+}
+
+// TouchServer регистрирует агента или обновляет время последней активности.
+// Лейблы обновляются, только если переданы (nil — оставить прежние).
+func (s *Storage) TouchServer(ctx context.Context, serverID, tag string, labels map[string]string, seen time.Time) error {
+	// NULL — оставить прежние лейблы
+	var labelsArg interface{}
+	if labels != nil {
+		labelsJSON, err := marshalLabels(labels)
+		if err != nil {
+			return err
+		}
+		labelsArg = labelsJSON
+	}
+	const query = `
+INSERT INTO servers (server_id, tag, labels, first_seen, last_seen)
+VALUES ($1, $2, COALESCE($3::jsonb, '{}'), $4, $4)
+ON CONFLICT (server_id, tag) DO UPDATE SET
+  labels = COALESCE($3::jsonb, servers.labels),
+  last_seen = GREATEST(servers.last_seen, EXCLUDED.last_seen)
+`
+	_, err := s.db.ExecContext(ctx, query, serverID, tag, labelsArg, seen)
+	return err
+}
+
+// LoadServers возвращает реестр серверов с инвентарём (можно фильтровать по лейблам)
+func (s *Storage) LoadServers(ctx context.Context, labels map[string]string) ([]ServerInfoRow, error) {
+	return s.loadServers(ctx, labels, "", "", false)
+}
+
+// LoadServer возвращает один сервер из реестра; nil — сервер не найден
+func (s *Storage) LoadServer(ctx context.Context, serverID, tag string) (*ServerInfoRow, error) {
+	rows, err := s.loadServers(ctx, nil, serverID, tag, true)
+	if err != nil || len(rows) == 0 {
+		return nil, err
+	}
+	return &rows[0], nil
+}
+
+func (s *Storage) loadServers(ctx context.Context, labels map[string]string, serverID, tag string, exact bool) ([]ServerInfoRow, error) {
+	query := `
+SELECT s.server_id, s.tag, s.labels, s.first_seen, s.last_seen, i.inventory
+FROM servers s
+LEFT JOIN server_inventory i ON i.server_id = s.server_id AND i.tag = s.tag
+`
+	args := []interface{}{}
+	conditions := []string{}
+	if exact {
+		args = append(args, serverID, tag)
+		conditions = append(conditions, "s.server_id = $1", "s.tag = $2")
+	}
+	if len(labels) > 0 {
+		labelsJSON, err := marshalLabels(labels)
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, labelsJSON)
+		conditions = append(conditions, fmt.Sprintf("s.labels @> $%d::jsonb", len(args)))
+	}
+	if len(conditions) > 0 {
+		query += " WHERE " + joinConditions(conditions, " AND ")
+	}
+	query += " ORDER BY s.server_id, s.tag"
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var results []ServerInfoRow
+	for rows.Next() {
+		var r ServerInfoRow
+		var labelsJSON, inventory []byte
+		if err := rows.Scan(&r.ServerID, &r.Tag, &labelsJSON, &r.FirstSeen, &r.LastSeen, &inventory); err != nil {
+			return nil, err
+		}
+		if r.Labels, err = unmarshalLabels(labelsJSON); err != nil {
+			return nil, err
+		}
+		if len(inventory) > 0 {
+			r.Inventory = json.RawMessage(inventory)
+		}
+		results = append(results, r)
+	}
+	return results, rows.Err()
+}
+
+// DeleteServer выводит агента из реестра: удаляет запись реестра, heartbeat, инвентарь
+// и назначенные лейблы; при purge удаляет и историю метрик и сэмплов.
+// Возвращает false, если сервера нет в реестре.
+func (s *Storage) DeleteServer(ctx context.Context, serverID, tag string, purge bool) (bool, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	res, err := tx.ExecContext(ctx, `DELETE FROM servers WHERE server_id = $1 AND tag = $2`, serverID, tag)
+	if err != nil {
+		return false, err
+	}
+	if n, err := res.RowsAffected(); err != nil || n == 0 {
+		return false, err
+	}
+
+	queries := []string{
+		`DELETE FROM agent_heartbeats WHERE server_id = $1 AND tag = $2`,
+		`DELETE FROM server_inventory WHERE server_id = $1 AND tag = $2`,
+		`DELETE FROM server_labels WHERE server_id = $1 AND tag = $2`,
+		`DELETE FROM anomaly_baselines WHERE server_id = $1 AND tag = $2`,
+	}
+	if purge {
+		queries = append(queries,
+			`DELETE FROM metrics WHERE server_id = $1 AND COALESCE(tag, '') = $2`,
+			`DELETE FROM samples WHERE server_id = $1 AND tag = $2`,
+			`DELETE FROM server_events WHERE server_id = $1 AND tag = $2`,
+			`DELETE FROM anomaly_scores WHERE server_id = $1 AND tag = $2`,
+		)
+	}
+	for _, q := range queries {
+		if _, err := tx.ExecContext(ctx, q, serverID, tag); err != nil {
+			return false, err
+		}
+	}
+	return true, tx.Commit()
+}
+
+// SaveServerEvent сохраняет смену состояния сервера
+func (s *Storage) SaveServerEvent(ctx context.Context, ev ServerEventRow) (int64, error) {
+	const query = `
+INSERT INTO server_events (server_id, tag, from_state, to_state, last_seen, created_at)
+VALUES ($1, $2, $3, $4, $5, $6)
+RETURNING id
+`
+	var id int64
+	err := s.db.QueryRowContext(ctx, query,
+		ev.ServerID, ev.Tag, ev.FromState, ev.ToState, ev.LastSeen, ev.CreatedAt,
+	).Scan(&id)
+	return id, err
+}
+
+// LoadServerEvents получает последние N смен состояния (фильтры по server_id/tag необязательны)
+func (s *Storage) LoadServerEvents(ctx context.Context, serverID, tag string, limit int64) ([]ServerEventRow, error) {
+	query := `
+SELECT id, server_id, tag, from_state, to_state, last_seen, created_at
+FROM server_events
+`
+	var args []interface{}
+	var conditions []string
+	if serverID != "" {
+		args = append(args, serverID)
+		conditions = append(conditions, fmt.Sprintf("server_id = $%d", len(args)))
+	}
+	if tag != "" {
+		args = append(args, tag)
+		conditions = append(conditions, fmt.Sprintf("tag = $%d", len(args)))
+	}
+	if len(conditions) > 0 {
+		query += " WHERE " + joinConditions(conditions, " AND ")
+	}
+	args = append(args, limit)
+	query += fmt.Sprintf(" ORDER BY created_at DESC, id DESC LIMIT $%d::bigint", len(args))
+	return s.queryServerEvents(ctx, query, args...)
+}
+
+// LoadServerStates получает последнюю смену состояния каждого сервера/тега
+func (s *Storage) LoadServerStates(ctx context.Context) ([]ServerEventRow, error) {
+	return s.queryServerEvents(ctx, `
+SELECT DISTINCT ON (server_id, tag)
+	id, server_id, tag, from_state, to_state, last_seen, created_at
+FROM server_events
+ORDER BY server_id, tag, created_at DESC, id DESC
+`)
+}
+
+func (s *Storage) queryServerEvents(ctx context.Context, query string, args ...interface{}) ([]ServerEventRow, error) {
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var results []ServerEventRow
+	for rows.Next() {
+		var r ServerEventRow
+		if err := rows.Scan(&r.ID, &r.ServerID, &r.Tag, &r.FromState, &r.ToState, &r.LastSeen, &r.CreatedAt); err != nil {
+			return nil, err
+		}
+		results = append(results, r)
+	}
+	return results, rows.Err()
+}
+
+// SaveAlertRule создаёт или заменяет правило оповещения
+func (s *Storage) SaveAlertRule(ctx context.Context, r AlertRuleRow) error {
+	const query = `
+INSERT INTO alert_rules (name, expr, severity, labels, annotations, channels)
+VALUES ($1, $2, $3, $4, $5, $6)
+ON CONFLICT (name) DO UPDATE SET
+  expr = EXCLUDED.expr,
+  severity = EXCLUDED.severity,
+  labels = EXCLUDED.labels,
+  annotations = EXCLUDED.annotations,
+  channels = EXCLUDED.channels
+`
+	labelsJSON, err := marshalLabels(r.Labels)
+	if err != nil {
+		return err
+	}
+	annotationsJSON, err := marshalLabels(r.Annotations)
+	if err != nil {
+		return err
+	}
+	channels := r.Channels
+	if channels == nil {
+		channels = []string{}
+	}
+	channelsJSON, err := json.Marshal(channels)
+	if err != nil {
+		return err
+	}
+	_, err = s.db.ExecContext(ctx, query, r.Name, r.Expr, r.Severity, labelsJSON, annotationsJSON, string(channelsJSON))
+	return err
+}
+
+// DeleteAlertRule удаляет правило; false — правила нет
+func (s *Storage) DeleteAlertRule(ctx context.Context, name string) (bool, error) {
+	res, err := s.db.ExecContext(ctx, `DELETE FROM alert_rules WHERE name = $1`, name)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+// LoadAlertRules возвращает правила из таблицы alert_rules
+func (s *Storage) LoadAlertRules(ctx context.Context) ([]AlertRuleRow, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT name, expr, severity, labels, annotations, channels FROM alert_rules ORDER BY name`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var results []AlertRuleRow
+	for rows.Next() {
+		r := AlertRuleRow{Source: "api"}
+		var labelsJSON, annotationsJSON, channelsJSON []byte
+		if err := rows.Scan(&r.Name, &r.Expr, &r.Severity, &labelsJSON, &annotationsJSON, &channelsJSON); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(channelsJSON, &r.Channels); err != nil {
+			return nil, err
+		}
+		if r.Labels, err = unmarshalLabels(labelsJSON); err != nil {
+			return nil, err
+		}
+		if r.Annotations, err = unmarshalLabels(annotationsJSON); err != nil {
+			return nil, err
+		}
+		results = append(results, r)
+	}
+	return results, rows.Err()
+}
+
+// SaveAlert сохраняет состояние оповещения (новое или обновление по fingerprint и started_at)
+func (s *Storage) SaveAlert(ctx context.Context, a AlertRow) error {
+	const query = `
+INSERT INTO alerts (
+  fingerprint, rule, severity, server_id, tag, metric, labels, annotations,
+  state, value, started_at, fired_at, resolved_at, updated_at
+)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14)
+ON CONFLICT (fingerprint, started_at) DO UPDATE SET
+  annotations = EXCLUDED.annotations,
+  state = EXCLUDED.state,
+  value = EXCLUDED.value,
+  fired_at = EXCLUDED.fired_at,
+  resolved_at = EXCLUDED.resolved_at,
+  updated_at = EXCLUDED.updated_at
+`
+	labelsJSON, err := marshalLabels(a.Labels)
+	if err != nil {
+		return err
+	}
+	annotationsJSON, err := marshalLabels(a.Annotations)
+	if err != nil {
+		return err
+	}
+	_, err = s.db.ExecContext(ctx, query,
+		a.Fingerprint, a.Rule, a.Severity, a.ServerID, a.Tag, a.Metric, labelsJSON, annotationsJSON,
+		a.State, a.Value, a.StartedAt, a.FiredAt, a.ResolvedAt, a.UpdatedAt,
+	)
+	return err
+}
+
+// LoadAlerts получает последние N оповещений; states и serverID — необязательные фильтры
+func (s *Storage) LoadAlerts(ctx context.Context, states []string, serverID string, limit int64) ([]AlertRow, error) {
+	query := `
+SELECT id, fingerprint, rule, severity, server_id, tag, metric, labels, annotations,
+       state, value, started_at, fired_at, resolved_at, updated_at
+FROM alerts
+`
+	var args []interface{}
+	var conditions []string
+	if len(states) > 0 {
+		args = append(args, states)
+		conditions = append(conditions, fmt.Sprintf("state = ANY($%d)", len(args)))
+	}
+	if serverID != "" {
+		args = append(args, serverID)
+		conditions = append(conditions, fmt.Sprintf("server_id = $%d", len(args)))
+	}
+	if len(conditions) > 0 {
+		query += " WHERE " + joinConditions(conditions, " AND ")
+	}
+	query += " ORDER BY updated_at DESC, id DESC"
+	if limit > 0 {
+		args = append(args, limit)
+		query += fmt.Sprintf(" LIMIT $%d::bigint", len(args))
+	}
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var results []AlertRow
+	for rows.Next() {
+		var a AlertRow
+		var labelsJSON, annotationsJSON []byte
+		if err := rows.Scan(
+			&a.ID, &a.Fingerprint, &a.Rule, &a.Severity, &a.ServerID, &a.Tag, &a.Metric, &labelsJSON, &annotationsJSON,
+			&a.State, &a.Value, &a.StartedAt, &a.FiredAt, &a.ResolvedAt, &a.UpdatedAt,
+		); err != nil {
+			return nil, err
+		}
+		if a.Labels, err = unmarshalLabels(labelsJSON); err != nil {
+			return nil, err
+		}
+		if a.Annotations, err = unmarshalLabels(annotationsJSON); err != nil {
+			return nil, err
+		}
+		results = append(results, a)
+	}
+	return results, rows.Err()
+}
+
+// LoadServerLabels возвращает все лейблы, назначенные на сервере
+func (s *Storage) LoadServerLabels(ctx context.Context) ([]ServerLabelsRow, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT server_id, tag, labels FROM server_labels`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var result []ServerLabelsRow
+	for rows.Next() {
+		var r ServerLabelsRow
+		var labelsJSON []byte
+		if err := rows.Scan(&r.ServerID, &r.Tag, &labelsJSON); err != nil {
+			return nil, err
+		}
+		if r.Labels, err = unmarshalLabels(labelsJSON); err != nil {
+			return nil, err
+		}
+		result = append(result, r)
+	}
+	return result, rows.Err()
+}
+
+// SaveServerLabels назначает лейблы серверу (tag="" — для всех тегов сервера).
+// Пустой набор удаляет назначение.
+func (s *Storage) SaveServerLabels(ctx context.Context, serverID, tag string, labels map[string]string) error {
+	if len(labels) == 0 {
+		_, err := s.db.ExecContext(ctx,
+			`DELETE FROM server_labels WHERE server_id = $1 AND tag = $2`, serverID, tag)
+		return err
+	}
+	labelsJSON, err := marshalLabels(labels)
+	if err != nil {
+		return err
+	}
+	const query = `
+INSERT INTO server_labels (server_id, tag, labels, updated_at)
+VALUES ($1, $2, $3, now())
+ON CONFLICT (server_id, tag) DO UPDATE SET labels = EXCLUDED.labels, updated_at = now()
+`
+	_, err = s.db.ExecContext(ctx, query, serverID, tag, labelsJSON)
+	return err
+}
+
+// SaveInventory сохраняет инвентарь агента (JSON)
+func (s *Storage) SaveInventory(ctx context.Context, serverID, tag string, inventory []byte) error {
+	const query = `
+INSERT INTO server_inventory (server_id, tag, inventory, updated_at)
+VALUES ($1, $2, $3, now())
+ON CONFLICT (server_id, tag) DO UPDATE SET inventory = EXCLUDED.inventory, updated_at = now()
+`
+	_, err := s.db.ExecContext(ctx, query, serverID, tag, string(inventory))
+	return err
+}
+
+// SaveHeartbeat обновляет время последнего heartbeat агента
+func (s *Storage) SaveHeartbeat(ctx context.Context, hb HeartbeatRow) error {
+	const query = `
+INSERT INTO agent_heartbeats (server_id, tag, last_seen, interval_ms, uptime_seconds, agent_version, remote_addr)
+VALUES ($1, $2, $3, $4, $5, $6, $7)
+ON CONFLICT (server_id, tag) DO UPDATE SET
+  last_seen = EXCLUDED.last_seen,
+  interval_ms = EXCLUDED.interval_ms,
+  uptime_seconds = EXCLUDED.uptime_seconds,
+  agent_version = EXCLUDED.agent_version,
+  remote_addr = EXCLUDED.remote_addr
+`
+	_, err := s.db.ExecContext(ctx, query,
+		hb.ServerID, hb.Tag, hb.LastSeen, hb.IntervalMs, hb.UptimeSeconds, hb.AgentVersion, hb.RemoteAddr,
+	)
+	return err
+}
+
+// LoadHeartbeats возвращает последние heartbeat всех агентов
+func (s *Storage) LoadHeartbeats(ctx context.Context) ([]HeartbeatRow, error) {
+	const query = `
+SELECT server_id, tag, last_seen, interval_ms, uptime_seconds, agent_version, remote_addr
+FROM agent_heartbeats
+ORDER BY server_id, tag
+`
+	rows, err := s.db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var result []HeartbeatRow
+	for rows.Next() {
+		var r HeartbeatRow
+		if err := rows.Scan(
+			&r.ServerID, &r.Tag, &r.LastSeen, &r.IntervalMs, &r.UptimeSeconds, &r.AgentVersion, &r.RemoteAddr,
+		); err != nil {
+			return nil, err
+		}
+		result = append(result, r)
+	}
+	return result, rows.Err()
+}
+
+// CreateDiagnostic ставит диагностическую команду в очередь
+func (s *Storage) CreateDiagnostic(ctx context.Context, serverID, tag, command, requestedBy string) (int64, error) {
+	const query = `
+INSERT INTO diagnostics (server_id, tag, command, status, requested_by)
+VALUES ($1, $2, $3, 'queued', $4)
+RETURNING id
+`
+	var id int64
+	err := s.db.QueryRowContext(ctx, query, serverID, tag, command, requestedBy).Scan(&id)
+	return id, err
+}
+
+// LoadDiagnostics возвращает последние N запросов диагностики (фильтры необязательны)
+func (s *Storage) LoadDiagnostics(ctx context.Context, serverID, tag, status string, limit int64) ([]DiagnosticRow, error) {
+	query := `
+SELECT id, server_id, tag, command, status, requested_by, requested_at, finished_at, exit_code, error, truncated, output
+FROM diagnostics
+`
+	args := []interface{}{}
+	conditions := []string{}
+	paramIndex := 1
+	for _, f := range []struct{ column, value string }{
+		{"server_id", serverID}, {"tag", tag}, {"status", status},
+	} {
+		if f.value == "" {
+			continue
+		}
+		conditions = append(conditions, fmt.Sprintf("%s = $%d", f.column, paramIndex))
+		args = append(args, f.value)
+		paramIndex++
+	}
+	if len(conditions) > 0 {
+		query += " WHERE " + joinConditions(conditions, " AND ")
+	}
+	query += fmt.Sprintf(" ORDER BY id DESC LIMIT $%d::bigint", paramIndex)
+	args = append(args, limit)
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var result []DiagnosticRow
+	for rows.Next() {
+		var r DiagnosticRow
+		if err := rows.Scan(
+			&r.ID, &r.ServerID, &r.Tag, &r.Command, &r.Status, &r.RequestedBy, &r.RequestedAt,
+			&r.FinishedAt, &r.ExitCode, &r.Error, &r.Truncated, &r.Output,
+		); err != nil {
+			return nil, err
+		}
+		result = append(result, r)
+	}
+	return result, rows.Err()
+}
+
+// TransitionDiagnostic меняет статус запроса диагностики, только если текущий статус равен from.
+// Возвращает false, если запрос уже в другом статусе (например, его забрал другой обработчик).
+func (s *Storage) TransitionDiagnostic(ctx context.Context, id int64, from, to string) (bool, error) {
+	result, err := s.db.ExecContext(ctx,
+		`UPDATE diagnostics SET status = $3 WHERE id = $1 AND status = $2`, id, from, to)
+	if err != nil {
+		return false, err
+	}
+	count, err := result.RowsAffected()
+	return count > 0, err
+}
+
+// LoadDiagnostic возвращает запрос диагностики без вывода; nil — записи нет
+func (s *Storage) LoadDiagnostic(ctx context.Context, id int64) (*DiagnosticRow, error) {
+	var r DiagnosticRow
+	err := s.db.QueryRowContext(ctx, `
+SELECT id, server_id, tag, command, status, requested_by, requested_at, finished_at, exit_code, error, truncated
+FROM diagnostics WHERE id = $1`, id).Scan(
+		&r.ID, &r.ServerID, &r.Tag, &r.Command, &r.Status, &r.RequestedBy, &r.RequestedAt,
+		&r.FinishedAt, &r.ExitCode, &r.Error, &r.Truncated,
+	)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &r, nil
+}
+
+// AppendDiagnosticOutput дописывает часть вывода команды
+func (s *Storage) AppendDiagnosticOutput(ctx context.Context, id int64, data string) error {
+	_, err := s.db.ExecContext(ctx, `UPDATE diagnostics SET output = output || $2 WHERE id = $1`, id, data)
+	return err
+}
+
+// FinishDiagnostic сохраняет итог выполнения команды
+func (s *Storage) FinishDiagnostic(ctx context.Context, id int64, status string, exitCode int32, errMsg string, truncated bool) error {
+	const query = `
+UPDATE diagnostics
+SET status = $2, exit_code = $3, error = $4, truncated = $5, finished_at = now()
+WHERE id = $1
+`
+	_, err := s.db.ExecContext(ctx, query, id, status, exitCode, errMsg, truncated)
+	return err
+}
+
+// SaveDiagnosticAudit добавляет запись в журнал аудита диагностики
+func (s *Storage) SaveDiagnosticAudit(ctx context.Context, diagnosticID int64, event, actor, details string) error {
+	const query = `
+INSERT INTO diagnostic_audit (diagnostic_id, event, actor, details)
+VALUES ($1, $2, $3, $4)
+`
+	_, err := s.db.ExecContext(ctx, query, diagnosticID, event, actor, details)
+	return err
+}
+
+// LoadDiagnosticAudit возвращает журнал аудита (diagnosticID=0 — последние записи по всем)
+func (s *Storage) LoadDiagnosticAudit(ctx context.Context, diagnosticID int64, limit int64) ([]DiagnosticAuditRow, error) {
+	query := `SELECT diagnostic_id, event, actor, details, created_at FROM diagnostic_audit`
+	args := []interface{}{}
+	if diagnosticID > 0 {
+		query += " WHERE diagnostic_id = $1 ORDER BY id DESC LIMIT $2::bigint"
+		args = append(args, diagnosticID, limit)
+	} else {
+		query += " ORDER BY id DESC LIMIT $1::bigint"
+		args = append(args, limit)
+	}
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var result []DiagnosticAuditRow
+	for rows.Next() {
+		var r DiagnosticAuditRow
+		if err := rows.Scan(&r.DiagnosticID, &r.Event, &r.Actor, &r.Details, &r.CreatedAt); err != nil {
+			return nil, err
+		}
+		result = append(result, r)
+	}
+	return result, rows.Err()
+}
+
+// marshalLabels сериализует лейблы в JSON для колонки JSONB
+func marshalLabels(labels map[string]string) (string, error) {
+	if labels == nil {
+		return "{}", nil
+	}
+	data, err := json.Marshal(labels)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal labels: %w", err)
+	}
+	return string(data), nil
+}
+
+// unmarshalLabels разбирает JSONB-колонку с лейблами
+func unmarshalLabels(data []byte) (map[string]string, error) {
+	labels := map[string]string{}
+	if len(data) == 0 {
+		return labels, nil
+	}
+	if err := json.Unmarshal(data, &labels); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal labels: %w", err)
+	}
+	return labels, nil
+}
+
+// joinConditions объединяет условия SQL
+func joinConditions(conds []string, sep string) string {
+	return strings.Join(conds, sep)
+}
+
+// Функции агрегации для QueryRange
+const (
+	AggAvg  = "avg"
+	AggMin  = "min"
+	AggMax  = "max"
+	AggP95  = "p95"
+	AggLast = "last"
+)
+
+// Максимальное число шагов в одном запросе QueryRange
+const MaxRangePoints = 11000
+
+// aggregationSQL — выражения агрегации над колонками v (значение) и t (время)
+var aggregationSQL = map[string]string{
+	AggAvg:  "avg(v)",
+	AggMin:  "min(v)",
+	AggMax:  "max(v)",
+	AggP95:  "percentile_cont(0.95) WITHIN GROUP (ORDER BY v)",
+	AggLast: "(array_agg(v ORDER BY t DESC))[1]",
+}
+
+// metricColumns — фиксированные поля таблицы metrics, доступные в QueryRange
+var metricColumns = map[string]string{
+	"cpu_usage":     "cpu_usage",
+	"memory_usage":  "memory_usage",
+	"disk_usage":    "disk_usage",
+	"network_usage": "network_usage",
+}
+
+// IsMetricColumn — имя относится к фиксированному полю таблицы metrics
+func IsMetricColumn(name string) bool {
+	_, ok := metricColumns[name]
+	return ok
+}
+
+// RangeQuery — параметры агрегированной выборки
+type RangeQuery struct {
+	ServerID string
+	Tag      string
+	Labels   map[string]string
+	// Имя фиксированного поля metrics или имя сэмпла
+	Metric      string
+	From        time.Time
+	To          time.Time
+	Step        time.Duration
+	Aggregation string
+}
+
+// Validate проверяет параметры запроса
+func (q RangeQuery) Validate() error {
+	if q.Metric == "" {
+		return errors.New("metric is required")
+	}
+	if q.From.IsZero() || q.To.IsZero() || !q.From.Before(q.To) {
+		return errors.New("from and to are required and from must be before to")
+	}
+	if q.Step < time.Second {
+		return errors.New("step must be at least 1s")
+	}
+	if q.To.Sub(q.From)/q.Step > MaxRangePoints {
+		return fmt.Errorf("too many points, at most %d steps per query", MaxRangePoints)
+	}
+	if _, ok := aggregationSQL[q.Aggregation]; !ok {
+		return fmt.Errorf("unknown aggregation %q", q.Aggregation)
+	}
+	return nil
+}
+
+// PointRow — точка ряда: начало шага и агрегированное значение
+type PointRow struct {
+	Time  time.Time `json:"time"`
+	Value float64   `json:"value"`
+}
+
+// SeriesRow — ряд одного сервера/тега/набора лейблов
+type SeriesRow struct {
+	ServerID string            `json:"server_id"`
+	Tag      string            `json:"tag"`
+	Labels   map[string]string `json:"labels"`
+	Points   []PointRow        `json:"points"`
+}
+
+// QueryRange агрегирует значения по шагам от From в SQL. Шаги без данных пропускаются.
+func (s *Storage) QueryRange(ctx context.Context, q RangeQuery) ([]SeriesRow, error) {
+	if err := q.Validate(); err != nil {
+		return nil, err
+	}
+
+	// Источник: фиксированное поле metrics или сэмплы с указанным именем
+	args := []interface{}{q.From, q.Step.Seconds(), q.To}
+	var source string
+	var conditions []string
+	if column, ok := metricColumns[q.Metric]; ok {
+		source = fmt.Sprintf(`SELECT server_id, COALESCE(tag, '') AS tag, COALESCE(labels, '{}'::jsonb) AS labels,
+	%s AS v, created_at AS t FROM metrics`, column)
+		conditions = append(conditions, "created_at >= $1", "created_at < $3")
+	} else {
+		args = append(args, q.Metric)
+		source = `SELECT server_id, tag, labels, value AS v, ts AS t FROM samples`
+		conditions = append(conditions, "ts >= $1", "ts < $3", fmt.Sprintf("name = $%d", len(args)))
+	}
+	if q.ServerID != "" {
+		args = append(args, q.ServerID)
+		conditions = append(conditions, fmt.Sprintf("server_id = $%d", len(args)))
+	}
+	if q.Tag != "" {
+		args = append(args, q.Tag)
+		conditions = append(conditions, fmt.Sprintf("tag = $%d", len(args)))
+	}
+	if len(q.Labels) > 0 {
+		labelsJSON, err := marshalLabels(q.Labels)
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, labelsJSON)
+		conditions = append(conditions, fmt.Sprintf("labels @> $%d::jsonb", len(args)))
+	}
+
+	query := fmt.Sprintf(`
+SELECT server_id, tag, labels, bucket, %s
+FROM (
+	SELECT server_id, tag, labels, v, t,
+		floor(extract(epoch FROM t - $1::timestamptz) / $2::float8)::bigint AS bucket
+	FROM (%s WHERE %s) src
+) b
+GROUP BY server_id, tag, labels, bucket
+ORDER BY server_id, tag, labels, bucket
+`, aggregationSQL[q.Aggregation], source, joinConditions(conditions, " AND "))
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var results []SeriesRow
+	var lastLabels []byte
+	for rows.Next() {
+		var serverID, tag string
+		var labelsJSON []byte
+		var bucket int64
+		var value float64
+		if err := rows.Scan(&serverID, &tag, &labelsJSON, &bucket, &value); err != nil {
+			return nil, err
+		}
+		// Строки отсортированы по ряду, новый ряд начинается при смене ключа
+		n := len(results)
+		if n == 0 || results[n-1].ServerID != serverID || results[n-1].Tag != tag || string(lastLabels) != string(labelsJSON) {
+			l, err := unmarshalLabels(labelsJSON)
+			if err != nil {
+				return nil, err
+			}
+			results = append(results, SeriesRow{ServerID: serverID, Tag: tag, Labels: l})
+			lastLabels = labelsJSON
+			n++
+		}
+		results[n-1].Points = append(results[n-1].Points, PointRow{
+			Time:  q.From.Add(time.Duration(bucket) * q.Step),
+			Value: value,
+		})
+	}
+	return results, rows.Err()
+}
+
+// CleanOldMetrics удаляет метрики и сэмплы старше указанного периода
+func (s *Storage) CleanOldMetrics(ctx context.Context, olderThan time.Duration) (int64, error) {
+	queries := []string{`
+	DELETE FROM metrics 
+	WHERE created_at < NOW() - $1::interval
+	`, `
+	DELETE FROM samples
+	WHERE ts < NOW() - $1::interval
+	`}
+	var total int64
+	for _, query := range queries {
+		result, err := s.db.ExecContext(ctx, query, olderThan.String())
+		if err != nil {
+			return total, fmt.Errorf("failed to clean old metrics: %w", err)
+		}
+
+		count, err := result.RowsAffected()
+		if err != nil {
+			return total, fmt.Errorf("failed to get affected rows: %w", err)
+		}
+		total += count
+	}
+
+	return total, nil
+}
+
+// SaveSilence создаёт заглушку и возвращает её с id и created_at
+func (s *Storage) SaveSilence(ctx context.Context, r SilenceRow) (SilenceRow, error) {
+	const query = `
+INSERT INTO silences (server_id, tag, labels, comment, created_by, starts_at, ends_at)
+VALUES ($1, $2, $3, $4, $5, $6, $7)
+RETURNING id, created_at
+`
+	labelsJSON, err := marshalLabels(r.Labels)
+	if err != nil {
+		return r, err
+	}
+	err = s.db.QueryRowContext(ctx, query, r.ServerID, r.Tag, labelsJSON, r.Comment, r.CreatedBy, r.StartsAt, r.EndsAt).
+		Scan(&r.ID, &r.CreatedAt)
+	return r, err
+}
+
+// ExpireSilence завершает заглушку в момент at; false — заглушки нет или она уже истекла
+func (s *Storage) ExpireSilence(ctx context.Context, id int64, at time.Time) (bool, error) {
+	res, err := s.db.ExecContext(ctx, `UPDATE silences SET ends_at = $2 WHERE id = $1 AND ends_at > $2`, id, at)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+// LoadSilences возвращает заглушки, действующие после since (нулевое — все), новые первыми
+func (s *Storage) LoadSilences(ctx context.Context, since time.Time) ([]SilenceRow, error) {
+	query := `SELECT id, server_id, tag, labels, comment, created_by, starts_at, ends_at, created_at FROM silences`
+	var args []interface{}
+	if !since.IsZero() {
+		query += " WHERE ends_at > $1"
+		args = append(args, since)
+	}
+	rows, err := s.db.QueryContext(ctx, query+" ORDER BY id DESC", args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var results []SilenceRow
+	for rows.Next() {
+		var r SilenceRow
+		var labelsJSON []byte
+		if err := rows.Scan(&r.ID, &r.ServerID, &r.Tag, &labelsJSON, &r.Comment, &r.CreatedBy, &r.StartsAt, &r.EndsAt, &r.CreatedAt); err != nil {
+			return nil, err
+		}
+		if r.Labels, err = unmarshalLabels(labelsJSON); err != nil {
+			return nil, err
+		}
+		results = append(results, r)
+	}
+	return results, rows.Err()
+}
+
+// SaveMaintenanceWindow создаёт или заменяет окно обслуживания
+func (s *Storage) SaveMaintenanceWindow(ctx context.Context, r MaintenanceWindowRow) error {
+	const query = `
+INSERT INTO maintenance_windows (name, schedule, duration, timezone, server_id, tag, labels, comment)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+ON CONFLICT (name) DO UPDATE SET
+  schedule = EXCLUDED.schedule,
+  duration = EXCLUDED.duration,
+  timezone = EXCLUDED.timezone,
+  server_id = EXCLUDED.server_id,
+  tag = EXCLUDED.tag,
+  labels = EXCLUDED.labels,
+  comment = EXCLUDED.comment
+`
+	labelsJSON, err := marshalLabels(r.Labels)
+	if err != nil {
+		return err
+	}
+	_, err = s.db.ExecContext(ctx, query, r.Name, r.Schedule, r.Duration, r.Timezone, r.ServerID, r.Tag, labelsJSON, r.Comment)
+	return err
+}
+
+// DeleteMaintenanceWindow удаляет окно обслуживания; false — окна нет
+func (s *Storage) DeleteMaintenanceWindow(ctx context.Context, name string) (bool, error) {
+	res, err := s.db.ExecContext(ctx, `DELETE FROM maintenance_windows WHERE name = $1`, name)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+// LoadMaintenanceWindows возвращает окна обслуживания
+func (s *Storage) LoadMaintenanceWindows(ctx context.Context) ([]MaintenanceWindowRow, error) {
+	rows, err := s.db.QueryContext(ctx, `
+SELECT name, schedule, duration, timezone, server_id, tag, labels, comment, created_at
+FROM maintenance_windows ORDER BY name`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var results []MaintenanceWindowRow
+	for rows.Next() {
+		var r MaintenanceWindowRow
+		var labelsJSON []byte
+		if err := rows.Scan(&r.Name, &r.Schedule, &r.Duration, &r.Timezone, &r.ServerID, &r.Tag, &labelsJSON, &r.Comment, &r.CreatedAt); err != nil {
+			return nil, err
+		}
+		if r.Labels, err = unmarshalLabels(labelsJSON); err != nil {
+			return nil, err
+		}
+		results = append(results, r)
+	}
+	return results, rows.Err()
+}
+
+// SaveAnomalyScores пишет оценки аномалий одной командой COPY
+func (s *Storage) SaveAnomalyScores(ctx context.Context, scores []AnomalyScoreRow) error {
+	if len(scores) == 0 {
+		return nil
+	}
+	rows := make([][]interface{}, 0, len(scores))
+	for _, r := range scores {
+		labelsJSON, err := marshalLabels(r.Labels)
+		if err != nil {
+			return err
+		}
+		rows = append(rows, []interface{}{
+			r.ServerID, r.Tag, r.Metric, labelsJSON, r.Value, r.Expected, r.StdDev, r.Score, r.Anomalous, r.CreatedAt,
+		})
+	}
+	conn, err := s.db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	return conn.Raw(func(driverConn any) error {
+		pc := driverConn.(*stdlib.Conn).Conn()
+		_, err := pc.CopyFrom(ctx, pgx.Identifier{"anomaly_scores"},
+			[]string{"server_id", "tag", "metric", "labels", "value", "expected", "stddev", "score", "anomalous", "created_at"},
+			pgx.CopyFromRows(rows),
+		)
+		return err
+	})
+}
+
+// LoadAnomalyScores возвращает последние оценки (фильтры необязательны; anomalousOnly — только аномалии)
+func (s *Storage) LoadAnomalyScores(ctx context.Context, serverID, tag, metric string, anomalousOnly bool, limit int64) ([]AnomalyScoreRow, error) {
+	query := `
+SELECT id, server_id, tag, metric, labels, value, expected, stddev, score, anomalous, created_at
+FROM anomaly_scores
+`
+	var args []interface{}
+	var conditions []string
+	if serverID != "" {
+		args = append(args, serverID)
+		conditions = append(conditions, fmt.Sprintf("server_id = $%d", len(args)))
+	}
+	if tag != "" {
+		args = append(args, tag)
+		conditions = append(conditions, fmt.Sprintf("tag = $%d", len(args)))
+	}
+	if metric != "" {
+		args = append(args, metric)
+		conditions = append(conditions, fmt.Sprintf("metric = $%d", len(args)))
+	}
+	if anomalousOnly {
+		conditions = append(conditions, "anomalous")
+	}
+	if len(conditions) > 0 {
+		query += " WHERE " + joinConditions(conditions, " AND ")
+	}
+	args = append(args, limit)
+	query += fmt.Sprintf(" ORDER BY created_at DESC, id DESC LIMIT $%d::bigint", len(args))
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var results []AnomalyScoreRow
+	for rows.Next() {
+		var r AnomalyScoreRow
+		var labelsJSON []byte
+		if err := rows.Scan(&r.ID, &r.ServerID, &r.Tag, &r.Metric, &labelsJSON, &r.Value, &r.Expected, &r.StdDev,
+			&r.Score, &r.Anomalous, &r.CreatedAt); err != nil {
+			return nil, err
+		}
+		if r.Labels, err = unmarshalLabels(labelsJSON); err != nil {
+			return nil, err
+		}
+		results = append(results, r)
+	}
+	return results, rows.Err()
+}
+
+// SaveAnomalyBaselines создаёт или обновляет базовые линии в одной транзакции
+func (s *Storage) SaveAnomalyBaselines(ctx context.Context, baselines []AnomalyBaselineRow) error {
+	if len(baselines) == 0 {
+		return nil
+	}
+	const query = `
+INSERT INTO anomaly_baselines (key, server_id, tag, metric, labels, state, updated_at)
+VALUES ($1, $2, $3, $4, $5, $6, $7)
+ON CONFLICT (key) DO UPDATE SET
+  labels = EXCLUDED.labels,
+  state = EXCLUDED.state,
+  updated_at = EXCLUDED.updated_at
+`
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	stmt, err := tx.PrepareContext(ctx, query)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+	for _, b := range baselines {
+		labelsJSON, err := marshalLabels(b.Labels)
+		if err != nil {
+			return err
+		}
+		if _, err := stmt.ExecContext(ctx, b.Key, b.ServerID, b.Tag, b.Metric, labelsJSON, string(b.State), b.UpdatedAt); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// LoadAnomalyBaselines возвращает сохранённые базовые линии, обновлённые после since
+func (s *Storage) LoadAnomalyBaselines(ctx context.Context, since time.Time) ([]AnomalyBaselineRow, error) {
+	rows, err := s.db.QueryContext(ctx, `
+SELECT key, server_id, tag, metric, labels, state, updated_at
+FROM anomaly_baselines WHERE updated_at > $1`, since)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var results []AnomalyBaselineRow
+	for rows.Next() {
+		var r AnomalyBaselineRow
+		var labelsJSON, state []byte
+		if err := rows.Scan(&r.Key, &r.ServerID, &r.Tag, &r.Metric, &labelsJSON, &state, &r.UpdatedAt); err != nil {
+			return nil, err
+		}
+		if r.Labels, err = unmarshalLabels(labelsJSON); err != nil {
+			return nil, err
+		}
+		r.State = state
+		results = append(results, r)
+	}
+	return results, rows.Err()
+}
+
+// TrendRow — линейная регрессия значения метрики по времени для сервера/тега
+type TrendRow struct {
+	ServerID string
+	Tag      string
+	Points   int64
+	// Наклон (единиц в секунду) и значение прямой в момент Since
+	Slope     float64
+	Intercept float64
+	// Коэффициент детерминации (1, если значения не менялись)
+	R2        float64
+	Since     time.Time
+	First     time.Time
+	Last      time.Time
+	LastValue float64
+}
+
+// LoadTrends строит по каждому серверу/тегу линейную регрессию поля metrics по времени начиная с since.
+// Регрессия считается в SQL (regr_slope/regr_intercept), время — в секундах от since.
+func (s *Storage) LoadTrends(ctx context.Context, metric string, since time.Time) ([]TrendRow, error) {
+	column, ok := metricColumns[metric]
+	if !ok {
+		return nil, fmt.Errorf("unknown metric %q", metric)
+	}
+	query := fmt.Sprintf(`
+SELECT server_id, tag, count(*), regr_slope(v, x), regr_intercept(v, x), regr_r2(v, x),
+	min(t), max(t), (array_agg(v ORDER BY t DESC))[1]
+FROM (
+	SELECT server_id, COALESCE(tag, '') AS tag, %s AS v, created_at AS t,
+		extract(epoch FROM created_at - $1::timestamptz)::float8 AS x
+	FROM metrics
+	WHERE created_at >= $1
+) m
+GROUP BY server_id, tag
+HAVING count(*) >= 2 AND regr_slope(v, x) IS NOT NULL
+ORDER BY server_id, tag
+`, column)
+	rows, err := s.db.QueryContext(ctx, query, since)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var result []TrendRow
+	for rows.Next() {
+		r := TrendRow{Since: since}
+		if err := rows.Scan(&r.ServerID, &r.Tag, &r.Points, &r.Slope, &r.Intercept, &r.R2, &r.First, &r.Last, &r.LastValue); err != nil {
+			return nil, err
+		}
+		result = append(result, r)
+	}
+	return result, rows.Err()
 }
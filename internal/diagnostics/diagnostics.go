@@ -0,0 +1,197 @@
+package diagnostics
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Placeholder в allowlist, вместо которого допускается один безопасный аргумент
+const Placeholder = "{}"
+
+// safeArgRe — допустимые значения для Placeholder (имена юнитов, интерфейсов и т.п.)
+var safeArgRe = regexp.MustCompile(`^[A-Za-z0-9@._:-]+$`)
+
+// Allowlist — команды, которые агент готов выполнить.
+// Каждая запись — командная строка, например "df -i" или "journalctl -n 200 -u {}".
+type Allowlist struct {
+	entries [][]string
+}
+
+// DefaultAllowlist — набор по умолчанию, если файл не задан
+var DefaultAllowlist = []string{
+	"ss -s",
+	"df -h",
+	"df -i",
+	"uptime",
+	"free -m",
+	"journalctl -n 200 -u {}",
+}
+
+// NewAllowlist строит allowlist из строк
+func NewAllowlist(lines []string) *Allowlist {
+	a := &Allowlist{}
+	for _, line := range lines {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		a.entries = append(a.entries, strings.Fields(line))
+	}
+	return a
+}
+
+// LoadAllowlist читает allowlist из файла (одна команда на строку, # — комментарий)
+func LoadAllowlist(path string) (*Allowlist, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open allowlist: %w", err)
+	}
+	defer f.Close()
+
+	var lines []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		lines = append(lines, scanner.Text())
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read allowlist: %w", err)
+	}
+	return NewAllowlist(lines), nil
+}
+
+// Match разбирает команду и проверяет её по allowlist; возвращает argv для запуска.
+// Оболочка не используется, поэтому спецсимволы не интерпретируются.
+func (a *Allowlist) Match(command string) ([]string, bool) {
+	argv := strings.Fields(command)
+	if len(argv) == 0 {
+		return nil, false
+	}
+	for _, entry := range a.entries {
+		if matchEntry(entry, argv) {
+			return argv, true
+		}
+	}
+	return nil, false
+}
+
+func matchEntry(entry, argv []string) bool {
+	if len(entry) != len(argv) {
+		return false
+	}
+	for i, tok := range entry {
+		if tok == Placeholder {
+			if !safeArgRe.MatchString(argv[i]) || strings.HasPrefix(argv[i], "-") {
+				return false
+			}
+			continue
+		}
+		if tok != argv[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// Result — итог выполнения команды
+type Result struct {
+	ExitCode  int
+	Truncated bool
+	TimedOut  bool
+	Err       error
+}
+
+// Runner выполняет команды из allowlist с таймаутом и ограничением вывода
+type Runner struct {
+	Allowlist *Allowlist
+	Timeout   time.Duration
+	MaxOutput int
+	ChunkSize int
+}
+
+// ErrNotAllowed — команды нет в allowlist
+var ErrNotAllowed = errors.New("command is not in the agent allowlist")
+
+// Run выполняет команду; вывод (stdout и stderr) передаётся в onChunk частями
+func (r *Runner) Run(ctx context.Context, command string, onChunk func([]byte) error) Result {
+	argv, ok := r.Allowlist.Match(command)
+	if !ok {
+		return Result{ExitCode: -1, Err: ErrNotAllowed}
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, r.Timeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, argv[0], argv[1:]...)
+	// Не ждём вечно дочерние процессы, которые держат pipe после kill
+	cmd.WaitDelay = time.Second
+	pr, pw := io.Pipe()
+	cmd.Stdout = pw
+	cmd.Stderr = pw
+
+	if err := cmd.Start(); err != nil {
+		return Result{ExitCode: -1, Err: err}
+	}
+
+	// Читаем вывод, пока процесс работает
+	var (
+		wg        sync.WaitGroup
+		truncated bool
+		sendErr   error
+	)
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		buf := make([]byte, r.ChunkSize)
+		total := 0
+		for {
+			n, err := pr.Read(buf)
+			if n > 0 && sendErr == nil && !truncated {
+				if total+n > r.MaxOutput {
+					n = r.MaxOutput - total
+					truncated = true
+					// Остальной вывод не нужен — завершаем процесс
+					cancel()
+				}
+				total += n
+				if n > 0 {
+					sendErr = onChunk(append([]byte(nil), buf[:n]...))
+					if sendErr != nil {
+						// Вывод некуда отправлять — завершаем процесс
+						cancel()
+					}
+				}
+			}
+			if err != nil {
+				return
+			}
+		}
+	}()
+
+	waitErr := cmd.Wait()
+	pw.Close()
+	wg.Wait()
+
+	res := Result{ExitCode: cmd.ProcessState.ExitCode(), Truncated: truncated}
+	switch {
+	case ctx.Err() == context.DeadlineExceeded:
+		res.TimedOut = true
+		res.Err = fmt.Errorf("command timed out after %s", r.Timeout)
+	case sendErr != nil:
+		res.Err = sendErr
+	case waitErr != nil:
+		var exitErr *exec.ExitError
+		if !errors.As(waitErr, &exitErr) {
+			res.Err = waitErr
+		}
+	}
+	return res
+}
@@ -0,0 +1,92 @@
+package labels
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Labels — произвольные пары ключ/значение (env=prod, role=db, dc=fra1)
+type Labels map[string]string
+
+// keyRe — допустимые имена ключей (совместимы с именами лейблов Prometheus)
+var keyRe = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+
+// Parse разбирает строку вида "env=prod,role=db"
+func Parse(s string) (Labels, error) {
+	out := Labels{}
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return out, nil
+	}
+	for _, pair := range strings.Split(s, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		k, v, ok := strings.Cut(pair, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid label %q: expected key=value", pair)
+		}
+		k = strings.TrimSpace(k)
+		if err := ValidateKey(k); err != nil {
+			return nil, err
+		}
+		out[k] = strings.TrimSpace(v)
+	}
+	return out, nil
+}
+
+// ValidateKey проверяет имя ключа
+func ValidateKey(k string) error {
+	if !keyRe.MatchString(k) {
+		return fmt.Errorf("invalid label key %q", k)
+	}
+	// server_id и tag уже являются измерениями, переопределять их нельзя
+	if k == "server_id" || k == "tag" || strings.HasPrefix(k, "__") {
+		return fmt.Errorf("reserved label key %q", k)
+	}
+	return nil
+}
+
+// Merge объединяет наборы лейблов; значения из последующих наборов перекрывают предыдущие
+func Merge(sets ...map[string]string) Labels {
+	out := Labels{}
+	for _, set := range sets {
+		for k, v := range set {
+			out[k] = v
+		}
+	}
+	return out
+}
+
+// Match возвращает true, если l содержит все пары из selector
+func Match(l, selector map[string]string) bool {
+	for k, v := range selector {
+		if got, ok := l[k]; !ok || got != v {
+			return false
+		}
+	}
+	return true
+}
+
+// Keys возвращает отсортированный список ключей
+func (l Labels) Keys() []string {
+	keys := make([]string, 0, len(l))
+	for k := range l {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// String возвращает каноническое представление "k1=v1,k2=v2"
+func (l Labels) String() string {
+	keys := l.Keys()
+	parts := make([]string, 0, len(keys))
+	for _, k := range keys {
+		parts = append(parts, k+"="+l[k])
+	}
+	return strings.Join(parts, ",")
+}
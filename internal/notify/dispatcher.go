@@ -0,0 +1,408 @@
+package notify
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/vovakirdan/gohub/internal/config"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Параметры канала по умолчанию, если в конфиге не заданы
+const (
+	defaultTimeout         = 10 * time.Second
+	defaultMaxRetries      = 3
+	defaultRetryBackoff    = time.Second
+	defaultMaxRetryBackoff = 30 * time.Second
+	defaultRatePeriod      = time.Minute
+	defaultQueueSize       = 100
+)
+
+var (
+	notificationsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "gohub_notifications_total",
+		Help: "Alert notifications by channel and result (sent, failed, dropped)",
+	}, []string{"channel", "result"})
+	notificationRetries = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "gohub_notification_retries_total",
+		Help: "Notification delivery attempts retried after an error",
+	}, []string{"channel"})
+	notificationDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "gohub_notification_duration_seconds",
+		Help:    "Duration of one notification delivery attempt",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"channel"})
+)
+
+func init() {
+	prometheus.MustRegister(notificationsTotal, notificationRetries, notificationDuration)
+}
+
+// ChannelInfo — описание канала для API
+type ChannelInfo struct {
+	Name         string `json:"name"`
+	Type         string `json:"type"`
+	SendResolved bool   `json:"send_resolved"`
+	QueueLength  int    `json:"queue_length"`
+}
+
+// limiter — ведро токенов: не больше limit сообщений за period
+type limiter struct {
+	mu     sync.Mutex
+	limit  float64
+	per    time.Duration
+	tokens float64
+	last   time.Time
+}
+
+func newLimiter(limit int, per time.Duration) *limiter {
+	if limit <= 0 {
+		return nil
+	}
+	return &limiter{limit: float64(limit), per: per, tokens: float64(limit), last: time.Now()}
+}
+
+// wait ждёт свободный токен; nil-ограничитель пропускает сразу
+func (l *limiter) wait(ctx context.Context) error {
+	if l == nil {
+		return nil
+	}
+	for {
+		l.mu.Lock()
+		now := time.Now()
+		l.tokens += now.Sub(l.last).Seconds() * l.limit / l.per.Seconds()
+		if l.tokens > l.limit {
+			l.tokens = l.limit
+		}
+		l.last = now
+		if l.tokens >= 1 {
+			l.tokens--
+			l.mu.Unlock()
+			return nil
+		}
+		delay := time.Duration((1 - l.tokens) * float64(l.per) / l.limit)
+		l.mu.Unlock()
+
+		t := time.NewTimer(delay)
+		select {
+		case <-t.C:
+		case <-ctx.Done():
+			t.Stop()
+			return ctx.Err()
+		}
+	}
+}
+
+// channel — канал с шаблонами, очередью, повторами и ограничением частоты
+type channel struct {
+	Notifier
+	tmpl         *templates
+	sendResolved bool
+
+	timeout         time.Duration
+	maxRetries      int
+	retryBackoff    time.Duration
+	maxRetryBackoff time.Duration
+	limiter         *limiter
+
+	queue chan *Notification
+}
+
+func newChannel(cfg config.NotifyChannelConfig) (*channel, error) {
+	n, err := newNotifier(cfg)
+	if err != nil {
+		return nil, err
+	}
+	tmpl, err := newTemplates(cfg)
+	if err != nil {
+		return nil, err
+	}
+	c := &channel{
+		Notifier:        n,
+		tmpl:            tmpl,
+		sendResolved:    cfg.SendResolved,
+		timeout:         cfg.Timeout,
+		maxRetries:      cfg.MaxRetries,
+		retryBackoff:    cfg.RetryBackoff,
+		maxRetryBackoff: cfg.MaxRetryBackoff,
+	}
+	if c.timeout <= 0 {
+		c.timeout = defaultTimeout
+	}
+	if c.maxRetries == 0 {
+		c.maxRetries = defaultMaxRetries
+	}
+	if c.maxRetries < 0 {
+		c.maxRetries = 0
+	}
+	if c.retryBackoff <= 0 {
+		c.retryBackoff = defaultRetryBackoff
+	}
+	if c.maxRetryBackoff <= 0 {
+		c.maxRetryBackoff = defaultMaxRetryBackoff
+	}
+	period := cfg.RatePeriod
+	if period <= 0 {
+		period = defaultRatePeriod
+	}
+	c.limiter = newLimiter(cfg.RateLimit, period)
+	size := cfg.QueueSize
+	if size <= 0 {
+		size = defaultQueueSize
+	}
+	c.queue = make(chan *Notification, size)
+	return c, nil
+}
+
+// deliver отправляет уведомление с учётом ограничения частоты, повторяя при временных ошибках
+func (c *channel) deliver(ctx context.Context, n *Notification) error {
+	msg, err := c.tmpl.render(n)
+	if err != nil {
+		return err
+	}
+	if err := c.limiter.wait(ctx); err != nil {
+		return err
+	}
+	backoff := c.retryBackoff
+	for attempt := 0; ; attempt++ {
+		actx, cancel := context.WithTimeout(ctx, c.timeout)
+		start := time.Now()
+		err = c.Notify(actx, msg)
+		cancel()
+		notificationDuration.WithLabelValues(c.Name()).Observe(time.Since(start).Seconds())
+		if err == nil || isPermanent(err) || attempt >= c.maxRetries {
+			return err
+		}
+		log.Printf("Notify %s: attempt %d/%d failed, retrying in %s: %v", c.Name(), attempt+1, c.maxRetries+1, backoff, err)
+		notificationRetries.WithLabelValues(c.Name()).Inc()
+		t := time.NewTimer(backoff)
+		select {
+		case <-t.C:
+		case <-ctx.Done():
+			t.Stop()
+			return fmt.Errorf("%w (last error: %v)", ctx.Err(), err)
+		}
+		backoff *= 2
+		if backoff > c.maxRetryBackoff {
+			backoff = c.maxRetryBackoff
+		}
+	}
+}
+
+// route — маршрут из конфига
+type route struct {
+	match    map[string]string
+	channels []string
+}
+
+// matches сравнивает поля и лейблы уведомления с условиями маршрута
+func (r *route) matches(n *Notification) bool {
+	for k, want := range r.match {
+		var got string
+		switch k {
+		case "rule":
+			got = n.Rule
+		case "severity":
+			got = n.Severity
+		case "state":
+			got = n.State
+		case "server_id":
+			got = n.ServerID
+		case "tag":
+			got = n.Tag
+		default:
+			got = n.Labels[k]
+		}
+		if got != want {
+			return false
+		}
+	}
+	return true
+}
+
+// Dispatcher раздаёт уведомления по каналам: у каждого канала своя очередь и горутина,
+// поэтому медленный канал не задерживает остальные
+type Dispatcher struct {
+	channels map[string]*channel
+	routes   []route
+
+	// closed защищён mu: после закрытия очереди запись в них запрещена
+	mu     sync.RWMutex
+	closed bool
+	wg     sync.WaitGroup
+	// отменяет незавершённые отправки, если при остановке не успели
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+// New создаёт каналы и маршруты из конфига
+func New(cfg config.NotifyConfig) (*Dispatcher, error) {
+	d := &Dispatcher{channels: make(map[string]*channel, len(cfg.Channels))}
+	d.ctx, d.cancel = context.WithCancel(context.Background())
+	for _, cc := range cfg.Channels {
+		if cc.Name == "" {
+			return nil, fmt.Errorf("notify channel without name")
+		}
+		if _, dup := d.channels[cc.Name]; dup {
+			return nil, fmt.Errorf("duplicate notify channel %q", cc.Name)
+		}
+		c, err := newChannel(cc)
+		if err != nil {
+			return nil, fmt.Errorf("notify channel %q: %w", cc.Name, err)
+		}
+		d.channels[cc.Name] = c
+	}
+	for i, rc := range cfg.Routes {
+		if err := d.CheckChannels(rc.Channels); err != nil {
+			return nil, fmt.Errorf("notify route %d: %w", i, err)
+		}
+		d.routes = append(d.routes, route{match: rc.Match, channels: rc.Channels})
+	}
+	return d, nil
+}
+
+// Start запускает горутины каналов
+func (d *Dispatcher) Start() {
+	for _, c := range d.channels {
+		d.wg.Add(1)
+		go d.worker(c)
+	}
+}
+
+func (d *Dispatcher) worker(c *channel) {
+	defer d.wg.Done()
+	for n := range c.queue {
+		if err := c.deliver(d.ctx, n); err != nil {
+			notificationsTotal.WithLabelValues(c.Name(), "failed").Inc()
+			log.Printf("Notify %s: %s %s for %s/%s not delivered: %v", c.Name(), n.Rule, n.State, n.ServerID, n.Tag, err)
+			continue
+		}
+		notificationsTotal.WithLabelValues(c.Name(), "sent").Inc()
+	}
+}
+
+// CheckChannels проверяет, что все каналы есть в конфиге
+func (d *Dispatcher) CheckChannels(names []string) error {
+	for _, name := range names {
+		if _, ok := d.channels[name]; !ok {
+			return fmt.Errorf("%w: %q", ErrUnknownChannel, name)
+		}
+	}
+	return nil
+}
+
+// Route возвращает каналы уведомления: свои каналы правила, иначе все подходящие маршруты
+func (d *Dispatcher) Route(n *Notification, ruleChannels []string) []string {
+	if len(ruleChannels) > 0 {
+		return ruleChannels
+	}
+	seen := make(map[string]bool)
+	var result []string
+	for i := range d.routes {
+		if !d.routes[i].matches(n) {
+			continue
+		}
+		for _, name := range d.routes[i].channels {
+			if !seen[name] {
+				seen[name] = true
+				result = append(result, name)
+			}
+		}
+	}
+	return result
+}
+
+// Dispatch ставит уведомление в очереди каналов, не дожидаясь отправки.
+// Закрытия оповещений получают только каналы с send_resolved.
+func (d *Dispatcher) Dispatch(n Notification, ruleChannels []string, resolved bool) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	if d.closed {
+		return
+	}
+	for _, name := range d.Route(&n, ruleChannels) {
+		c, ok := d.channels[name]
+		if !ok || (resolved && !c.sendResolved) {
+			continue
+		}
+		select {
+		case c.queue <- &n:
+		default:
+			notificationsTotal.WithLabelValues(name, "dropped").Inc()
+			log.Printf("Notify %s: queue is full, dropping %s %s for %s/%s", name, n.Rule, n.State, n.ServerID, n.Tag)
+		}
+	}
+}
+
+// Test синхронно отправляет пробное уведомление в канал
+func (d *Dispatcher) Test(ctx context.Context, name string) error {
+	c, ok := d.channels[name]
+	if !ok {
+		return fmt.Errorf("%w: %q", ErrUnknownChannel, name)
+	}
+	now := time.Now()
+	n := &Notification{
+		Rule:        "test",
+		Severity:    "info",
+		State:       "firing",
+		ServerID:    "gohub",
+		Metric:      "test",
+		Annotations: map[string]string{"summary": "Test notification from GoHub"},
+		StartedAt:   now,
+		Timestamp:   now,
+		Test:        true,
+	}
+	if err := c.deliver(ctx, n); err != nil {
+		notificationsTotal.WithLabelValues(name, "failed").Inc()
+		return err
+	}
+	notificationsTotal.WithLabelValues(name, "sent").Inc()
+	return nil
+}
+
+// Channels возвращает каналы, отсортированные по имени
+func (d *Dispatcher) Channels() []ChannelInfo {
+	result := make([]ChannelInfo, 0, len(d.channels))
+	for _, c := range d.channels {
+		result = append(result, ChannelInfo{
+			Name:         c.Name(),
+			Type:         c.Type(),
+			SendResolved: c.sendResolved,
+			QueueLength:  len(c.queue),
+		})
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Name < result[j].Name })
+	return result
+}
+
+// Close перестаёт принимать уведомления и дожидается отправки очередей.
+// Если ctx истекает раньше, незавершённые отправки прерываются.
+func (d *Dispatcher) Close(ctx context.Context) {
+	d.mu.Lock()
+	if d.closed {
+		d.mu.Unlock()
+		return
+	}
+	d.closed = true
+	for _, c := range d.channels {
+		close(c.queue)
+	}
+	d.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		d.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-ctx.Done():
+		log.Printf("Notification queues did not drain in time (%v)", ctx.Err())
+	}
+	d.cancel()
+}
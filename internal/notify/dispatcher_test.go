@@ -0,0 +1,123 @@
+package notify
+
+import (
+	"context"
+	"errors"
+	"net/http/httptest"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/vovakirdan/gohub/internal/config"
+)
+
+func TestLimiterPacing(t *testing.T) {
+	if err := (*limiter)(nil).wait(context.Background()); err != nil {
+		t.Fatalf("nil limiter: %v", err)
+	}
+	if newLimiter(0, time.Second) != nil {
+		t.Fatal("rate_limit 0 must disable the limiter")
+	}
+
+	// 2 сообщения за 100ms: два сразу, третье — через 50ms
+	l := newLimiter(2, 100*time.Millisecond)
+	start := time.Now()
+	for i := 0; i < 2; i++ {
+		if err := l.wait(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if elapsed := time.Since(start); elapsed > 20*time.Millisecond {
+		t.Fatalf("burst was delayed by %s", elapsed)
+	}
+	if err := l.wait(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed < 45*time.Millisecond {
+		t.Fatalf("third message was not paced: %s", elapsed)
+	}
+
+	// Ожидание прерывается вместе с контекстом
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := l.wait(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected deadline exceeded, got %v", err)
+	}
+}
+
+func TestDispatchRouting(t *testing.T) {
+	rec := &recorder{}
+	srv := httptest.NewServer(rec)
+	defer srv.Close()
+
+	webhook := func(name string, sendResolved bool) config.NotifyChannelConfig {
+		return config.NotifyChannelConfig{Name: name, Type: TypeWebhook, URL: srv.URL + "/" + name, SendResolved: sendResolved}
+	}
+	cfg := config.NotifyConfig{
+		Channels: []config.NotifyChannelConfig{webhook("oncall", true), webhook("team", false), webhook("audit", false)},
+		Routes: []config.NotifyRouteConfig{
+			{Match: map[string]string{"severity": "critical"}, Channels: []string{"oncall", "team"}},
+			{Match: map[string]string{"env": "prod"}, Channels: []string{"team"}},
+		},
+	}
+
+	critical := Notification{Rule: "cpu", Severity: "critical", State: "firing", Labels: map[string]string{"env": "prod"}}
+	warning := Notification{Rule: "disk", Severity: "warning", State: "firing", Labels: map[string]string{"env": "prod"}}
+	staging := Notification{Rule: "disk", Severity: "warning", State: "firing", Labels: map[string]string{"env": "staging"}}
+	cases := []struct {
+		name     string
+		n        Notification
+		channels []string
+		resolved bool
+		want     []string
+	}{
+		{"all matching routes, no duplicates", critical, nil, false, []string{"/oncall", "/team"}},
+		{"label route", warning, nil, false, []string{"/team"}},
+		{"no route", staging, nil, false, nil},
+		{"rule channels override routes", critical, []string{"audit"}, false, []string{"/audit"}},
+		{"resolved only to send_resolved", critical, nil, true, []string{"/oncall"}},
+		{"resolved dropped without send_resolved", warning, nil, true, nil},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			d, err := New(cfg)
+			if err != nil {
+				t.Fatalf("New: %v", err)
+			}
+			rec.mu.Lock()
+			rec.paths = nil
+			rec.mu.Unlock()
+
+			d.Start()
+			d.Dispatch(tc.n, tc.channels, tc.resolved)
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			d.Close(ctx)
+
+			rec.mu.Lock()
+			got := append([]string(nil), rec.paths...)
+			rec.mu.Unlock()
+			sort.Strings(got)
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Fatalf("delivered to %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestDispatchQueueFull(t *testing.T) {
+	d, err := New(config.NotifyConfig{
+		Channels: []config.NotifyChannelConfig{{Name: "hook", Type: TypeWebhook, URL: "http://127.0.0.1:1", QueueSize: 1}},
+	})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	// Без Start очередь не разбирается: второе уведомление теряется, а не блокирует Dispatch
+	n := Notification{Rule: "cpu", State: "firing"}
+	d.Dispatch(n, []string{"hook"}, false)
+	d.Dispatch(n, []string{"hook"}, false)
+	if got := d.Channels()[0].QueueLength; got != 1 {
+		t.Fatalf("expected 1 queued notification, got %d", got)
+	}
+}
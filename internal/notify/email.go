@@ -0,0 +1,133 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"mime"
+	"mime/quotedprintable"
+	"net"
+	"net/smtp"
+	"net/textproto"
+	"strings"
+	"time"
+
+	"github.com/vovakirdan/gohub/internal/config"
+)
+
+// email отправляет письмо через SMTP; тема — заголовок сообщения
+type email struct {
+	name               string
+	addr               string
+	host               string
+	username           string
+	password           string
+	from               string
+	to                 []string
+	implicitTLS        bool
+	insecureSkipVerify bool
+}
+
+func newEmail(cfg config.NotifyChannelConfig) (*email, error) {
+	if cfg.SMTPAddr == "" || cfg.From == "" || len(cfg.To) == 0 {
+		return nil, errors.New("smtp_addr, from and to are required")
+	}
+	host, _, err := net.SplitHostPort(cfg.SMTPAddr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid smtp_addr: %w", err)
+	}
+	return &email{
+		name:               cfg.Name,
+		addr:               cfg.SMTPAddr,
+		host:               host,
+		username:           cfg.Username,
+		password:           cfg.Password,
+		from:               cfg.From,
+		to:                 cfg.To,
+		implicitTLS:        cfg.TLS,
+		insecureSkipVerify: cfg.InsecureSkipVerify,
+	}, nil
+}
+
+func (e *email) Name() string { return e.name }
+func (e *email) Type() string { return TypeEmail }
+
+func (e *email) Notify(ctx context.Context, msg *Message) error {
+	tlsCfg := &tls.Config{ServerName: e.host, InsecureSkipVerify: e.insecureSkipVerify}
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", e.addr)
+	if err != nil {
+		return err
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+	if e.implicitTLS {
+		conn = tls.Client(conn, tlsCfg)
+	}
+	c, err := smtp.NewClient(conn, e.host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer c.Close()
+
+	if ok, _ := c.Extension("STARTTLS"); ok && !e.implicitTLS {
+		if err := c.StartTLS(tlsCfg); err != nil {
+			return err
+		}
+	}
+	if e.username != "" {
+		// PlainAuth без TLS разрешён только для localhost
+		if err := c.Auth(smtp.PlainAuth("", e.username, e.password, e.host)); err != nil {
+			return smtpError(err)
+		}
+	}
+	if err := c.Mail(e.from); err != nil {
+		return smtpError(err)
+	}
+	for _, rcpt := range e.to {
+		if err := c.Rcpt(rcpt); err != nil {
+			return smtpError(err)
+		}
+	}
+	w, err := c.Data()
+	if err != nil {
+		return smtpError(err)
+	}
+	if _, err := w.Write(e.message(msg)); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return smtpError(err)
+	}
+	return c.Quit()
+}
+
+// message собирает письмо: заголовки и текст в quoted-printable
+func (e *email) message(msg *Message) []byte {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "From: %s\r\n", e.from)
+	fmt.Fprintf(&buf, "To: %s\r\n", strings.Join(e.to, ", "))
+	fmt.Fprintf(&buf, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", msg.Title))
+	fmt.Fprintf(&buf, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	buf.WriteString("MIME-Version: 1.0\r\n")
+	buf.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	buf.WriteString("Content-Transfer-Encoding: quoted-printable\r\n\r\n")
+	qp := quotedprintable.NewWriter(&buf)
+	qp.Write([]byte(strings.ReplaceAll(msg.Text, "\n", "\r\n")))
+	qp.Close()
+	buf.WriteString("\r\n")
+	return buf.Bytes()
+}
+
+// smtpError помечает ответы 5xx как неповторяемые (неверный адрес, отказ в авторизации)
+func smtpError(err error) error {
+	var terr *textproto.Error
+	if errors.As(err, &terr) && terr.Code >= 500 {
+		return Permanent(err)
+	}
+	return err
+}
@@ -0,0 +1,170 @@
+package notify
+
+import (
+	"context"
+	"encoding/base64"
+	"io"
+	"mime/quotedprintable"
+	"net"
+	"net/textproto"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/vovakirdan/gohub/internal/config"
+)
+
+// smtpStub — минимальный SMTP-сервер: отвечает на команды заданными кодами и запоминает письма
+type smtpStub struct {
+	ln net.Listener
+	// Ответы на команды (MAIL, RCPT, ...), если не 250
+	replies map[string]string
+
+	mu    sync.Mutex
+	conns int
+	auth  string
+	from  string
+	rcpts []string
+	data  string
+}
+
+func newSMTPStub(t *testing.T, replies map[string]string) *smtpStub {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &smtpStub{ln: ln, replies: replies}
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(conn)
+		}
+	}()
+	t.Cleanup(func() { ln.Close() })
+	return s
+}
+
+func (s *smtpStub) serve(conn net.Conn) {
+	defer conn.Close()
+	s.mu.Lock()
+	s.conns++
+	s.mu.Unlock()
+
+	tp := textproto.NewConn(conn)
+	tp.PrintfLine("220 stub ESMTP")
+	for {
+		line, err := tp.ReadLine()
+		if err != nil {
+			return
+		}
+		cmd, arg, _ := strings.Cut(line, " ")
+		cmd = strings.ToUpper(cmd)
+		if reply, ok := s.replies[cmd]; ok {
+			tp.PrintfLine("%s", reply)
+			continue
+		}
+		s.mu.Lock()
+		switch cmd {
+		case "EHLO", "HELO":
+			tp.PrintfLine("250-stub\r\n250 AUTH PLAIN")
+		case "AUTH":
+			s.auth = arg
+			tp.PrintfLine("235 ok")
+		case "MAIL":
+			s.from = arg
+			tp.PrintfLine("250 ok")
+		case "RCPT":
+			s.rcpts = append(s.rcpts, arg)
+			tp.PrintfLine("250 ok")
+		case "DATA":
+			tp.PrintfLine("354 go ahead")
+			data, _ := io.ReadAll(tp.DotReader())
+			s.data = string(data)
+			tp.PrintfLine("250 queued")
+		case "QUIT":
+			tp.PrintfLine("221 bye")
+			s.mu.Unlock()
+			return
+		default:
+			tp.PrintfLine("502 unknown command")
+		}
+		s.mu.Unlock()
+	}
+}
+
+func (s *smtpStub) connections() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.conns
+}
+
+func TestEmailSent(t *testing.T) {
+	stub := newSMTPStub(t, nil)
+	d := newTestDispatcher(t, config.NotifyChannelConfig{
+		Name: "mail", Type: TypeEmail, SMTPAddr: stub.ln.Addr().String(),
+		Username: "bot", Password: "pw", From: "gohub@example.com", To: []string{"ops@example.com", "dba@example.com"},
+		Title: "Сервер {{ .ServerID }}",
+	})
+	if err := d.Test(context.Background(), "mail"); err != nil {
+		t.Fatalf("Test: %v", err)
+	}
+
+	stub.mu.Lock()
+	defer stub.mu.Unlock()
+	if stub.from != "FROM:<gohub@example.com>" {
+		t.Errorf("unexpected MAIL %q", stub.from)
+	}
+	if strings.Join(stub.rcpts, ",") != "TO:<ops@example.com>,TO:<dba@example.com>" {
+		t.Errorf("unexpected RCPT %q", stub.rcpts)
+	}
+	_, cred, _ := strings.Cut(stub.auth, " ")
+	if plain, _ := base64.StdEncoding.DecodeString(cred); string(plain) != "\x00bot\x00pw" {
+		t.Errorf("unexpected AUTH %q", stub.auth)
+	}
+
+	header, body, ok := strings.Cut(stub.data, "\n\n")
+	if !ok {
+		t.Fatalf("no header separator in %q", stub.data)
+	}
+	if !strings.Contains(header, "Subject: =?utf-8?q?") || !strings.Contains(header, "To: ops@example.com, dba@example.com") {
+		t.Errorf("unexpected headers %q", header)
+	}
+	text, err := io.ReadAll(quotedprintable.NewReader(strings.NewReader(body)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(text), "summary: Test notification from GoHub") {
+		t.Errorf("unexpected body %q", text)
+	}
+}
+
+func TestEmailErrors(t *testing.T) {
+	cases := []struct {
+		name    string
+		replies map[string]string
+		conns   int
+	}{
+		// 5xx — неверный адрес, повтор не поможет
+		{"rejected recipient", map[string]string{"RCPT": "550 no such user"}, 1},
+		// 4xx — временный отказ, повторяется
+		{"temporary failure", map[string]string{"MAIL": "451 try again later"}, 3},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			stub := newSMTPStub(t, tc.replies)
+			d := newTestDispatcher(t, config.NotifyChannelConfig{
+				Name: "mail", Type: TypeEmail, SMTPAddr: stub.ln.Addr().String(), From: "gohub@example.com", To: []string{"ops@example.com"},
+			})
+			if err := d.Test(context.Background(), "mail"); err == nil {
+				t.Fatal("expected error")
+			}
+			if got := stub.connections(); got != tc.conns {
+				t.Fatalf("expected %d connection(s), got %d", tc.conns, got)
+			}
+		})
+	}
+}
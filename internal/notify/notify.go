@@ -0,0 +1,173 @@
+// Package notify доставляет уведомления об оповещениях по каналам: webhook, email (SMTP),
+// Slack-совместимый incoming webhook и Telegram-бот
+package notify
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/vovakirdan/gohub/internal/config"
+)
+
+// Типы каналов
+const (
+	TypeWebhook  = "webhook"
+	TypeEmail    = "email"
+	TypeSlack    = "slack"
+	TypeTelegram = "telegram"
+)
+
+// ErrUnknownChannel — канала с таким именем нет в конфиге
+var ErrUnknownChannel = errors.New("unknown notification channel")
+
+// Notification — событие оповещения, о котором нужно уведомить
+type Notification struct {
+	Rule        string            `json:"rule"`
+	Severity    string            `json:"severity"`
+	State       string            `json:"state"`
+	ServerID    string            `json:"server_id"`
+	Tag         string            `json:"tag"`
+	Metric      string            `json:"metric"`
+	Labels      map[string]string `json:"labels"`
+	Annotations map[string]string `json:"annotations"`
+	Value       float64           `json:"value"`
+	StartedAt   time.Time         `json:"started_at"`
+	Timestamp   time.Time         `json:"timestamp"`
+	// Пробное уведомление из /api/notify/test
+	Test bool `json:"test"`
+}
+
+// Message — уведомление с заголовком и текстом по шаблонам канала
+type Message struct {
+	Notification
+	Title string `json:"title"`
+	Text  string `json:"text"`
+}
+
+// Notifier — канал доставки. Notify делает одну попытку; повторы и ограничение
+// частоты выполняет Dispatcher.
+type Notifier interface {
+	Name() string
+	Type() string
+	Notify(ctx context.Context, msg *Message) error
+}
+
+// permanentError — ошибка, при которой повтор не поможет (например, 4xx от получателя)
+type permanentError struct{ err error }
+
+func (e *permanentError) Error() string { return e.err.Error() }
+func (e *permanentError) Unwrap() error { return e.err }
+
+// Permanent помечает ошибку как неповторяемую
+func Permanent(err error) error {
+	return &permanentError{err: err}
+}
+
+func isPermanent(err error) bool {
+	var p *permanentError
+	return errors.As(err, &p)
+}
+
+// Шаблоны по умолчанию
+const (
+	defaultTitleTemplate = `[{{ upper .State }}] {{ .Rule }}: {{ .ServerID }}{{ if .Tag }}/{{ .Tag }}{{ end }}`
+	defaultTextTemplate  = `{{ .Metric }} = {{ printf "%.2f" .Value }} (severity {{ .Severity }})
+{{ range $k, $v := .Annotations }}{{ $k }}: {{ $v }}
+{{ end }}Started: {{ .StartedAt.Format "2006-01-02 15:04:05 MST" }}`
+)
+
+var templateFuncs = template.FuncMap{
+	"upper": strings.ToUpper,
+	"lower": strings.ToLower,
+	"join":  strings.Join,
+}
+
+// templates — шаблоны заголовка и текста канала
+type templates struct {
+	title *template.Template
+	text  *template.Template
+}
+
+func newTemplates(cfg config.NotifyChannelConfig) (*templates, error) {
+	title, text := cfg.Title, cfg.Template
+	if title == "" {
+		title = defaultTitleTemplate
+	}
+	if text == "" {
+		text = defaultTextTemplate
+	}
+	t := &templates{}
+	var err error
+	if t.title, err = template.New("title").Funcs(templateFuncs).Option("missingkey=zero").Parse(title); err != nil {
+		return nil, fmt.Errorf("title template: %w", err)
+	}
+	if t.text, err = template.New("text").Funcs(templateFuncs).Option("missingkey=zero").Parse(text); err != nil {
+		return nil, fmt.Errorf("text template: %w", err)
+	}
+	return t, nil
+}
+
+// render готовит сообщение по шаблонам
+func (t *templates) render(n *Notification) (*Message, error) {
+	var title, text bytes.Buffer
+	if err := t.title.Execute(&title, n); err != nil {
+		return nil, fmt.Errorf("title template: %w", err)
+	}
+	if err := t.text.Execute(&text, n); err != nil {
+		return nil, fmt.Errorf("text template: %w", err)
+	}
+	return &Message{
+		Notification: *n,
+		Title:        strings.TrimSpace(title.String()),
+		Text:         strings.TrimSpace(text.String()),
+	}, nil
+}
+
+// postJSON отправляет JSON; ответы 4xx, кроме 429, повторять бессмысленно
+func postJSON(ctx context.Context, client *http.Client, url string, headers map[string]string, body []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return Permanent(err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		io.Copy(io.Discard, resp.Body)
+		return nil
+	}
+	snippet, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+	err = fmt.Errorf("%s: %s", resp.Status, strings.TrimSpace(string(snippet)))
+	if resp.StatusCode >= 400 && resp.StatusCode < 500 && resp.StatusCode != http.StatusTooManyRequests {
+		return Permanent(err)
+	}
+	return err
+}
+
+// newNotifier создаёт канал по типу из конфига
+func newNotifier(cfg config.NotifyChannelConfig) (Notifier, error) {
+	switch cfg.Type {
+	case TypeWebhook:
+		return newWebhook(cfg)
+	case TypeEmail:
+		return newEmail(cfg)
+	case TypeSlack:
+		return newSlack(cfg)
+	case TypeTelegram:
+		return newTelegram(cfg)
+	}
+	return nil, fmt.Errorf("unknown type %q: want %s, %s, %s or %s", cfg.Type, TypeWebhook, TypeEmail, TypeSlack, TypeTelegram)
+}
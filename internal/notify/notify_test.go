@@ -0,0 +1,163 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/vovakirdan/gohub/internal/config"
+)
+
+// recorder — HTTP-получатель, который отвечает статусами по очереди (последний повторяется) и запоминает запросы
+type recorder struct {
+	mu       sync.Mutex
+	statuses []int
+	paths    []string
+	bodies   []string
+	headers  []http.Header
+}
+
+func (r *recorder) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	body, _ := io.ReadAll(req.Body)
+	r.mu.Lock()
+	code := http.StatusOK
+	if len(r.statuses) > 0 {
+		code = r.statuses[min(len(r.paths), len(r.statuses)-1)]
+	}
+	r.paths = append(r.paths, req.URL.Path)
+	r.bodies = append(r.bodies, string(body))
+	r.headers = append(r.headers, req.Header.Clone())
+	r.mu.Unlock()
+	w.WriteHeader(code)
+	io.WriteString(w, http.StatusText(code))
+}
+
+func (r *recorder) requests() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return len(r.paths)
+}
+
+// newTestDispatcher создаёт диспетчер с быстрыми повторами
+func newTestDispatcher(t *testing.T, channels ...config.NotifyChannelConfig) *Dispatcher {
+	t.Helper()
+	for i := range channels {
+		channels[i].MaxRetries = 2
+		channels[i].RetryBackoff = time.Millisecond
+		channels[i].Timeout = 5 * time.Second
+	}
+	d, err := New(config.NotifyConfig{Channels: channels})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	return d
+}
+
+func TestHTTPChannels(t *testing.T) {
+	channels := []struct {
+		cfg   func(url string) config.NotifyChannelConfig
+		check func(t *testing.T, path, body string, header http.Header)
+	}{
+		{
+			cfg: func(url string) config.NotifyChannelConfig {
+				return config.NotifyChannelConfig{Type: TypeWebhook, URL: url + "/hook", Headers: map[string]string{"X-Token": "secret"}}
+			},
+			check: func(t *testing.T, path, body string, header http.Header) {
+				var msg map[string]any
+				if err := json.Unmarshal([]byte(body), &msg); err != nil {
+					t.Fatalf("webhook body: %v", err)
+				}
+				if path != "/hook" || header.Get("X-Token") != "secret" || header.Get("Content-Type") != "application/json" {
+					t.Errorf("unexpected request %s %v", path, header)
+				}
+				if msg["rule"] != "test" || msg["title"] != "[FIRING] test: gohub" || msg["test"] != true {
+					t.Errorf("unexpected webhook body %s", body)
+				}
+			},
+		},
+		{
+			cfg: func(url string) config.NotifyChannelConfig {
+				return config.NotifyChannelConfig{Type: TypeSlack, URL: url + "/slack"}
+			},
+			check: func(t *testing.T, path, body string, _ http.Header) {
+				var msg map[string]string
+				if err := json.Unmarshal([]byte(body), &msg); err != nil {
+					t.Fatalf("slack body: %v", err)
+				}
+				if path != "/slack" || !strings.HasPrefix(msg["text"], "*[FIRING] test: gohub*\n") {
+					t.Errorf("unexpected slack request %s %s", path, body)
+				}
+			},
+		},
+		{
+			cfg: func(url string) config.NotifyChannelConfig {
+				return config.NotifyChannelConfig{Type: TypeTelegram, URL: url + "/", BotToken: "123:abc", ChatID: "-100"}
+			},
+			check: func(t *testing.T, path, body string, _ http.Header) {
+				var msg map[string]any
+				if err := json.Unmarshal([]byte(body), &msg); err != nil {
+					t.Fatalf("telegram body: %v", err)
+				}
+				if path != "/bot123:abc/sendMessage" || msg["chat_id"] != "-100" ||
+					!strings.HasPrefix(msg["text"].(string), "[FIRING] test: gohub\n\n") {
+					t.Errorf("unexpected telegram request %s %s", path, body)
+				}
+			},
+		},
+	}
+	cases := []struct {
+		name     string
+		statuses []int
+		requests int
+		ok       bool
+	}{
+		{"sent", []int{http.StatusOK}, 1, true},
+		{"4xx is permanent", []int{http.StatusBadRequest}, 1, false},
+		{"5xx is retried", []int{http.StatusInternalServerError}, 3, false},
+		{"429 is retried", []int{http.StatusTooManyRequests}, 3, false},
+		{"sent after retry", []int{http.StatusServiceUnavailable, http.StatusTooManyRequests, http.StatusOK}, 3, true},
+	}
+	for _, ch := range channels {
+		for _, tc := range cases {
+			rec := &recorder{statuses: tc.statuses}
+			srv := httptest.NewServer(rec)
+			cfg := ch.cfg(srv.URL)
+			cfg.Name = "test"
+			t.Run(cfg.Type+"/"+tc.name, func(t *testing.T) {
+				d := newTestDispatcher(t, cfg)
+				err := d.Test(context.Background(), "test")
+				if (err == nil) != tc.ok {
+					t.Fatalf("expected ok=%t, got %v", tc.ok, err)
+				}
+				if got := rec.requests(); got != tc.requests {
+					t.Fatalf("expected %d request(s), got %d", tc.requests, got)
+				}
+				for i := range rec.paths {
+					ch.check(t, rec.paths[i], rec.bodies[i], rec.headers[i])
+				}
+			})
+			srv.Close()
+		}
+	}
+}
+
+func TestTelegramHidesToken(t *testing.T) {
+	srv := httptest.NewServer(http.NotFoundHandler())
+	url := srv.URL
+	srv.Close()
+
+	d := newTestDispatcher(t, config.NotifyChannelConfig{Name: "tg", Type: TypeTelegram, URL: url, BotToken: "123:secret", ChatID: "1"})
+	err := d.Test(context.Background(), "tg")
+	if err == nil {
+		t.Fatal("expected connection error")
+	}
+	if strings.Contains(err.Error(), "123:secret") {
+		t.Fatalf("bot token leaked into error: %v", err)
+	}
+}
@@ -0,0 +1,39 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/vovakirdan/gohub/internal/config"
+)
+
+// slack отправляет сообщение в Slack-совместимый incoming webhook (Slack, Mattermost, Rocket.Chat)
+type slack struct {
+	name   string
+	url    string
+	client *http.Client
+}
+
+func newSlack(cfg config.NotifyChannelConfig) (*slack, error) {
+	if cfg.URL == "" {
+		return nil, errors.New("url is required")
+	}
+	return &slack{name: cfg.Name, url: cfg.URL, client: &http.Client{}}, nil
+}
+
+func (s *slack) Name() string { return s.name }
+func (s *slack) Type() string { return TypeSlack }
+
+func (s *slack) Notify(ctx context.Context, msg *Message) error {
+	text := msg.Text
+	if msg.Title != "" {
+		text = "*" + msg.Title + "*\n" + text
+	}
+	body, err := json.Marshal(map[string]string{"text": text})
+	if err != nil {
+		return Permanent(err)
+	}
+	return postJSON(ctx, s.client, s.url, nil, body)
+}
@@ -0,0 +1,64 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/vovakirdan/gohub/internal/config"
+)
+
+// Адрес Bot API по умолчанию
+const defaultTelegramURL = "https://api.telegram.org"
+
+// telegram отправляет сообщение через Bot API (sendMessage)
+type telegram struct {
+	name   string
+	url    string
+	chatID string
+	client *http.Client
+}
+
+func newTelegram(cfg config.NotifyChannelConfig) (*telegram, error) {
+	if cfg.BotToken == "" || cfg.ChatID == "" {
+		return nil, errors.New("bot_token and chat_id are required")
+	}
+	base := cfg.URL
+	if base == "" {
+		base = defaultTelegramURL
+	}
+	return &telegram{
+		name:   cfg.Name,
+		url:    strings.TrimSuffix(base, "/") + "/bot" + cfg.BotToken + "/sendMessage",
+		chatID: cfg.ChatID,
+		client: &http.Client{},
+	}, nil
+}
+
+func (t *telegram) Name() string { return t.name }
+func (t *telegram) Type() string { return TypeTelegram }
+
+func (t *telegram) Notify(ctx context.Context, msg *Message) error {
+	text := msg.Text
+	if msg.Title != "" {
+		text = msg.Title + "\n\n" + text
+	}
+	body, err := json.Marshal(map[string]any{
+		"chat_id":                  t.chatID,
+		"text":                     text,
+		"disable_web_page_preview": true,
+	})
+	if err != nil {
+		return Permanent(err)
+	}
+	err = postJSON(ctx, t.client, t.url, nil, body)
+	// В адресе запроса токен бота: в журнал он попасть не должен
+	var uerr *url.Error
+	if errors.As(err, &uerr) {
+		uerr.URL = "<telegram api>"
+	}
+	return err
+}
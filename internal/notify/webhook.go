@@ -0,0 +1,36 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/vovakirdan/gohub/internal/config"
+)
+
+// webhook отправляет POST с JSON-уведомлением: поля оповещения, title и text
+type webhook struct {
+	name    string
+	url     string
+	headers map[string]string
+	client  *http.Client
+}
+
+func newWebhook(cfg config.NotifyChannelConfig) (*webhook, error) {
+	if cfg.URL == "" {
+		return nil, errors.New("url is required")
+	}
+	return &webhook{name: cfg.Name, url: cfg.URL, headers: cfg.Headers, client: &http.Client{}}, nil
+}
+
+func (w *webhook) Name() string { return w.name }
+func (w *webhook) Type() string { return TypeWebhook }
+
+func (w *webhook) Notify(ctx context.Context, msg *Message) error {
+	body, err := json.Marshal(msg)
+	if err != nil {
+		return Permanent(err)
+	}
+	return postJSON(ctx, w.client, w.url, w.headers, body)
+}
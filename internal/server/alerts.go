@@ -0,0 +1,544 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/vovakirdan/gohub/internal/api"
+	"github.com/vovakirdan/gohub/internal/config"
+	"github.com/vovakirdan/gohub/internal/db"
+	"github.com/vovakirdan/gohub/internal/labels"
+	"github.com/vovakirdan/gohub/internal/notify"
+	ws "github.com/vovakirdan/gohub/internal/websocket"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// Состояния оповещения
+const (
+	AlertPending  = "pending"
+	AlertFiring   = "firing"
+	AlertResolved = "resolved"
+)
+
+// Как часто по умолчанию переводить pending в firing и пересчитывать gohub_alerts
+const defaultAlertEvalInterval = 15 * time.Second
+
+// Очередь переходов на запись в БД и рассылку
+const alertUpdatesBuffer = 1024
+
+// Таймаут записи одного перехода
+const alertSaveTimeout = 5 * time.Second
+
+var (
+	alertsActive = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "gohub_alerts",
+		Help: "Active alerts by rule, severity and state",
+	}, []string{"rule", "severity", "state"})
+	alertTransitions = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "gohub_alert_transitions_total",
+		Help: "Alert state transitions by rule and new state",
+	}, []string{"rule", "state"})
+	alertUpdatesDropped = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "gohub_alert_updates_dropped_total",
+		Help: "Alert transitions not persisted because the update queue was full",
+	})
+)
+
+func init() {
+	prometheus.MustRegister(alertsActive, alertTransitions, alertUpdatesDropped)
+}
+
+// alertEngine вычисляет правила по принятым измерениям и ведёт активные оповещения
+type alertEngine struct {
+	rulesFile    string
+	evalInterval time.Duration
+
+	mu     sync.Mutex
+	rules  map[string]*alertRule
+	active map[string]*db.AlertRow // ключ — fingerprint
+	// Время последнего сэмпла, по которому вычислялось активное оповещение (ключ — fingerprint)
+	seen map[string]time.Time
+	// Время загрузки оповещений из БД: от него отсчитывается давность оповещений без сэмплов
+	loadedAt time.Time
+
+	// переходы на запись в БД и рассылку по WebSocket
+	updates chan db.AlertRow
+}
+
+func newAlertEngine(cfg config.AlertsConfig) *alertEngine {
+	e := &alertEngine{
+		rulesFile:    cfg.RulesFile,
+		evalInterval: cfg.EvalInterval,
+		rules:        make(map[string]*alertRule),
+		active:       make(map[string]*db.AlertRow),
+		seen:         make(map[string]time.Time),
+		updates:      make(chan db.AlertRow, alertUpdatesBuffer),
+	}
+	if e.evalInterval <= 0 {
+		e.evalInterval = defaultAlertEvalInterval
+	}
+	return e
+}
+
+// alertFingerprint однозначно задаёт оповещение: правило и ряд
+func alertFingerprint(rule, serverID, tag, metric string, l map[string]string) string {
+	return rule + "|" + serverID + "|" + tag + "|" + metric + "{" + labels.Labels(l).String() + "}"
+}
+
+// emit ставит переход в очередь на запись; вызывается под mu
+func (e *alertEngine) emit(r *alertRule, a *db.AlertRow) {
+	if ann := r.renderAnnotations(a); ann != nil {
+		a.Annotations = ann
+	}
+	alertTransitions.WithLabelValues(a.Rule, a.State).Inc()
+	select {
+	case e.updates <- *a:
+	default:
+		alertUpdatesDropped.Inc()
+		log.Printf("Alert update queue is full, dropping %s transition of %s", a.State, a.Fingerprint)
+	}
+}
+
+func (e *alertEngine) fire(r *alertRule, a *db.AlertRow, at time.Time) {
+	a.State = AlertFiring
+	a.FiredAt = &at
+	a.UpdatedAt = at
+	e.emit(r, a)
+}
+
+func (e *alertEngine) resolve(r *alertRule, a *db.AlertRow, at time.Time) {
+	a.State = AlertResolved
+	a.ResolvedAt = &at
+	a.UpdatedAt = at
+	delete(e.active, a.Fingerprint)
+	delete(e.seen, a.Fingerprint)
+	e.emit(r, a)
+}
+
+// observe вычисляет правила по принятым измерениям; scores — оценки аномалий сэмплов
+// для правил anomaly(...), сэмплы без оценки такие правила пропускают
+func (e *alertEngine) observe(samples []*api.StoredSample, scores map[*api.StoredSample]float64) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if len(e.rules) == 0 {
+		return
+	}
+	for _, smp := range samples {
+		for _, r := range e.rules {
+			if r.cond.window != 0 || !r.cond.matches(smp) {
+				continue
+			}
+			value := smp.Sample.Value
+			if r.cond.anomaly {
+				score, ok := scores[smp]
+				if !ok {
+					continue
+				}
+				value = score
+			}
+			e.evaluate(r, smp, value)
+		}
+	}
+}
+
+// observeForecasts вычисляет правила forecast(...) по свежим прогнозам; значение — время до заполнения в секундах.
+// Ряд без прогноза (значение не растёт) и пропавший из прогнозов ряд закрывают оповещение;
+// серверы из paused (ключ server_id:tag) не вычисляются.
+func (e *alertEngine) observeForecasts(forecasts []Forecast, paused map[string]bool, now time.Time) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if len(e.rules) == 0 {
+		return
+	}
+	seen := make(map[string]bool)
+	for i := range forecasts {
+		fc := &forecasts[i]
+		smp := &api.StoredSample{
+			ServerId: fc.ServerID,
+			Tag:      fc.Tag,
+			Sample:   &api.Sample{Name: fc.Metric, Labels: fc.Labels, Timestamp: timestamppb.New(now)},
+		}
+		for _, r := range e.rules {
+			if r.cond.window != fc.window || !r.cond.matches(smp) {
+				continue
+			}
+			fp := alertFingerprint(r.Name, fc.ServerID, fc.Tag, fc.Metric, fc.Labels)
+			seen[fp] = true
+			if paused[fc.ServerID+":"+fc.Tag] {
+				continue
+			}
+			if fc.TimeToFull == nil {
+				if a := e.active[fp]; a != nil {
+					e.resolve(r, a, now)
+				}
+				continue
+			}
+			e.evaluate(r, smp, *fc.TimeToFull)
+		}
+	}
+	for fp, a := range e.active {
+		if r, ok := e.rules[a.Rule]; ok && r.cond.window != 0 && !seen[fp] {
+			e.resolve(r, a, now)
+		}
+	}
+}
+
+// evaluate продвигает оповещение по ряду: inactive → pending → firing → resolved; вызывается под mu
+func (e *alertEngine) evaluate(r *alertRule, smp *api.StoredSample, value float64) {
+	ts := smp.Sample.Timestamp.AsTime()
+	fp := alertFingerprint(r.Name, smp.ServerId, smp.Tag, smp.Sample.Name, smp.Sample.Labels)
+	a := e.active[fp]
+
+	if !r.cond.holds(value) {
+		if a != nil {
+			a.Value = value
+			e.resolve(r, a, ts)
+		}
+		return
+	}
+	if a == nil {
+		a = &db.AlertRow{
+			Fingerprint: fp,
+			Rule:        r.Name,
+			Severity:    r.Severity,
+			ServerID:    smp.ServerId,
+			Tag:         smp.Tag,
+			Metric:      smp.Sample.Name,
+			Labels:      labels.Merge(smp.Sample.Labels, r.Labels),
+			State:       AlertPending,
+			Value:       value,
+			StartedAt:   ts,
+			UpdatedAt:   ts,
+		}
+		e.active[fp] = a
+		e.seen[fp] = time.Now()
+		if r.cond.forDur == 0 {
+			e.fire(r, a, ts)
+		} else {
+			e.emit(r, a)
+		}
+		return
+	}
+	a.Value = value
+	e.seen[fp] = time.Now()
+	if a.State == AlertPending && ts.Sub(a.StartedAt) >= r.cond.forDur {
+		e.fire(r, a, ts)
+	}
+}
+
+// tick переводит в firing pending-оповещения, чьё условие держится дольше for, если ряд ещё присылает данные;
+// закрывает оповещения удалённых правил и рядов, переставших присылать данные, и обновляет gohub_alerts.
+// state — состояние ряда (online/stale/offline) по времени его последнего сэмпла.
+// Оповещения forecast(...) по давности не проверяются: их закрывает observeForecasts.
+func (e *alertEngine) tick(now time.Time, state func(serverID, tag string, lastSeen time.Time) string) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	alertsActive.Reset()
+	for fp, a := range e.active {
+		r, ok := e.rules[a.Rule]
+		if !ok {
+			e.resolve(&alertRule{AlertRuleRow: db.AlertRuleRow{Name: a.Rule}}, a, now)
+			continue
+		}
+		if r.cond.window == 0 {
+			// Оповещения, загруженные из БД, ждут сэмплов от момента загрузки
+			lastSeen, sampled := e.seen[fp]
+			if !sampled {
+				lastSeen = e.loadedAt
+			}
+			switch st := state(a.ServerID, a.Tag, lastSeen); {
+			case st == StateOffline:
+				e.resolve(r, a, now)
+				continue
+			case st != StateOnline || !sampled:
+				alertsActive.WithLabelValues(a.Rule, a.Severity, a.State).Inc()
+				continue
+			}
+		}
+		if a.State == AlertPending && now.Sub(a.StartedAt) >= r.cond.forDur {
+			e.fire(r, a, now)
+		}
+		alertsActive.WithLabelValues(a.Rule, a.Severity, a.State).Inc()
+	}
+}
+
+// forgetServer закрывает активные оповещения сервера/тега (при выводе из эксплуатации)
+func (e *alertEngine) forgetServer(serverID, tag string, now time.Time) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	for _, a := range e.active {
+		if a.ServerID != serverID || a.Tag != tag {
+			continue
+		}
+		r, ok := e.rules[a.Rule]
+		if !ok {
+			r = &alertRule{AlertRuleRow: db.AlertRuleRow{Name: a.Rule}}
+		}
+		e.resolve(r, a, now)
+	}
+}
+
+// rulesList возвращает правила, отсортированные по имени
+func (e *alertEngine) rulesList() []db.AlertRuleRow {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	result := make([]db.AlertRuleRow, 0, len(e.rules))
+	for _, r := range e.rules {
+		result = append(result, r.AlertRuleRow)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Name < result[j].Name })
+	return result
+}
+
+// activeList возвращает копию активных оповещений (serverID — необязательный фильтр)
+func (e *alertEngine) activeList(serverID string) []db.AlertRow {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	result := make([]db.AlertRow, 0, len(e.active))
+	for _, a := range e.active {
+		if serverID != "" && a.ServerID != serverID {
+			continue
+		}
+		result = append(result, *a)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].StartedAt.Equal(result[j].StartedAt) {
+			return result[i].Fingerprint < result[j].Fingerprint
+		}
+		return result[i].StartedAt.Before(result[j].StartedAt)
+	})
+	return result
+}
+
+// LoadAlerting загружает правила (таблица alert_rules и файл правил) и активные оповещения
+func (s *MetricsServer) LoadAlerting(ctx context.Context) error {
+	rows, err := s.storage.LoadAlertRules(ctx)
+	if err != nil {
+		return err
+	}
+	if s.alerts.rulesFile != "" {
+		fileRows, err := loadRulesFile(s.alerts.rulesFile)
+		if err != nil {
+			return err
+		}
+		// Правила из файла перекрывают одноимённые правила из БД
+		rows = append(rows, fileRows...)
+	}
+	rules := make(map[string]*alertRule, len(rows))
+	for _, row := range rows {
+		r, err := s.newAlertRule(row)
+		if err != nil {
+			return fmt.Errorf("rule %q: %w", row.Name, err)
+		}
+		rules[r.Name] = r
+	}
+
+	active, err := s.storage.LoadAlerts(ctx, []string{AlertPending, AlertFiring}, "", 0)
+	if err != nil {
+		return err
+	}
+
+	e := s.alerts
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.rules = rules
+	e.loadedAt = time.Now()
+	for i := range active {
+		a := active[i]
+		e.active[a.Fingerprint] = &a
+	}
+	log.Printf("Loaded %d alert rule(s), %d active alert(s)", len(rules), len(active))
+	return nil
+}
+
+// newAlertRule проверяет правило, включая существование его каналов уведомлений
+// и отслеживание метрики для условий anomaly(...) и forecast(...)
+func (s *MetricsServer) newAlertRule(row db.AlertRuleRow) (*alertRule, error) {
+	r, err := newAlertRule(row)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.notifier.CheckChannels(r.Channels); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidAlertRule, err)
+	}
+	if r.cond.anomaly && !s.anomalies.tracks(r.cond.metric) {
+		return nil, fmt.Errorf("%w: metric %q is not tracked by anomaly detection (anomaly.metrics)", ErrInvalidAlertRule, r.cond.metric)
+	}
+	if r.cond.window != 0 && !s.forecasts.tracks(r.cond.metric, r.cond.window) {
+		return nil, fmt.Errorf("%w: forecast(%s, %s) is not computed (forecast.metrics, forecast.windows)",
+			ErrInvalidAlertRule, r.cond.metric, formatWindow(r.cond.window))
+	}
+	return r, nil
+}
+
+// runAlerts вычисляет таймеры правил и записывает переходы до остановки сервера
+func (s *MetricsServer) runAlerts() {
+	ticker := time.NewTicker(s.alerts.evalInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			now := time.Now()
+			s.alerts.tick(now, func(serverID, tag string, lastSeen time.Time) string {
+				return s.monitor.state(lastSeen, s.expectedInterval(serverID, tag), now)
+			})
+		case a := <-s.alerts.updates:
+			s.saveAlert(a)
+		case <-s.done:
+			// Дописываем накопившиеся переходы
+			for {
+				select {
+				case a := <-s.alerts.updates:
+					s.saveAlert(a)
+				default:
+					return
+				}
+			}
+		}
+	}
+}
+
+// saveAlert сохраняет переход оповещения и рассылает его по WebSocket
+func (s *MetricsServer) saveAlert(a db.AlertRow) {
+	ctx, cancel := context.WithTimeout(context.Background(), alertSaveTimeout)
+	err := s.storage.SaveAlert(ctx, a)
+	cancel()
+	if err != nil {
+		log.Printf("Failed to save alert %s (%s): %v", a.Fingerprint, a.State, err)
+	}
+	if a.State != AlertPending {
+		log.Printf("Alert %s %s: %s/%s %s=%g", a.Rule, a.State, a.ServerID, a.Tag, a.Metric, a.Value)
+	}
+	s.hub.BroadcastAlert(ws.WSAlert{
+		Message:     "Alert " + a.State,
+		Rule:        a.Rule,
+		Severity:    a.Severity,
+		ServerID:    a.ServerID,
+		Tag:         a.Tag,
+		Metric:      a.Metric,
+		Labels:      a.Labels,
+		Annotations: a.Annotations,
+		State:       a.State,
+		Value:       a.Value,
+		StartedAt:   a.StartedAt.Unix(),
+		Timestamp:   a.UpdatedAt.Unix(),
+	})
+	s.notifyAlert(a)
+}
+
+// notifyAlert уведомляет о срабатывании и о закрытии сработавшего оповещения;
+// pending, закрытие pending-оповещений, заглушенные оповещения и серверы в обслуживании не уведомляются
+func (s *MetricsServer) notifyAlert(a db.AlertRow) {
+	resolved := a.State == AlertResolved
+	if a.State == AlertPending || (resolved && a.FiredAt == nil) {
+		return
+	}
+	if s.suppressed(&a, time.Now()) {
+		return
+	}
+	s.alerts.mu.Lock()
+	var channels []string
+	if r, ok := s.alerts.rules[a.Rule]; ok {
+		channels = r.Channels
+	}
+	s.alerts.mu.Unlock()
+	s.notifier.Dispatch(notify.Notification{
+		Rule:        a.Rule,
+		Severity:    a.Severity,
+		State:       a.State,
+		ServerID:    a.ServerID,
+		Tag:         a.Tag,
+		Metric:      a.Metric,
+		Labels:      a.Labels,
+		Annotations: a.Annotations,
+		Value:       a.Value,
+		StartedAt:   a.StartedAt,
+		Timestamp:   a.UpdatedAt,
+	}, channels, resolved)
+}
+
+// NotifyChannels возвращает настроенные каналы уведомлений
+func (s *MetricsServer) NotifyChannels() []notify.ChannelInfo {
+	return s.notifier.Channels()
+}
+
+// TestNotify отправляет пробное уведомление в канал и ждёт результата
+func (s *MetricsServer) TestNotify(ctx context.Context, channel string) error {
+	return s.notifier.Test(ctx, channel)
+}
+
+// AlertRules возвращает правила оповещений
+func (s *MetricsServer) AlertRules() []db.AlertRuleRow {
+	return s.alerts.rulesList()
+}
+
+// SetAlertRule создаёт или заменяет правило в таблице alert_rules
+func (s *MetricsServer) SetAlertRule(ctx context.Context, row db.AlertRuleRow) error {
+	row.Source = "api"
+	r, err := s.newAlertRule(row)
+	if err != nil {
+		return err
+	}
+	s.alerts.mu.Lock()
+	prev, ok := s.alerts.rules[r.Name]
+	s.alerts.mu.Unlock()
+	if ok && prev.Source == "file" {
+		return ErrReadOnlyAlertRule
+	}
+	if err := s.storage.SaveAlertRule(ctx, r.AlertRuleRow); err != nil {
+		return err
+	}
+	s.alerts.replaceRule(r, time.Now())
+	return nil
+}
+
+// replaceRule устанавливает правило; если прежнее правило с тем же именем относилось к другим рядам
+// (метрика, anomaly/forecast или селектор), его активные оповещения закрываются
+func (e *alertEngine) replaceRule(r *alertRule, now time.Time) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if prev, ok := e.rules[r.Name]; ok && !prev.cond.sameSeries(&r.cond) {
+		for _, a := range e.active {
+			if a.Rule == r.Name {
+				e.resolve(prev, a, now)
+			}
+		}
+	}
+	e.rules[r.Name] = r
+}
+
+// DeleteAlertRule удаляет правило; его оповещения закрываются при следующей проверке.
+// Возвращает false, если правила нет.
+func (s *MetricsServer) DeleteAlertRule(ctx context.Context, name string) (bool, error) {
+	s.alerts.mu.Lock()
+	r, ok := s.alerts.rules[name]
+	s.alerts.mu.Unlock()
+	if ok && r.Source == "file" {
+		return false, ErrReadOnlyAlertRule
+	}
+	deleted, err := s.storage.DeleteAlertRule(ctx, name)
+	if err != nil {
+		return false, err
+	}
+	s.alerts.mu.Lock()
+	delete(s.alerts.rules, name)
+	s.alerts.mu.Unlock()
+	return deleted || ok, nil
+}
+
+// ActiveAlerts возвращает оповещения в состоянии pending и firing
+func (s *MetricsServer) ActiveAlerts(serverID string) []db.AlertRow {
+	return s.alerts.activeList(serverID)
+}
+
+// AlertHistory возвращает последние оповещения из БД, включая закрытые
+func (s *MetricsServer) AlertHistory(ctx context.Context, states []string, serverID string, limit int64) ([]db.AlertRow, error) {
+	return s.storage.LoadAlerts(ctx, states, serverID, limit)
+}
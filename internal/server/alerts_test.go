@@ -0,0 +1,108 @@
+package server
+
+import (
+	"testing"
+	"time"
+
+	"github.com/vovakirdan/gohub/internal/api"
+	"github.com/vovakirdan/gohub/internal/config"
+	"github.com/vovakirdan/gohub/internal/db"
+
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// testAlertEngine создаёт движок с одним правилом rule_a
+func testAlertEngine(t *testing.T, expr string) *alertEngine {
+	t.Helper()
+	e := newAlertEngine(config.AlertsConfig{})
+	r, err := newAlertRule(db.AlertRuleRow{Name: "rule_a", Expr: expr})
+	if err != nil {
+		t.Fatal(err)
+	}
+	e.rules[r.Name] = r
+	return e
+}
+
+func cpuSample(serverID string, ts time.Time, v float64) []*api.StoredSample {
+	return []*api.StoredSample{{ServerId: serverID, Sample: &api.Sample{Name: "cpu_usage", Value: v, Timestamp: timestamppb.New(ts)}}}
+}
+
+// onlyState — состояние ряда в tick не зависит от времени последнего сэмпла
+func onlyState(state string) func(string, string, time.Time) string {
+	return func(string, string, time.Time) string { return state }
+}
+
+func TestAlertTickStaleSeries(t *testing.T) {
+	start := time.Now()
+	after := start.Add(2 * time.Minute)
+
+	e := testAlertEngine(t, "cpu_usage > 90 for 1m")
+	e.observe(cpuSample("web-1", start, 95), nil)
+	// Ряд перестал присылать данные: for истёк, но pending не переходит в firing
+	e.tick(after, onlyState(StateStale))
+	if a := e.activeList(""); len(a) != 1 || a[0].State != AlertPending {
+		t.Fatalf("stale series must stay pending, got %+v", a)
+	}
+	e.tick(after, onlyState(StateOnline))
+	if a := e.activeList(""); len(a) != 1 || a[0].State != AlertFiring {
+		t.Fatalf("expected firing alert, got %+v", a)
+	}
+	// Сработавшее оповещение по пропавшему ряду закрывается
+	e.tick(after, onlyState(StateOffline))
+	if a := e.activeList(""); len(a) != 0 {
+		t.Fatalf("offline series must resolve the alert, got %+v", a)
+	}
+}
+
+func TestAlertTickLoadedAlert(t *testing.T) {
+	start := time.Now()
+	e := testAlertEngine(t, "cpu_usage > 90 for 1m")
+	e.loadedAt = start
+	fp := alertFingerprint("rule_a", "web-1", "", "cpu_usage", nil)
+	e.active[fp] = &db.AlertRow{Fingerprint: fp, Rule: "rule_a", ServerID: "web-1", Metric: "cpu_usage",
+		State: AlertPending, StartedAt: start.Add(-time.Hour)}
+
+	var lastSeen time.Time
+	state := func(_, _ string, seen time.Time) string {
+		lastSeen = seen
+		return StateOnline
+	}
+	// Без сэмплов после загрузки оповещение не переходит в firing, давность считается от загрузки
+	e.tick(start.Add(time.Minute), state)
+	if a := e.activeList(""); len(a) != 1 || a[0].State != AlertPending {
+		t.Fatalf("loaded alert without samples must stay pending, got %+v", a)
+	}
+	if !lastSeen.Equal(start) {
+		t.Fatalf("expected staleness from load time %s, got %s", start, lastSeen)
+	}
+	e.observe(cpuSample("web-1", start.Add(time.Minute), 95), nil)
+	if a := e.activeList(""); len(a) != 1 || a[0].State != AlertFiring {
+		t.Fatalf("expected firing alert after a sample, got %+v", a)
+	}
+}
+
+func TestAlertRuleReplaced(t *testing.T) {
+	cases := []struct {
+		name     string
+		expr     string
+		resolved bool
+	}{
+		{"threshold changed", "cpu_usage > 80", false},
+		{"metric changed", "memory_usage > 90", true},
+		{"selector changed", "cpu_usage > 90 on server_id=web-2", true},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			e := testAlertEngine(t, "cpu_usage > 90")
+			e.observe(cpuSample("web-1", time.Now(), 95), nil)
+			r, err := newAlertRule(db.AlertRuleRow{Name: "rule_a", Expr: tc.expr})
+			if err != nil {
+				t.Fatal(err)
+			}
+			e.replaceRule(r, time.Now())
+			if got := len(e.activeList("")) == 0; got != tc.resolved {
+				t.Fatalf("expected resolved=%t, got %+v", tc.resolved, e.activeList(""))
+			}
+		})
+	}
+}
@@ -0,0 +1,550 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/vovakirdan/gohub/internal/api"
+	"github.com/vovakirdan/gohub/internal/config"
+	"github.com/vovakirdan/gohub/internal/db"
+	"github.com/vovakirdan/gohub/internal/labels"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Параметры поиска аномалий по умолчанию, если в конфиге не заданы
+const (
+	defaultAnomalyAlpha            = 0.05
+	defaultAnomalySigma            = 3
+	defaultAnomalyMinSamples       = 30
+	defaultAnomalySeasonalAlpha    = 0.3
+	defaultAnomalySeasonalMinWeeks = 3
+	defaultAnomalySaveInterval     = 5 * time.Minute
+	defaultAnomalyQueueSize        = 10000
+)
+
+const (
+	// Оценки пишутся пачками не реже раза в anomalyFlushInterval
+	anomalyFlushInterval = time.Second
+	anomalyBatchSize     = 1000
+	anomalyWriteTimeout  = 30 * time.Second
+	// Базовые линии старше этого при старте не загружаются
+	anomalyBaselineMaxAge = 30 * 24 * time.Hour
+	// Часов в неделе — столько сезонных базовых линий у ряда
+	hoursPerWeek = 7 * 24
+)
+
+var (
+	anomalyScore = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "gohub_anomaly_score",
+		Help: "Deviation of the last sample from the series baseline in standard deviations",
+	}, []string{"server_id", "tag", "metric", "labels"})
+	anomaliesTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "gohub_anomalies_total",
+		Help: "Samples deviating from the baseline by more than anomaly.sigma",
+	}, []string{"metric"})
+	anomalyScoresDropped = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "gohub_anomaly_scores_dropped_total",
+		Help: "Anomaly scores not stored because the queue was full or the write failed",
+	})
+)
+
+func init() {
+	prometheus.MustRegister(anomalyScore, anomaliesTotal, anomalyScoresDropped)
+}
+
+// ewma — экспоненциально взвешенные среднее и дисперсия
+type ewma struct {
+	N    int     `json:"n"`
+	Mean float64 `json:"mean"`
+	Var  float64 `json:"var"`
+}
+
+func (e *ewma) update(x, alpha float64) {
+	if e.N == 0 {
+		e.Mean, e.Var = x, 0
+	} else {
+		diff := x - e.Mean
+		incr := alpha * diff
+		e.Mean += incr
+		e.Var = (1 - alpha) * (e.Var + diff*incr)
+	}
+	e.N++
+}
+
+// hourStats — значения текущего часа (среднее и дисперсия по Уэлфорду)
+type hourStats struct {
+	// Начало часа, unix-время
+	Start int64   `json:"start"`
+	N     int     `json:"n"`
+	Mean  float64 `json:"mean"`
+	M2    float64 `json:"m2"`
+}
+
+func (h *hourStats) add(x float64) {
+	h.N++
+	diff := x - h.Mean
+	h.Mean += diff / float64(h.N)
+	h.M2 += diff * (x - h.Mean)
+}
+
+func (h *hourStats) variance() float64 {
+	if h.N < 2 {
+		return 0
+	}
+	return h.M2 / float64(h.N)
+}
+
+// seasonalSlot — базовая линия часа недели. Обновляется раз в неделю, когда этот час заканчивается:
+// N — число недель, Mean и Var — среднее за час и его разброс между неделями, HourVar — разброс внутри часа.
+type seasonalSlot struct {
+	ewma
+	HourVar float64 `json:"hour_var"`
+}
+
+func (s *seasonalSlot) update(mean, hourVar, alpha float64) {
+	if s.N == 0 {
+		s.HourVar = hourVar
+	} else {
+		s.HourVar += alpha * (hourVar - s.HourVar)
+	}
+	s.ewma.update(mean, alpha)
+}
+
+// baseline — базовая линия ряда: общая и по часу недели.
+// Weekly хранится под ключом week_hours: прежние корзины "weekly" обновлялись каждым значением и не загружаются.
+type baseline struct {
+	Global ewma           `json:"global"`
+	Weekly []seasonalSlot `json:"week_hours,omitempty"`
+	// Текущий час, который попадёт в Weekly, когда закончится
+	Hour hourStats `json:"hour"`
+
+	serverID  string
+	tag       string
+	metric    string
+	labels    map[string]string
+	lastValue float64
+	lastScore float64
+	scored    bool
+	dirty     bool
+}
+
+// AnomalyBaseline — базовая линия ряда для API
+type AnomalyBaseline struct {
+	ServerID string            `json:"server_id"`
+	Tag      string            `json:"tag"`
+	Metric   string            `json:"metric"`
+	Labels   map[string]string `json:"labels,omitempty"`
+	Samples  int               `json:"samples"`
+	Mean     float64           `json:"mean"`
+	StdDev   float64           `json:"stddev"`
+	// Ожидание на текущий час недели (общее, пока час недели не набрал seasonal_min_weeks недель)
+	Expected       float64  `json:"expected"`
+	ExpectedStdDev float64  `json:"expected_stddev"`
+	LastValue      float64  `json:"last_value"`
+	LastScore      *float64 `json:"last_score,omitempty"`
+}
+
+// anomalyDetector ведёт базовые линии рядов и оценивает отклонение новых значений
+type anomalyDetector struct {
+	enabled      bool
+	metrics      map[string]bool
+	alpha        float64
+	sigma        float64
+	minSamples   int
+	seasonal     bool
+	seasonAlpha  float64
+	seasonWeeks  int
+	loc          *time.Location
+	storeAll     bool
+	saveInterval time.Duration
+
+	mu     sync.Mutex
+	series map[string]*baseline
+
+	// оценки на запись в anomaly_scores
+	scores chan db.AnomalyScoreRow
+}
+
+func newAnomalyDetector(cfg config.AnomalyConfig) (*anomalyDetector, error) {
+	d := &anomalyDetector{
+		enabled:      cfg.Enabled,
+		metrics:      make(map[string]bool),
+		alpha:        cfg.Alpha,
+		sigma:        cfg.Sigma,
+		minSamples:   cfg.MinSamples,
+		seasonal:     cfg.Seasonal,
+		seasonAlpha:  cfg.SeasonalAlpha,
+		seasonWeeks:  cfg.SeasonalMinWeeks,
+		loc:          time.UTC,
+		storeAll:     cfg.StoreAll,
+		saveInterval: cfg.SaveInterval,
+		series:       make(map[string]*baseline),
+	}
+	names := cfg.Metrics
+	if len(names) == 0 {
+		names = legacySampleNames[:]
+	}
+	for _, name := range names {
+		d.metrics[name] = true
+	}
+	if d.alpha <= 0 || d.alpha >= 1 {
+		d.alpha = defaultAnomalyAlpha
+	}
+	if d.sigma <= 0 {
+		d.sigma = defaultAnomalySigma
+	}
+	if d.minSamples <= 0 {
+		d.minSamples = defaultAnomalyMinSamples
+	}
+	if d.seasonAlpha <= 0 || d.seasonAlpha > 1 {
+		d.seasonAlpha = defaultAnomalySeasonalAlpha
+	}
+	if d.seasonWeeks <= 0 {
+		d.seasonWeeks = defaultAnomalySeasonalMinWeeks
+	}
+	if d.saveInterval <= 0 {
+		d.saveInterval = defaultAnomalySaveInterval
+	}
+	if cfg.Timezone != "" {
+		loc, err := time.LoadLocation(cfg.Timezone)
+		if err != nil {
+			return nil, fmt.Errorf("invalid anomaly.timezone: %w", err)
+		}
+		d.loc = loc
+	}
+	size := cfg.QueueSize
+	if size <= 0 {
+		size = defaultAnomalyQueueSize
+	}
+	d.scores = make(chan db.AnomalyScoreRow, size)
+	return d, nil
+}
+
+// tracks — по метрике ведутся базовые линии
+func (d *anomalyDetector) tracks(metric string) bool {
+	return d.enabled && d.metrics[metric]
+}
+
+func seriesKey(serverID, tag, metric string, l map[string]string) string {
+	return serverID + "|" + tag + "|" + metric + "{" + labels.Labels(l).String() + "}"
+}
+
+// hourOfWeek — номер часа недели 0..167 (с воскресенья)
+func (d *anomalyDetector) hourOfWeek(t time.Time) int {
+	t = t.In(d.loc)
+	return int(t.Weekday())*24 + t.Hour()
+}
+
+// hourStart — начало часа t в часовом поясе часа недели
+func (d *anomalyDetector) hourStart(t time.Time) time.Time {
+	t = t.In(d.loc)
+	return time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), 0, 0, 0, d.loc)
+}
+
+// expected возвращает ожидание и стандартное отклонение на момент t:
+// по часу недели, если он набрал seasonWeeks недель, иначе общее. ok — базовой линии можно доверять.
+func (d *anomalyDetector) expected(b *baseline, t time.Time) (mean, std float64, ok bool) {
+	mean, variance, ok := b.Global.Mean, b.Global.Var, b.Global.N >= d.minSamples
+	if d.seasonal && len(b.Weekly) == hoursPerWeek {
+		if w := &b.Weekly[d.hourOfWeek(t)]; w.N >= d.seasonWeeks {
+			// Значение отклоняется и от среднего за час, и внутри часа
+			mean, variance, ok = w.Mean, w.Var+w.HourVar, true
+		}
+	}
+	// Нижняя граница: у постоянного ряда любое изменение иначе дало бы бесконечную оценку
+	std = math.Max(math.Sqrt(variance), 1e-3*math.Max(1, math.Abs(mean)))
+	return mean, std, ok
+}
+
+// observeSeasonal копит значения текущего часа и, когда час заканчивается, одним обновлением
+// переносит его среднее в час недели: так час недели учится на прошлых неделях, а не на последних минутах
+func (d *anomalyDetector) observeSeasonal(b *baseline, v float64, ts time.Time) {
+	if len(b.Weekly) != hoursPerWeek {
+		b.Weekly = make([]seasonalSlot, hoursPerWeek)
+	}
+	start := d.hourStart(ts).Unix()
+	switch {
+	case b.Hour.N == 0:
+		b.Hour = hourStats{Start: start}
+	case start > b.Hour.Start:
+		h := &b.Hour
+		b.Weekly[d.hourOfWeek(time.Unix(h.Start, 0))].update(h.Mean, h.variance(), d.seasonAlpha)
+		b.Hour = hourStats{Start: start}
+	case start < b.Hour.Start:
+		// Запоздавшее значение уже закрытого часа
+		return
+	}
+	b.Hour.add(v)
+}
+
+// observe оценивает сэмплы и обновляет базовые линии. Возвращает оценки сэмплов,
+// для которых базовая линия уже обучена.
+func (d *anomalyDetector) observe(samples []*api.StoredSample) map[*api.StoredSample]float64 {
+	if !d.enabled {
+		return nil
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	var result map[*api.StoredSample]float64
+	for _, smp := range samples {
+		name := smp.Sample.Name
+		if !d.metrics[name] {
+			continue
+		}
+		v := smp.Sample.Value
+		if math.IsNaN(v) || math.IsInf(v, 0) {
+			continue
+		}
+		key := seriesKey(smp.ServerId, smp.Tag, name, smp.Sample.Labels)
+		b, ok := d.series[key]
+		if !ok {
+			b = &baseline{serverID: smp.ServerId, tag: smp.Tag, metric: name, labels: smp.Sample.Labels}
+			d.series[key] = b
+		}
+		ts := smp.Sample.Timestamp.AsTime()
+
+		if mean, std, ok := d.expected(b, ts); ok {
+			score := (v - mean) / std
+			anomalous := math.Abs(score) > d.sigma
+			if result == nil {
+				result = make(map[*api.StoredSample]float64)
+			}
+			result[smp] = score
+			b.lastScore, b.scored = score, true
+			anomalyScore.WithLabelValues(smp.ServerId, smp.Tag, name, labels.Labels(smp.Sample.Labels).String()).Set(score)
+			if anomalous {
+				anomaliesTotal.WithLabelValues(name).Inc()
+			}
+			if anomalous || d.storeAll {
+				d.enqueue(db.AnomalyScoreRow{
+					ServerID:  smp.ServerId,
+					Tag:       smp.Tag,
+					Metric:    name,
+					Labels:    smp.Sample.Labels,
+					Value:     v,
+					Expected:  mean,
+					StdDev:    std,
+					Score:     score,
+					Anomalous: anomalous,
+					CreatedAt: ts,
+				})
+			}
+		}
+
+		b.Global.update(v, d.alpha)
+		if d.seasonal {
+			d.observeSeasonal(b, v, ts)
+		}
+		b.labels = smp.Sample.Labels
+		b.lastValue = v
+		b.dirty = true
+	}
+	return result
+}
+
+// enqueue ставит оценку на запись, не блокируя приём
+func (d *anomalyDetector) enqueue(row db.AnomalyScoreRow) {
+	select {
+	case d.scores <- row:
+	default:
+		anomalyScoresDropped.Inc()
+	}
+}
+
+// forget забывает базовые линии сервера/тега
+func (d *anomalyDetector) forget(serverID, tag string) {
+	d.mu.Lock()
+	for key, b := range d.series {
+		if b.serverID == serverID && b.tag == tag {
+			delete(d.series, key)
+		}
+	}
+	d.mu.Unlock()
+	anomalyScore.DeletePartialMatch(prometheus.Labels{"server_id": serverID, "tag": tag})
+}
+
+// LoadAnomalyBaselines восстанавливает базовые линии из БД, чтобы после перезапуска не обучаться заново
+func (s *MetricsServer) LoadAnomalyBaselines(ctx context.Context) error {
+	d := s.anomalies
+	if !d.enabled {
+		return nil
+	}
+	rows, err := s.storage.LoadAnomalyBaselines(ctx, time.Now().Add(-anomalyBaselineMaxAge))
+	if err != nil {
+		return err
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for _, row := range rows {
+		b := &baseline{serverID: row.ServerID, tag: row.Tag, metric: row.Metric, labels: row.Labels}
+		if err := json.Unmarshal(row.State, b); err != nil {
+			log.Printf("Skipping anomaly baseline %s: %v", row.Key, err)
+			continue
+		}
+		if len(b.Weekly) != 0 && len(b.Weekly) != hoursPerWeek {
+			b.Weekly = nil
+		}
+		d.series[row.Key] = b
+	}
+	log.Printf("Loaded %d anomaly baseline(s)", len(rows))
+	return nil
+}
+
+// runAnomalies пишет оценки пачками и периодически сохраняет базовые линии до остановки сервера
+func (s *MetricsServer) runAnomalies() {
+	d := s.anomalies
+	flush := time.NewTicker(anomalyFlushInterval)
+	defer flush.Stop()
+	save := time.NewTicker(d.saveInterval)
+	defer save.Stop()
+	var batch []db.AnomalyScoreRow
+	for {
+		select {
+		case row := <-d.scores:
+			batch = append(batch, row)
+			if len(batch) >= anomalyBatchSize {
+				s.writeAnomalyScores(batch)
+				batch = nil
+			}
+		case <-flush.C:
+			s.writeAnomalyScores(batch)
+			batch = nil
+		case <-save.C:
+			ctx, cancel := context.WithTimeout(context.Background(), anomalyWriteTimeout)
+			s.saveAnomalyBaselines(ctx)
+			cancel()
+		case <-s.done:
+			// Остаток дописывает flushAnomalies при остановке
+			for _, row := range batch {
+				d.enqueue(row)
+			}
+			return
+		}
+	}
+}
+
+func (s *MetricsServer) writeAnomalyScores(batch []db.AnomalyScoreRow) {
+	if len(batch) == 0 {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), anomalyWriteTimeout)
+	defer cancel()
+	if err := s.storage.SaveAnomalyScores(ctx, batch); err != nil {
+		log.Printf("Failed to save %d anomaly score(s): %v", len(batch), err)
+		anomalyScoresDropped.Add(float64(len(batch)))
+	}
+}
+
+// saveAnomalyBaselines сохраняет изменившиеся базовые линии
+func (s *MetricsServer) saveAnomalyBaselines(ctx context.Context) {
+	d := s.anomalies
+	now := time.Now()
+	var rows []db.AnomalyBaselineRow
+	var saved []*baseline
+	d.mu.Lock()
+	for key, b := range d.series {
+		if !b.dirty {
+			continue
+		}
+		state, err := json.Marshal(b)
+		if err != nil {
+			continue
+		}
+		rows = append(rows, db.AnomalyBaselineRow{
+			Key:       key,
+			ServerID:  b.serverID,
+			Tag:       b.tag,
+			Metric:    b.metric,
+			Labels:    b.labels,
+			State:     state,
+			UpdatedAt: now,
+		})
+		saved = append(saved, b)
+		b.dirty = false
+	}
+	d.mu.Unlock()
+	if err := s.storage.SaveAnomalyBaselines(ctx, rows); err != nil {
+		log.Printf("Failed to save %d anomaly baseline(s): %v", len(rows), err)
+		d.mu.Lock()
+		for _, b := range saved {
+			b.dirty = true
+		}
+		d.mu.Unlock()
+	}
+}
+
+// flushAnomalies дописывает очередь оценок и сохраняет базовые линии при остановке
+func (s *MetricsServer) flushAnomalies(ctx context.Context) {
+	if !s.anomalies.enabled {
+		return
+	}
+	var batch []db.AnomalyScoreRow
+	for drained := false; !drained; {
+		select {
+		case row := <-s.anomalies.scores:
+			batch = append(batch, row)
+		default:
+			drained = true
+		}
+	}
+	s.writeAnomalyScores(batch)
+	s.saveAnomalyBaselines(ctx)
+}
+
+// AnomalyBaselines возвращает текущие базовые линии (фильтры по server_id и tag необязательны)
+func (s *MetricsServer) AnomalyBaselines(serverID, tag string) []AnomalyBaseline {
+	d := s.anomalies
+	now := time.Now()
+	d.mu.Lock()
+	result := make([]AnomalyBaseline, 0, len(d.series))
+	for _, b := range d.series {
+		if (serverID != "" && b.serverID != serverID) || (tag != "" && b.tag != tag) {
+			continue
+		}
+		exp, expStd, _ := d.expected(b, now)
+		ab := AnomalyBaseline{
+			ServerID:       b.serverID,
+			Tag:            b.tag,
+			Metric:         b.metric,
+			Labels:         b.labels,
+			Samples:        b.Global.N,
+			Mean:           b.Global.Mean,
+			StdDev:         math.Sqrt(b.Global.Var),
+			Expected:       exp,
+			ExpectedStdDev: expStd,
+			LastValue:      b.lastValue,
+		}
+		if b.scored {
+			score := b.lastScore
+			ab.LastScore = &score
+		}
+		result = append(result, ab)
+	}
+	d.mu.Unlock()
+	sort.Slice(result, func(i, j int) bool {
+		a, b := result[i], result[j]
+		if a.ServerID != b.ServerID {
+			return a.ServerID < b.ServerID
+		}
+		if a.Tag != b.Tag {
+			return a.Tag < b.Tag
+		}
+		if a.Metric != b.Metric {
+			return a.Metric < b.Metric
+		}
+		return labels.Labels(a.Labels).String() < labels.Labels(b.Labels).String()
+	})
+	return result
+}
+
+// AnomalyScores возвращает сохранённые оценки; all — не только аномалии
+func (s *MetricsServer) AnomalyScores(ctx context.Context, serverID, tag, metric string, all bool, limit int64) ([]db.AnomalyScoreRow, error) {
+	return s.storage.LoadAnomalyScores(ctx, serverID, tag, metric, !all, limit)
+}
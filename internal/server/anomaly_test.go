@@ -0,0 +1,63 @@
+package server
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/vovakirdan/gohub/internal/api"
+	"github.com/vovakirdan/gohub/internal/config"
+
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+func TestAnomalySeasonalHourOfWeek(t *testing.T) {
+	d, err := newAnomalyDetector(config.AnomalyConfig{Enabled: true, Seasonal: true, Metrics: []string{"cpu_usage"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sample := func(ts time.Time, v float64) *api.StoredSample {
+		return &api.StoredSample{ServerId: "db-1", Sample: &api.Sample{Name: "cpu_usage", Value: v, Timestamp: timestamppb.New(ts)}}
+	}
+	// Понедельник 10:00–11:00 — еженедельный бэкап с нагрузкой 80%, в остальное время 20%
+	busy := func(ts time.Time) bool { return ts.Weekday() == time.Monday && ts.Hour() == 10 }
+	start := time.Date(2024, 4, 7, 0, 0, 0, 0, time.UTC) // воскресенье
+	const weeks = 4
+	for i, ts := 0, start; ts.Before(start.AddDate(0, 0, 7*weeks)); i, ts = i+1, ts.Add(10*time.Minute) {
+		v := 20.0
+		if busy(ts) {
+			v = 80
+		}
+		// Небольшой разброс внутри часа
+		v += float64(i%2)*2 - 1
+		d.observe([]*api.StoredSample{sample(ts, v)})
+	}
+
+	b := d.series[seriesKey("db-1", "", "cpu_usage", nil)]
+	monday10 := d.hourOfWeek(time.Date(2024, 5, 6, 10, 0, 0, 0, time.UTC))
+	// Час недели обновлялся раз в неделю, а не каждым значением
+	if n := b.Weekly[monday10].N; n != weeks {
+		t.Fatalf("expected %d updates of the hour of week, got %d", weeks, n)
+	}
+
+	score := func(ts time.Time, v float64) float64 {
+		mean, std, ok := d.expected(b, ts)
+		if !ok {
+			t.Fatalf("baseline at %s is not trusted", ts)
+		}
+		return (v - mean) / std
+	}
+	nextMonday := time.Date(2024, 5, 6, 10, 30, 0, 0, time.UTC)
+	if s := score(nextMonday, 80); math.Abs(s) > d.sigma {
+		t.Errorf("usual Monday backup load scored %.2f", s)
+	}
+	if s := score(nextMonday, 20); s > -d.sigma {
+		t.Errorf("missing Monday backup load scored %.2f", s)
+	}
+	if s := score(nextMonday.Add(24*time.Hour), 80); s < d.sigma {
+		t.Errorf("backup load on Tuesday scored %.2f", s)
+	}
+	if s := score(nextMonday.Add(24*time.Hour), 20); math.Abs(s) > d.sigma {
+		t.Errorf("usual Tuesday load scored %.2f", s)
+	}
+}
@@ -0,0 +1,141 @@
+package server
+
+import (
+	"log"
+	"math"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// Коэффициент сглаживания оценки расхождения часов (EWMA)
+const clockOffsetAlpha = 0.3
+
+var agentClockOffsetDesc = prometheus.NewDesc(
+	"agent_clock_offset_seconds",
+	"Estimated agent clock offset (server arrival time minus agent send time, includes network delay)",
+	[]string{"server_id", "tag"}, nil,
+)
+
+var agentClockSkewedDesc = prometheus.NewDesc(
+	"agent_clock_skewed",
+	"Whether the agent clock drifts beyond the configured threshold (1) or not (0)",
+	[]string{"server_id", "tag"}, nil,
+)
+
+// Оценки расхождения часов агентов
+var agentClocks = newClockTracker()
+
+// ClockStatus — оценка расхождения часов агента
+type ClockStatus struct {
+	ServerID      string    `json:"server_id"`
+	Tag           string    `json:"tag"`
+	OffsetSeconds float64   `json:"offset_seconds"`
+	Skewed        bool      `json:"skewed"`
+	UpdatedAt     time.Time `json:"updated_at"`
+}
+
+// clockTracker хранит сглаженное расхождение часов по агентам (ключ server_id:tag)
+type clockTracker struct {
+	mu     sync.RWMutex
+	clocks map[string]*ClockStatus
+}
+
+func newClockTracker() *clockTracker {
+	return &clockTracker{clocks: make(map[string]*ClockStatus)}
+}
+
+// observe учитывает очередной запрос агента и возвращает признак расхождения часов.
+// sentAt — время отправки по часам агента, arrival — время приёма на сервере.
+func (c *clockTracker) observe(serverID, tag string, sentAt *timestamppb.Timestamp, arrival time.Time, maxSkew time.Duration) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	key := serverID + ":" + tag
+	st, ok := c.clocks[key]
+	if sentAt == nil {
+		// Агент не сообщает время (старая версия) — оценить нечего
+		return ok && st.Skewed
+	}
+
+	offset := arrival.Sub(sentAt.AsTime()).Seconds()
+	if !ok {
+		st = &ClockStatus{ServerID: serverID, Tag: tag, OffsetSeconds: offset}
+		c.clocks[key] = st
+	} else {
+		st.OffsetSeconds = clockOffsetAlpha*offset + (1-clockOffsetAlpha)*st.OffsetSeconds
+	}
+	st.UpdatedAt = arrival
+
+	skewed := maxSkew > 0 && math.Abs(st.OffsetSeconds) > maxSkew.Seconds()
+	if skewed != st.Skewed {
+		if skewed {
+			log.Printf("Agent %s/%s clock drifts by %.1fs (threshold %s)", serverID, tag, st.OffsetSeconds, maxSkew)
+		} else {
+			log.Printf("Agent %s/%s clock is back within threshold (offset %.1fs)", serverID, tag, st.OffsetSeconds)
+		}
+	}
+	st.Skewed = skewed
+	return skewed
+}
+
+// delete забывает оценку агента
+func (c *clockTracker) delete(serverID, tag string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.clocks, serverID+":"+tag)
+}
+
+// list возвращает копию оценок, отсортированную по server_id/tag
+func (c *clockTracker) list() []ClockStatus {
+	c.mu.RLock()
+	result := make([]ClockStatus, 0, len(c.clocks))
+	for _, st := range c.clocks {
+		result = append(result, *st)
+	}
+	c.mu.RUnlock()
+
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].ServerID != result[j].ServerID {
+			return result[i].ServerID < result[j].ServerID
+		}
+		return result[i].Tag < result[j].Tag
+	})
+	return result
+}
+
+func (c *clockTracker) Describe(ch chan<- *prometheus.Desc) {
+	ch <- agentClockOffsetDesc
+	ch <- agentClockSkewedDesc
+}
+
+func (c *clockTracker) Collect(ch chan<- prometheus.Metric) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	for _, st := range c.clocks {
+		skewed := 0.0
+		if st.Skewed {
+			skewed = 1
+		}
+		ch <- prometheus.MustNewConstMetric(agentClockOffsetDesc, prometheus.GaugeValue, st.OffsetSeconds, st.ServerID, st.Tag)
+		ch <- prometheus.MustNewConstMetric(agentClockSkewedDesc, prometheus.GaugeValue, skewed, st.ServerID, st.Tag)
+	}
+}
+
+// ClockStatuses возвращает оценки расхождения часов агентов
+func (s *MetricsServer) ClockStatuses() []ClockStatus {
+	return agentClocks.list()
+}
+
+// sampleTime выбирает время измерения: время сбора на агенте,
+// а если его нет или часы агента расходятся с сервером — время приёма
+func sampleTime(collectedAt *timestamppb.Timestamp, arrival time.Time, skewed bool) time.Time {
+	if collectedAt == nil || skewed {
+		return arrival
+	}
+	return collectedAt.AsTime()
+}
@@ -0,0 +1,75 @@
+package server
+
+import (
+	"github.com/vovakirdan/gohub/internal/labels"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// agentSeries — последние значения метрик одного агента
+type agentSeries struct {
+	serverID string
+	tag      string
+	labels   labels.Labels
+	values   [4]float64
+}
+
+// agentCollector отдаёт метрики агентов с произвольными лейблами.
+// Набор лейблов у разных агентов отличается, поэтому GaugeVec не подходит:
+// коллектор «непроверяемый» (Describe ничего не отдаёт) и строит описания на лету.
+type agentCollector struct {
+	mu     sync.RWMutex
+	series map[string]*agentSeries
+}
+
+// Имена и описания отдаваемых метрик, в порядке agentSeries.values
+var agentMetricOpts = [4]struct{ name, help string }{
+	{"agent_cpu_usage", "Current CPU usage (percent) from gRPC agents"},
+	{"agent_memory_usage", "Current memory usage (percent) from gRPC agents"},
+	{"agent_disk_usage", "Current disk usage (percent) from gRPC agents"},
+	{"agent_network_usage", "Current network usage (bytes) from gRPC agents"},
+}
+
+func newAgentCollector() *agentCollector {
+	return &agentCollector{series: make(map[string]*agentSeries)}
+}
+
+// Set обновляет значения серии
+func (c *agentCollector) Set(serverID, tag string, l labels.Labels, cpu, mem, disk, net float64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.series[serverID+":"+tag] = &agentSeries{
+		serverID: serverID,
+		tag:      tag,
+		labels:   l,
+		values:   [4]float64{cpu, mem, disk, net},
+	}
+}
+
+// Delete удаляет серию агента
+func (c *agentCollector) Delete(serverID, tag string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.series, serverID+":"+tag)
+}
+
+func (c *agentCollector) Describe(ch chan<- *prometheus.Desc) {}
+
+func (c *agentCollector) Collect(ch chan<- prometheus.Metric) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	for _, s := range c.series {
+		keys := s.labels.Keys()
+		names := append([]string{"server_id", "tag"}, keys...)
+		values := []string{s.serverID, s.tag}
+		for _, k := range keys {
+			values = append(values, s.labels[k])
+		}
+		for i, opts := range agentMetricOpts {
+			desc := prometheus.NewDesc(opts.name, opts.help, names, nil)
+			ch <- prometheus.MustNewConstMetric(desc, prometheus.GaugeValue, s.values[i], values...)
+		}
+	}
+}
@@ -0,0 +1,139 @@
+package server
+
+import (
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/vovakirdan/gohub/internal/api"
+	"github.com/vovakirdan/gohub/internal/config"
+)
+
+// MinSendIntervalMs — самый короткий интервал отправки, который сервер задаёт агентам
+const MinSendIntervalMs = 1000
+
+// Directives — указания агентам (весь парк или конкретный server_id)
+type Directives struct {
+	SendIntervalMs int64 `json:"send_interval_ms"`
+	SlowDown       bool  `json:"slow_down"`
+}
+
+// control хранит указания агентам и следит за нагрузкой на приём метрик
+type control struct {
+	maxInflight int64
+	inflight    atomic.Int64
+
+	mu        sync.RWMutex
+	fleet     Directives
+	perServer map[string]Directives
+	// агенты, от которых уже получен инвентарь (ключ server_id:tag)
+	inventory map[string]bool
+}
+
+func newControl(cfg config.AgentsConfig) *control {
+	return &control{
+		maxInflight: cfg.MaxInflight,
+		fleet:       Directives{SendIntervalMs: cfg.SendIntervalMs},
+		perServer:   make(map[string]Directives),
+		inventory:   make(map[string]bool),
+	}
+}
+
+// begin отмечает начало обработки запроса; возвращает функцию завершения
+func (c *control) begin() func() {
+	c.inflight.Add(1)
+	return func() { c.inflight.Add(-1) }
+}
+
+// saturated — приём перегружен
+func (c *control) saturated() bool {
+	return c.maxInflight > 0 && c.inflight.Load() > c.maxInflight
+}
+
+// markInventory запоминает, что инвентарь агента получен
+func (c *control) markInventory(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.inventory[key] = true
+}
+
+// requestInventory просит агентов (serverID, tag="" — все теги) повторно прислать инвентарь
+func (c *control) requestInventory(serverID, tag string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if tag != "" {
+		delete(c.inventory, serverID+":"+tag)
+		return
+	}
+	for key := range c.inventory {
+		if strings.HasPrefix(key, serverID+":") {
+			delete(c.inventory, key)
+		}
+	}
+}
+
+// forget забывает состояние агента
+func (c *control) forget(serverID, tag string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.inventory, serverID+":"+tag)
+}
+
+// respond дополняет ответ агенту указаниями
+func (c *control) respond(resp *api.MetricsResponse, serverID, tag string) *api.MetricsResponse {
+	c.mu.RLock()
+	d := c.fleet
+	if override, ok := c.perServer[serverID]; ok {
+		if override.SendIntervalMs > 0 {
+			d.SendIntervalMs = override.SendIntervalMs
+		}
+		d.SlowDown = d.SlowDown || override.SlowDown
+	}
+	resp.ResendInventory = !c.inventory[serverID+":"+tag]
+	c.mu.RUnlock()
+
+	resp.SendIntervalMs = d.SendIntervalMs
+	resp.SlowDown = d.SlowDown || c.saturated()
+	return resp
+}
+
+// sendIntervalMs — интервал отправки из указаний для сервера (0 — агент использует свой)
+func (c *control) sendIntervalMs(serverID string) int64 {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if override, ok := c.perServer[serverID]; ok && override.SendIntervalMs > 0 {
+		return override.SendIntervalMs
+	}
+	return c.fleet.SendIntervalMs
+}
+
+// FleetDirectives возвращает указания для всего парка и по серверам
+func (s *MetricsServer) FleetDirectives() (Directives, map[string]Directives) {
+	s.control.mu.RLock()
+	defer s.control.mu.RUnlock()
+	perServer := make(map[string]Directives, len(s.control.perServer))
+	for k, v := range s.control.perServer {
+		perServer[k] = v
+	}
+	return s.control.fleet, perServer
+}
+
+// SetDirectives задаёт указания для всего парка (serverID="") или одного сервера.
+// Нулевые указания для сервера снимают переопределение.
+func (s *MetricsServer) SetDirectives(serverID string, d Directives) {
+	s.control.mu.Lock()
+	defer s.control.mu.Unlock()
+	switch {
+	case serverID == "":
+		s.control.fleet = d
+	case d == Directives{}:
+		delete(s.control.perServer, serverID)
+	default:
+		s.control.perServer[serverID] = d
+	}
+}
+
+// RequestInventory просит агента повторно прислать инвентарь со следующим запросом
+func (s *MetricsServer) RequestInventory(serverID, tag string) {
+	s.control.requestInventory(serverID, tag)
+}
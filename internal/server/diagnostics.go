@@ -0,0 +1,309 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"strings"
+	"sync"
+	"unicode/utf8"
+
+	"github.com/vovakirdan/gohub/internal/api"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// Статусы запросов диагностики
+const (
+	diagQueued   = "queued"
+	diagSent     = "sent"
+	diagRunning  = "running"
+	diagDone     = "done"
+	diagFailed   = "failed"
+	diagRejected = "rejected"
+	diagTimeout  = "timeout"
+)
+
+// diagnosticWatchers — агенты, подписанные на запросы диагностики (ключ server_id:tag)
+type diagnosticWatchers struct {
+	mu       sync.Mutex
+	watchers map[string]chan *api.DiagnosticRequest
+	// адрес (без порта) подписки, получившей запрос, до завершения команды
+	sentTo map[int64]string
+}
+
+func newDiagnosticWatchers() *diagnosticWatchers {
+	return &diagnosticWatchers{
+		watchers: make(map[string]chan *api.DiagnosticRequest),
+		sentTo:   make(map[int64]string),
+	}
+}
+
+// sent запоминает, по какому адресу отправлен запрос
+func (d *diagnosticWatchers) sent(id int64, host string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.sentTo[id] = host
+}
+
+// sentHost возвращает адрес, по которому отправлен запрос; пусто — неизвестно (например, после перезапуска)
+func (d *diagnosticWatchers) sentHost(id int64) string {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.sentTo[id]
+}
+
+func (d *diagnosticWatchers) finished(id int64) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	delete(d.sentTo, id)
+}
+
+// subscribe регистрирует агента; предыдущая подписка того же агента закрывается
+func (d *diagnosticWatchers) subscribe(key string) chan *api.DiagnosticRequest {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if old, ok := d.watchers[key]; ok {
+		close(old)
+	}
+	ch := make(chan *api.DiagnosticRequest, 16)
+	d.watchers[key] = ch
+	return ch
+}
+
+func (d *diagnosticWatchers) unsubscribe(key string, ch chan *api.DiagnosticRequest) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if cur, ok := d.watchers[key]; ok && cur == ch {
+		close(ch)
+		delete(d.watchers, key)
+	}
+}
+
+// notify передаёт запрос подписанному агенту; если агент не подключён, запрос остаётся в очереди БД
+func (d *diagnosticWatchers) notify(key string, req *api.DiagnosticRequest) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if ch, ok := d.watchers[key]; ok {
+		select {
+		case ch <- req:
+		default:
+			// Буфер полон — агент заберёт запрос из БД при переподключении
+		}
+	}
+}
+
+// QueueDiagnostic ставит команду в очередь агента и записывает событие в аудит
+func (s *MetricsServer) QueueDiagnostic(ctx context.Context, serverID, tag, command, actor string) (int64, error) {
+	if serverID == "" || command == "" {
+		return 0, fmt.Errorf("server_id and command are required")
+	}
+	id, err := s.storage.CreateDiagnostic(ctx, serverID, tag, command, actor)
+	if err != nil {
+		return 0, err
+	}
+	s.auditDiagnostic(ctx, id, "requested", actor, fmt.Sprintf("%s/%s: %s", serverID, tag, command))
+
+	s.diagnostics.notify(serverID+":"+tag, &api.DiagnosticRequest{Id: id, Command: command})
+	return id, nil
+}
+
+// WatchDiagnostics отдаёт агенту запросы диагностики: сначала накопленные в очереди, затем новые
+func (s *MetricsServer) WatchDiagnostics(req *api.WatchDiagnosticsRequest, stream api.MetricsService_WatchDiagnosticsServer) error {
+	if req.ServerId == "" {
+		return status.Error(codes.InvalidArgument, "server_id is required")
+	}
+	ctx := stream.Context()
+	key := req.ServerId + ":" + req.Tag
+	ch := s.diagnostics.subscribe(key)
+	defer s.diagnostics.unsubscribe(key, ch)
+
+	log.Printf("Agent %s/%s subscribed to diagnostics", req.ServerId, req.Tag)
+
+	queued, err := s.storage.LoadDiagnostics(ctx, req.ServerId, req.Tag, diagQueued, 100)
+	if err != nil {
+		return status.Errorf(codes.Unavailable, "failed to load queued diagnostics: %v", err)
+	}
+	// В БД записи отсортированы от новых к старым, отправляем в порядке постановки
+	for i := len(queued) - 1; i >= 0; i-- {
+		if err := s.sendDiagnostic(ctx, stream, &api.DiagnosticRequest{Id: queued[i].ID, Command: queued[i].Command}); err != nil {
+			return err
+		}
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-s.done:
+			return errShuttingDown
+		case dr, ok := <-ch:
+			if !ok {
+				// Агент переподключился другим потоком
+				return nil
+			}
+			if err := s.sendDiagnostic(ctx, stream, dr); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// sendDiagnostic забирает запрос из очереди (queued -> sent) и отправляет агенту
+func (s *MetricsServer) sendDiagnostic(ctx context.Context, stream api.MetricsService_WatchDiagnosticsServer, dr *api.DiagnosticRequest) error {
+	claimed, err := s.storage.TransitionDiagnostic(ctx, dr.Id, diagQueued, diagSent)
+	if err != nil {
+		return status.Errorf(codes.Unavailable, "failed to update diagnostic %d: %v", dr.Id, err)
+	}
+	if !claimed {
+		return nil
+	}
+	if err := stream.Send(dr); err != nil {
+		// Возвращаем в очередь, чтобы отправить при переподключении
+		if _, err := s.storage.TransitionDiagnostic(context.Background(), dr.Id, diagSent, diagQueued); err != nil {
+			log.Printf("Failed to requeue diagnostic %d: %v", dr.Id, err)
+		}
+		return err
+	}
+	s.diagnostics.sent(dr.Id, peerHost(ctx))
+	s.auditDiagnostic(ctx, dr.Id, "sent", peerAddr(ctx), dr.Command)
+	return nil
+}
+
+// checkDiagnosticReporter проверяет, что вывод присылает агент, которому отправлена команда:
+// server_id и tag сообщения совпадают с диагностикой, а адрес — с адресом подписки, получившей запрос.
+// Агенты без server_id в выводе проверяются только по адресу.
+func (s *MetricsServer) checkDiagnosticReporter(ctx context.Context, out *api.DiagnosticOutput) error {
+	row, err := s.storage.LoadDiagnostic(ctx, out.Id)
+	if err != nil {
+		return status.Errorf(codes.Unavailable, "failed to load diagnostic %d: %v", out.Id, err)
+	}
+	if row == nil {
+		return status.Errorf(codes.NotFound, "diagnostic %d not found", out.Id)
+	}
+	if row.Status != diagSent && row.Status != diagRunning {
+		return status.Errorf(codes.FailedPrecondition, "diagnostic %d is %s", out.Id, row.Status)
+	}
+	host := s.diagnostics.sentHost(out.Id)
+	var reason string
+	switch {
+	case out.ServerId == "" && host == "":
+		reason = "server_id is required to verify the reporting agent"
+	case out.ServerId != "" && (out.ServerId != row.ServerID || out.Tag != row.Tag):
+		reason = fmt.Sprintf("reported by %s/%s, sent to %s/%s", out.ServerId, out.Tag, row.ServerID, row.Tag)
+	case host != "" && host != peerHost(ctx):
+		reason = fmt.Sprintf("reported from %s, sent to %s", peerHost(ctx), host)
+	default:
+		return nil
+	}
+	s.auditDiagnostic(ctx, out.Id, "report_denied", peerAddr(ctx), reason)
+	return status.Errorf(codes.PermissionDenied, "diagnostic %d: %s", out.Id, reason)
+}
+
+// ReportDiagnostic принимает вывод команды от агента
+func (s *MetricsServer) ReportDiagnostic(stream api.MetricsService_ReportDiagnosticServer) error {
+	ctx := stream.Context()
+	started := map[int64]bool{}
+	// незавершённый UTF-8-символ в конце предыдущего фрагмента
+	pending := map[int64][]byte{}
+
+	for {
+		out, err := stream.Recv()
+		if err == io.EOF {
+			return stream.SendAndClose(&api.DiagnosticAck{Status: "OK"})
+		}
+		if err != nil {
+			return err
+		}
+
+		if !started[out.Id] {
+			if err := s.checkDiagnosticReporter(ctx, out); err != nil {
+				return err
+			}
+			started[out.Id] = true
+			if _, err := s.storage.TransitionDiagnostic(ctx, out.Id, diagSent, diagRunning); err != nil {
+				return status.Errorf(codes.Unavailable, "failed to update diagnostic %d: %v", out.Id, err)
+			}
+		}
+
+		text, rest := diagnosticText(append(pending[out.Id], out.Data...), out.Done)
+		pending[out.Id] = rest
+		if text != "" {
+			if err := s.storage.AppendDiagnosticOutput(ctx, out.Id, text); err != nil {
+				return status.Errorf(codes.Unavailable, "failed to save output of diagnostic %d: %v", out.Id, err)
+			}
+		}
+
+		if out.Done {
+			errText, _ := diagnosticText([]byte(out.Error), true)
+			result := diagDone
+			switch {
+			case out.Rejected:
+				result = diagRejected
+			case out.TimedOut:
+				result = diagTimeout
+			case out.Error != "":
+				result = diagFailed
+			}
+			if err := s.storage.FinishDiagnostic(ctx, out.Id, result, out.ExitCode, errText, out.Truncated); err != nil {
+				return status.Errorf(codes.Unavailable, "failed to finish diagnostic %d: %v", out.Id, err)
+			}
+			s.auditDiagnostic(ctx, out.Id, result, peerAddr(ctx),
+				fmt.Sprintf("exit_code=%d truncated=%t %s", out.ExitCode, out.Truncated, errText))
+			s.diagnostics.finished(out.Id)
+			delete(pending, out.Id)
+		}
+	}
+}
+
+// diagnosticText готовит фрагмент вывода для текстовой колонки output. Символ UTF-8, разрезанный границей
+// фрагмента, возвращается в rest и дописывается со следующим фрагментом (в последнем — заменяется).
+// Некорректные байты и NUL, которые Postgres не примет в TEXT, заменяются на U+FFFD.
+func diagnosticText(data []byte, final bool) (text string, rest []byte) {
+	cut := len(data)
+	if !final {
+		// Ищем начало последнего символа среди последних UTFMax байтов
+		for i := len(data) - 1; i >= 0 && i >= len(data)-utf8.UTFMax; i-- {
+			if utf8.RuneStart(data[i]) {
+				if !utf8.FullRune(data[i:]) {
+					cut = i
+				}
+				break
+			}
+		}
+	}
+	if cut < len(data) {
+		rest = append([]byte(nil), data[cut:]...)
+	}
+	text = strings.ToValidUTF8(string(data[:cut]), "\uFFFD")
+	return strings.ReplaceAll(text, "\x00", "\uFFFD"), rest
+}
+
+// auditDiagnostic пишет событие в журнал аудита (и в лог сервера)
+func (s *MetricsServer) auditDiagnostic(ctx context.Context, id int64, event, actor, details string) {
+	log.Printf("Diagnostic audit: id=%d event=%s actor=%s details=%q", id, event, actor, details)
+	if err := s.storage.SaveDiagnosticAudit(ctx, id, event, actor, details); err != nil {
+		log.Printf("Failed to save diagnostic audit: %v", err)
+	}
+}
+
+// peerHost возвращает адрес клиента gRPC без порта
+func peerHost(ctx context.Context) string {
+	addr := peerAddr(ctx)
+	if host, _, err := net.SplitHostPort(addr); err == nil {
+		return host
+	}
+	return addr
+}
+
+// peerAddr возвращает адрес клиента gRPC
+func peerAddr(ctx context.Context) string {
+	if p, ok := peer.FromContext(ctx); ok && p.Addr != nil {
+		return p.Addr.String()
+	}
+	return ""
+}
@@ -0,0 +1,50 @@
+package server
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestDiagnosticTextSplitRunes(t *testing.T) {
+	const output = "диск заполнен ✓ 100%"
+	data := []byte(output)
+	// Режем вывод на фрагменты по 3 байта: почти каждый символ разрезан границей
+	var pending []byte
+	var sb strings.Builder
+	for i := 0; i < len(data); i += 3 {
+		end := min(i+3, len(data))
+		text, rest := diagnosticText(append(pending, data[i:end]...), false)
+		pending = rest
+		sb.WriteString(text)
+	}
+	text, rest := diagnosticText(pending, true)
+	sb.WriteString(text)
+	if rest != nil {
+		t.Fatalf("final chunk left %q", rest)
+	}
+	if sb.String() != output {
+		t.Fatalf("got %q, want %q", sb.String(), output)
+	}
+}
+
+func TestDiagnosticTextInvalidBytes(t *testing.T) {
+	cases := []struct {
+		data  string
+		final bool
+		text  string
+		rest  string
+	}{
+		{"a\x00b", false, "a�b", ""},
+		{"ok\xff", false, "ok�", ""},
+		// Незавершённый символ ждёт следующего фрагмента
+		{"ok\xd0", false, "ok", "\xd0"},
+		// В последнем фрагменте (вывод обрезан по лимиту) он заменяется
+		{"ok\xd0", true, "ok�", ""},
+	}
+	for _, c := range cases {
+		text, rest := diagnosticText([]byte(c.data), c.final)
+		if text != c.text || string(rest) != c.rest {
+			t.Errorf("diagnosticText(%q, %v) = %q, %q; want %q, %q", c.data, c.final, text, rest, c.text, c.rest)
+		}
+	}
+}
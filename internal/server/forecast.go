@@ -0,0 +1,380 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/vovakirdan/gohub/internal/config"
+	"github.com/vovakirdan/gohub/internal/db"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Параметры прогноза по умолчанию, если в конфиге не заданы
+const (
+	defaultForecastInterval  = 5 * time.Minute
+	defaultForecastMinPoints = 10
+	defaultForecastHorizon   = 365 * 24 * time.Hour
+)
+
+var (
+	defaultForecastMetrics = []string{"disk_usage", "memory_usage"}
+	defaultForecastWindows = []time.Duration{24 * time.Hour, 7 * 24 * time.Hour}
+)
+
+const (
+	// Метрики в процентах: заполнение — 100
+	forecastCapacity = 100
+	// Самое короткое окно тренда
+	minForecastWindow = time.Hour
+	// Таймаут регрессии по одному окну одной метрики
+	forecastQueryTimeout = 30 * time.Second
+)
+
+var (
+	forecastTimeToFull = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "gohub_forecast_time_to_full_seconds",
+		Help: "Predicted time until the metric reaches 100% by the linear trend over the window",
+	}, []string{"server_id", "tag", "metric", "window"})
+	forecastGrowth = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "gohub_forecast_growth_per_hour",
+		Help: "Linear trend of the metric over the window in percentage points per hour",
+	}, []string{"server_id", "tag", "metric", "window"})
+	forecastErrors = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "gohub_forecast_errors_total",
+		Help: "Failed trend queries",
+	})
+)
+
+func init() {
+	prometheus.MustRegister(forecastTimeToFull, forecastGrowth, forecastErrors)
+}
+
+// Forecast — прогноз заполнения метрики сервера по линейному тренду за окно
+type Forecast struct {
+	ServerID string            `json:"server_id"`
+	Tag      string            `json:"tag"`
+	Labels   map[string]string `json:"labels,omitempty"`
+	Metric   string            `json:"metric"`
+	Window   string            `json:"window"`
+	Points   int64             `json:"points"`
+	// Последнее значение и значение тренда на момент прогноза
+	Current       float64 `json:"current"`
+	Trend         float64 `json:"trend"`
+	GrowthPerHour float64 `json:"growth_per_hour"`
+	R2            float64 `json:"r2"`
+	// Время до 100% (нет, если значение не растёт или заполнится позже горизонта)
+	TimeToFull *float64   `json:"time_to_full_seconds,omitempty"`
+	FullAt     *time.Time `json:"full_at,omitempty"`
+	UpdatedAt  time.Time  `json:"updated_at"`
+
+	window time.Duration
+}
+
+// formatWindow печатает окно без нулевых хвостов: 24h, 168h, 1h30m
+func formatWindow(d time.Duration) string {
+	s := d.String()
+	s = strings.TrimSuffix(s, "0s")
+	if strings.HasSuffix(s, "h0m") {
+		s = strings.TrimSuffix(s, "0m")
+	}
+	return s
+}
+
+// forecaster — последние прогнозы по серверам, метрикам и окнам
+type forecaster struct {
+	enabled   bool
+	metrics   []string
+	windows   []time.Duration
+	interval  time.Duration
+	minPoints int
+	horizon   time.Duration
+
+	mu        sync.RWMutex
+	forecasts []Forecast
+}
+
+// newForecaster проверяет конфиг прогноза; retention > 0 — заданный срок хранения истории,
+// окна длиннее него не строятся: старые данные к тому времени уже удалены
+func newForecaster(cfg config.ForecastConfig, retention time.Duration) (*forecaster, error) {
+	f := &forecaster{
+		enabled:   cfg.Enabled,
+		metrics:   cfg.Metrics,
+		windows:   cfg.Windows,
+		interval:  cfg.Interval,
+		minPoints: cfg.MinPoints,
+		horizon:   cfg.Horizon,
+	}
+	if len(f.metrics) == 0 {
+		f.metrics = defaultForecastMetrics
+	}
+	if len(f.windows) == 0 {
+		f.windows = defaultForecastWindows
+	}
+	if f.interval <= 0 {
+		f.interval = defaultForecastInterval
+	}
+	if f.minPoints < 2 {
+		f.minPoints = defaultForecastMinPoints
+	}
+	if f.horizon <= 0 {
+		f.horizon = defaultForecastHorizon
+	}
+	for _, m := range f.metrics {
+		if !db.IsMetricColumn(m) {
+			return nil, fmt.Errorf("forecast.metrics: %q is not a field of the metrics table", m)
+		}
+	}
+	for _, w := range f.windows {
+		if w < minForecastWindow {
+			return nil, fmt.Errorf("forecast.windows: window must be at least %s, got %s", minForecastWindow, w)
+		}
+		if f.enabled && retention > 0 && w > retention {
+			return nil, fmt.Errorf("forecast.windows: window %s is longer than database.retention %s", formatWindow(w), formatWindow(retention))
+		}
+	}
+	return f, nil
+}
+
+// longestWindow — самое длинное окно включённого прогноза (0, если прогноз выключен)
+func (f *forecaster) longestWindow() time.Duration {
+	var longest time.Duration
+	if f.enabled {
+		for _, w := range f.windows {
+			longest = max(longest, w)
+		}
+	}
+	return longest
+}
+
+// tracks — прогноз по метрике и окну вычисляется
+func (f *forecaster) tracks(metric string, window time.Duration) bool {
+	if !f.enabled {
+		return false
+	}
+	for _, m := range f.metrics {
+		if m != metric {
+			continue
+		}
+		for _, w := range f.windows {
+			if w == window {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// forecast переводит тренд в прогноз на момент now; nil — точек меньше min_points
+func (f *forecaster) forecast(row db.TrendRow, metric string, window time.Duration, now time.Time) *Forecast {
+	if row.Points < int64(f.minPoints) {
+		return nil
+	}
+	trend := row.Intercept + row.Slope*now.Sub(row.Since).Seconds()
+	fc := &Forecast{
+		ServerID:      row.ServerID,
+		Tag:           row.Tag,
+		Metric:        metric,
+		Window:        formatWindow(window),
+		Points:        row.Points,
+		Current:       row.LastValue,
+		Trend:         trend,
+		GrowthPerHour: row.Slope * time.Hour.Seconds(),
+		R2:            row.R2,
+		UpdatedAt:     now,
+		window:        window,
+	}
+	var ttf float64
+	switch {
+	case row.LastValue >= forecastCapacity:
+		ttf = 0
+	case row.Slope > 0:
+		ttf = max((forecastCapacity-trend)/row.Slope, 0)
+	default:
+		return fc
+	}
+	if ttf > f.horizon.Seconds() {
+		return fc
+	}
+	fullAt := now.Add(time.Duration(ttf * float64(time.Second)))
+	fc.TimeToFull, fc.FullAt = &ttf, &fullAt
+	return fc
+}
+
+// set заменяет прогнозы и серии Prometheus
+func (f *forecaster) set(forecasts []Forecast) {
+	sort.Slice(forecasts, func(i, j int) bool {
+		a, b := &forecasts[i], &forecasts[j]
+		if a.ServerID != b.ServerID {
+			return a.ServerID < b.ServerID
+		}
+		if a.Tag != b.Tag {
+			return a.Tag < b.Tag
+		}
+		if a.Metric != b.Metric {
+			return a.Metric < b.Metric
+		}
+		return a.window < b.window
+	})
+	f.mu.Lock()
+	f.forecasts = forecasts
+	f.mu.Unlock()
+
+	forecastTimeToFull.Reset()
+	forecastGrowth.Reset()
+	for _, fc := range forecasts {
+		forecastGrowth.WithLabelValues(fc.ServerID, fc.Tag, fc.Metric, fc.Window).Set(fc.GrowthPerHour)
+		if fc.TimeToFull != nil {
+			forecastTimeToFull.WithLabelValues(fc.ServerID, fc.Tag, fc.Metric, fc.Window).Set(*fc.TimeToFull)
+		}
+	}
+}
+
+// forget удаляет прогнозы сервера/тега
+func (f *forecaster) forget(serverID, tag string) {
+	f.mu.Lock()
+	kept := f.forecasts[:0:0]
+	for _, fc := range f.forecasts {
+		if fc.ServerID != serverID || fc.Tag != tag {
+			kept = append(kept, fc)
+		}
+	}
+	f.forecasts = kept
+	f.mu.Unlock()
+	match := prometheus.Labels{"server_id": serverID, "tag": tag}
+	forecastTimeToFull.DeletePartialMatch(match)
+	forecastGrowth.DeletePartialMatch(match)
+}
+
+// runForecasts пересчитывает прогнозы сразу и затем каждые forecast.interval до остановки
+func (s *MetricsServer) runForecasts() {
+	s.updateForecasts(time.Now())
+	ticker := time.NewTicker(s.forecasts.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			s.updateForecasts(time.Now())
+		case <-s.done:
+			return
+		}
+	}
+}
+
+// updateForecasts строит тренды по всем метрикам и окнам, обновляет прогнозы и вычисляет правила forecast(...).
+// Прогнозируются только серверы из реестра; при ошибке запроса остаются прежние прогнозы этого окна.
+func (s *MetricsServer) updateForecasts(now time.Time) {
+	f := s.forecasts
+	ctx, cancel := context.WithTimeout(context.Background(), forecastQueryTimeout)
+	servers, err := s.storage.LoadServers(ctx, nil)
+	cancel()
+	if err != nil {
+		forecastErrors.Inc()
+		log.Printf("Failed to load servers for forecast: %v", err)
+		return
+	}
+	registry := make(map[string]map[string]string, len(servers))
+	for _, srv := range servers {
+		registry[srv.ServerID+":"+srv.Tag] = srv.Labels
+	}
+
+	f.mu.RLock()
+	prev := f.forecasts
+	f.mu.RUnlock()
+
+	var result []Forecast
+	for _, metric := range f.metrics {
+		for _, window := range f.windows {
+			ctx, cancel := context.WithTimeout(context.Background(), forecastQueryTimeout)
+			rows, err := s.storage.LoadTrends(ctx, metric, now.Add(-window))
+			cancel()
+			if err != nil {
+				forecastErrors.Inc()
+				log.Printf("Failed to load %s trend over %s: %v", metric, formatWindow(window), err)
+				for _, fc := range prev {
+					if fc.Metric == metric && fc.window == window {
+						result = append(result, fc)
+					}
+				}
+				continue
+			}
+			for _, row := range rows {
+				l, ok := registry[row.ServerID+":"+row.Tag]
+				if !ok {
+					continue
+				}
+				if fc := f.forecast(row, metric, window, now); fc != nil {
+					fc.Labels = l
+					result = append(result, *fc)
+				}
+			}
+		}
+	}
+	f.set(result)
+
+	// Серверы в обслуживании правила не вычисляют, их оповещения остаются как есть
+	paused := make(map[string]bool)
+	for _, fc := range result {
+		if s.maintenance.window(fc.ServerID, fc.Tag, fc.Labels) != "" {
+			paused[fc.ServerID+":"+fc.Tag] = true
+		}
+	}
+	s.alerts.observeForecasts(result, paused, now)
+}
+
+// Forecasts возвращает прогнозы (пустые фильтры — все)
+func (s *MetricsServer) Forecasts(serverID, tag, metric string) []Forecast {
+	f := s.forecasts
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	result := make([]Forecast, 0, len(f.forecasts))
+	for _, fc := range f.forecasts {
+		if (serverID != "" && fc.ServerID != serverID) || (tag != "" && fc.Tag != tag) || (metric != "" && fc.Metric != metric) {
+			continue
+		}
+		result = append(result, fc)
+	}
+	return result
+}
+
+// ForecastReport возвращает по каждому серверу/тегу и метрике самый срочный прогноз среди окон,
+// отсортированные по времени до заполнения. Серверы без роста в отчёт не попадают;
+// within > 0 оставляет заполняющиеся не позже чем через within, limit > 0 ограничивает число строк.
+func (s *MetricsServer) ForecastReport(metric string, within time.Duration, limit int) []Forecast {
+	urgent := make(map[string]Forecast)
+	for _, fc := range s.Forecasts("", "", metric) {
+		if fc.TimeToFull == nil || (within > 0 && *fc.TimeToFull > within.Seconds()) {
+			continue
+		}
+		key := fc.ServerID + ":" + fc.Tag + ":" + fc.Metric
+		if cur, ok := urgent[key]; !ok || *fc.TimeToFull < *cur.TimeToFull {
+			urgent[key] = fc
+		}
+	}
+	result := make([]Forecast, 0, len(urgent))
+	for _, fc := range urgent {
+		result = append(result, fc)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		a, b := &result[i], &result[j]
+		if *a.TimeToFull != *b.TimeToFull {
+			return *a.TimeToFull < *b.TimeToFull
+		}
+		if a.ServerID != b.ServerID {
+			return a.ServerID < b.ServerID
+		}
+		if a.Tag != b.Tag {
+			return a.Tag < b.Tag
+		}
+		return a.Metric < b.Metric
+	})
+	if limit > 0 && len(result) > limit {
+		result = result[:limit]
+	}
+	return result
+}
@@ -0,0 +1,24 @@
+package server
+
+import (
+	"net/http"
+
+	"github.com/improbable-eng/grpc-web/go/grpcweb"
+)
+
+// GRPCWebHandler оборачивает обработчик HTTP-порта: запросы gRPC-Web (и их CORS preflight)
+// обслуживает тот же gRPC-сервер, что и агентов, остальные уходят в next.
+// Поддерживаются обычные и серверные потоковые RPC; клиентские потоки gRPC-Web не поддерживает.
+func (s *MetricsServer) GRPCWebHandler(next http.Handler) http.Handler {
+	wrapped := grpcweb.WrapServer(s.grpcServer,
+		// Как и остальной HTTP API, доступен с любого домена
+		grpcweb.WithOriginFunc(func(origin string) bool { return true }),
+	)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if wrapped.IsGrpcWebRequest(r) || wrapped.IsAcceptableGrpcCorsRequest(r) {
+			s.serveGRPCHTTP(wrapped, w, r)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
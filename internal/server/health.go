@@ -0,0 +1,55 @@
+package server
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/vovakirdan/gohub/internal/api"
+	metricsv1 "github.com/vovakirdan/gohub/pkg/api/metrics/v1"
+
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+// Как часто проверять соединение с БД для grpc.health.v1
+const healthCheckInterval = 10 * time.Second
+
+// Таймаут одной проверки
+const healthCheckTimeout = 2 * time.Second
+
+// watchHealth выставляет статус health-сервиса по доступности БД: без БД приём метрик не работает
+func (s *MetricsServer) watchHealth(hs *health.Server) {
+	ticker := time.NewTicker(healthCheckInterval)
+	defer ticker.Stop()
+
+	last := healthpb.HealthCheckResponse_UNKNOWN
+	for {
+		ctx, cancel := context.WithTimeout(context.Background(), healthCheckTimeout)
+		err := s.storage.Ping(ctx)
+		cancel()
+
+		st := healthpb.HealthCheckResponse_SERVING
+		if err != nil {
+			st = healthpb.HealthCheckResponse_NOT_SERVING
+		}
+		if st != last {
+			if err != nil {
+				log.Printf("Health: database is unavailable: %v", err)
+			} else {
+				log.Printf("Health: serving")
+			}
+			last = st
+		}
+		// Пустое имя — сервер в целом
+		hs.SetServingStatus("", st)
+		hs.SetServingStatus(api.MetricsService_ServiceDesc.ServiceName, st)
+		hs.SetServingStatus(metricsv1.MetricsService_ServiceDesc.ServiceName, st)
+
+		select {
+		case <-ticker.C:
+		case <-s.done:
+			return
+		}
+	}
+}
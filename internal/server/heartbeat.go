@@ -0,0 +1,176 @@
+package server
+
+import (
+	"context"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/vovakirdan/gohub/internal/api"
+	"github.com/vovakirdan/gohub/internal/db"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Интервал heartbeat по умолчанию, если агент его не сообщил
+const defaultHeartbeatInterval = 10 * time.Second
+
+// Сколько интервалов heartbeat можно пропустить, прежде чем агент считается недоступным
+const heartbeatMissedLimit = 3
+
+var agentUpDesc = prometheus.NewDesc(
+	"agent_up",
+	"Whether the agent has sent a heartbeat recently (1) or not (0)",
+	[]string{"server_id", "tag"}, nil,
+)
+
+var agentLastSeenDesc = prometheus.NewDesc(
+	"agent_last_seen_timestamp_seconds",
+	"Unix time of the last heartbeat received from the agent",
+	[]string{"server_id", "tag"}, nil,
+)
+
+// Последние heartbeat агентов (отдаются в Prometheus как agent_up)
+var agentHeartbeats = newHeartbeats()
+
+// heartbeats хранит время последнего heartbeat по агентам (ключ server_id:tag)
+type heartbeats struct {
+	mu   sync.RWMutex
+	last map[string]db.HeartbeatRow
+}
+
+func newHeartbeats() *heartbeats {
+	return &heartbeats{last: make(map[string]db.HeartbeatRow)}
+}
+
+func (h *heartbeats) set(hb db.HeartbeatRow) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.last[hb.ServerID+":"+hb.Tag] = hb
+}
+
+// get возвращает последний heartbeat агента
+func (h *heartbeats) get(serverID, tag string) (db.HeartbeatRow, bool) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	hb, ok := h.last[serverID+":"+tag]
+	return hb, ok
+}
+
+// delete забывает heartbeat агента
+func (h *heartbeats) delete(serverID, tag string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	delete(h.last, serverID+":"+tag)
+}
+
+// list возвращает копию последних heartbeat, отсортированную по server_id/tag
+func (h *heartbeats) list() []db.HeartbeatRow {
+	h.mu.RLock()
+	result := make([]db.HeartbeatRow, 0, len(h.last))
+	for _, hb := range h.last {
+		result = append(result, hb)
+	}
+	h.mu.RUnlock()
+
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].ServerID != result[j].ServerID {
+			return result[i].ServerID < result[j].ServerID
+		}
+		return result[i].Tag < result[j].Tag
+	})
+	return result
+}
+
+// isUp — агент присылал heartbeat в пределах допустимого окна
+func isUp(hb db.HeartbeatRow, now time.Time) bool {
+	interval := time.Duration(hb.IntervalMs) * time.Millisecond
+	if interval <= 0 {
+		interval = defaultHeartbeatInterval
+	}
+	return now.Sub(hb.LastSeen) <= heartbeatMissedLimit*interval
+}
+
+func (h *heartbeats) Describe(ch chan<- *prometheus.Desc) {
+	ch <- agentUpDesc
+	ch <- agentLastSeenDesc
+}
+
+func (h *heartbeats) Collect(ch chan<- prometheus.Metric) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	now := time.Now()
+	for _, hb := range h.last {
+		up := 0.0
+		if isUp(hb, now) {
+			up = 1
+		}
+		ch <- prometheus.MustNewConstMetric(agentUpDesc, prometheus.GaugeValue, up, hb.ServerID, hb.Tag)
+		ch <- prometheus.MustNewConstMetric(agentLastSeenDesc, prometheus.GaugeValue,
+			float64(hb.LastSeen.UnixNano())/1e9, hb.ServerID, hb.Tag)
+	}
+}
+
+// LoadHeartbeats загружает последние heartbeat из БД (после рестарта сервера)
+func (s *MetricsServer) LoadHeartbeats(ctx context.Context) error {
+	rows, err := s.storage.LoadHeartbeats(ctx)
+	if err != nil {
+		return err
+	}
+	for _, hb := range rows {
+		agentHeartbeats.set(hb)
+	}
+	return nil
+}
+
+// HeartbeatStatus — последний heartbeat агента с признаком доступности
+type HeartbeatStatus struct {
+	db.HeartbeatRow
+	Up bool `json:"up"`
+}
+
+// HeartbeatStatuses возвращает последние heartbeat агентов
+func (s *MetricsServer) HeartbeatStatuses() []HeartbeatStatus {
+	now := time.Now()
+	rows := agentHeartbeats.list()
+	result := make([]HeartbeatStatus, 0, len(rows))
+	for _, hb := range rows {
+		result = append(result, HeartbeatStatus{HeartbeatRow: hb, Up: isUp(hb, now)})
+	}
+	return result
+}
+
+// Heartbeat обрабатывает heartbeat агента
+func (s *MetricsServer) Heartbeat(ctx context.Context, req *api.HeartbeatRequest) (*api.HeartbeatResponse, error) {
+	if s.shuttingDown() {
+		return nil, errShuttingDown
+	}
+	if err := s.validator.validateHeartbeat(req); err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	agentClocks.observe(req.ServerId, req.Tag, req.SentAt, now, s.maxClockSkew)
+
+	hb := db.HeartbeatRow{
+		ServerID:      req.ServerId,
+		Tag:           req.Tag,
+		LastSeen:      now,
+		IntervalMs:    req.IntervalMs,
+		UptimeSeconds: req.UptimeSeconds,
+		AgentVersion:  req.AgentVersion,
+	}
+	hb.RemoteAddr = peerAddr(ctx)
+	agentHeartbeats.set(hb)
+
+	if err := s.storage.SaveHeartbeat(ctx, hb); err != nil {
+		// Состояние в памяти уже обновлено, агенту ошибку БД не возвращаем
+		log.Printf("Failed to save heartbeat for %s/%s: %v", req.ServerId, req.Tag, err)
+	}
+	s.touchServer(ctx, req.ServerId, req.Tag, nil, now)
+	s.latest.update(req.ServerId, req.Tag, nil, nil, time.Time{}, nil, now)
+
+	return &api.HeartbeatResponse{Status: "OK"}, nil
+}
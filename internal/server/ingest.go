@@ -0,0 +1,140 @@
+package server
+
+import (
+	"context"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+
+	"github.com/vovakirdan/gohub/internal/api"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+)
+
+// Максимальный размер тела запроса /api/ingest
+const maxIngestBodySize = 1 << 20
+
+// IngestHandler принимает MetricsRequest по HTTP (POST /api/ingest) в JSON или protobuf.
+// Используется агентами, у которых gRPC (HTTP/2) режется прокси. Обработка та же, что у SendMetrics.
+func (s *MetricsServer) IngestHandler() http.HandlerFunc {
+	return protoHandler(
+		func() proto.Message { return &api.MetricsRequest{} },
+		func(ctx context.Context, m proto.Message) (proto.Message, error) {
+			return s.SendMetrics(ctx, m.(*api.MetricsRequest))
+		},
+	)
+}
+
+// HeartbeatHandler принимает HeartbeatRequest по HTTP (POST /api/heartbeat)
+func (s *MetricsServer) HeartbeatHandler() http.HandlerFunc {
+	return protoHandler(
+		func() proto.Message { return &api.HeartbeatRequest{} },
+		func(ctx context.Context, m proto.Message) (proto.Message, error) {
+			return s.Heartbeat(ctx, m.(*api.HeartbeatRequest))
+		},
+	)
+}
+
+// protoHandler — HTTP-обёртка над gRPC-методом: тело в JSON или protobuf (по Content-Type),
+// ответ в том же формате, ошибки gRPC переводятся в HTTP-статусы
+func protoHandler(
+	newReq func() proto.Message,
+	call func(ctx context.Context, req proto.Message) (proto.Message, error),
+) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+
+		body, err := io.ReadAll(io.LimitReader(r.Body, maxIngestBodySize+1))
+		if err != nil {
+			http.Error(w, "failed to read body", http.StatusBadRequest)
+			return
+		}
+		if len(body) > maxIngestBodySize {
+			http.Error(w, "body too large", http.StatusRequestEntityTooLarge)
+			return
+		}
+
+		useProto := isProtoContentType(r.Header.Get("Content-Type"))
+		req := newReq()
+		if useProto {
+			err = proto.Unmarshal(body, req)
+		} else {
+			err = protojson.Unmarshal(body, req)
+		}
+		if err != nil {
+			http.Error(w, "invalid payload: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		// Адрес клиента передаём так же, как его видит gRPC
+		ctx := peer.NewContext(r.Context(), &peer.Peer{Addr: httpAddr(r.RemoteAddr)})
+		resp, err := call(ctx, req)
+		if err != nil {
+			log.Printf("HTTP %s error: %v", r.URL.Path, err)
+			st, code := status.Convert(err), httpStatusFromGRPC(err)
+			// Ошибки с деталями (нарушения по полям) отдаём как google.rpc.Status в JSON
+			if len(st.Details()) > 0 {
+				if body, err := protojson.Marshal(st.Proto()); err == nil {
+					w.Header().Set("Content-Type", "application/json")
+					w.WriteHeader(code)
+					w.Write(body)
+					return
+				}
+			}
+			http.Error(w, st.Message(), code)
+			return
+		}
+
+		var data []byte
+		if useProto {
+			w.Header().Set("Content-Type", "application/x-protobuf")
+			data, err = proto.Marshal(resp)
+		} else {
+			w.Header().Set("Content-Type", "application/json")
+			data, err = protojson.Marshal(resp)
+		}
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.Write(data)
+	}
+}
+
+// httpAddr — адрес HTTP-клиента в виде net.Addr
+type httpAddr string
+
+func (a httpAddr) Network() string { return "tcp" }
+func (a httpAddr) String() string  { return string(a) }
+
+// isProtoContentType проверяет, что тело передано в бинарном protobuf
+func isProtoContentType(contentType string) bool {
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	return mediaType == "application/x-protobuf" || mediaType == "application/protobuf"
+}
+
+// httpStatusFromGRPC переводит gRPC-код ошибки в HTTP-статус
+func httpStatusFromGRPC(err error) int {
+	switch status.Code(err) {
+	case codes.InvalidArgument:
+		return http.StatusBadRequest
+	case codes.PermissionDenied:
+		return http.StatusForbidden
+	case codes.ResourceExhausted:
+		return http.StatusTooManyRequests
+	case codes.Unavailable:
+		return http.StatusServiceUnavailable
+	case codes.Unauthenticated:
+		return http.StatusUnauthorized
+	default:
+		return http.StatusInternalServerError
+	}
+}
@@ -0,0 +1,112 @@
+package server
+
+import (
+	"context"
+	"log"
+	"runtime/debug"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+var (
+	grpcStarted = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "grpc_server_started_total",
+		Help: "Total number of RPCs started on the server",
+	}, []string{"grpc_type", "grpc_service", "grpc_method"})
+	grpcHandled = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "grpc_server_handled_total",
+		Help: "Total number of RPCs completed on the server, regardless of success or failure",
+	}, []string{"grpc_type", "grpc_service", "grpc_method", "grpc_code"})
+	grpcHandlingSeconds = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "grpc_server_handling_seconds",
+		Help:    "Duration of RPCs handled by the server",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"grpc_type", "grpc_service", "grpc_method"})
+)
+
+func init() {
+	prometheus.MustRegister(grpcStarted, grpcHandled, grpcHandlingSeconds)
+}
+
+// splitMethod разбирает "/package.Service/Method" на сервис и метод
+func splitMethod(fullMethod string) (string, string) {
+	fullMethod = strings.TrimPrefix(fullMethod, "/")
+	if i := strings.LastIndex(fullMethod, "/"); i >= 0 {
+		return fullMethod[:i], fullMethod[i+1:]
+	}
+	return "unknown", fullMethod
+}
+
+// streamType — тип потокового RPC для метрик
+func streamType(info *grpc.StreamServerInfo) string {
+	switch {
+	case info.IsClientStream && info.IsServerStream:
+		return "bidi_stream"
+	case info.IsClientStream:
+		return "client_stream"
+	default:
+		return "server_stream"
+	}
+}
+
+// observeRPC учитывает завершённый RPC в метриках и логе
+func observeRPC(ctx context.Context, rpcType, fullMethod string, started time.Time, err error) {
+	service, method := splitMethod(fullMethod)
+	code := status.Code(err)
+	elapsed := time.Since(started)
+	grpcHandled.WithLabelValues(rpcType, service, method, code.String()).Inc()
+	grpcHandlingSeconds.WithLabelValues(rpcType, service, method).Observe(elapsed.Seconds())
+	if err != nil {
+		log.Printf("gRPC %s peer=%s code=%s duration=%s error=%v", fullMethod, peerAddr(ctx), code, elapsed, err)
+	} else {
+		log.Printf("gRPC %s peer=%s code=%s duration=%s", fullMethod, peerAddr(ctx), code, elapsed)
+	}
+}
+
+// observeUnary ведёт метрики и журнал обычных RPC
+func observeUnary(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	service, method := splitMethod(info.FullMethod)
+	grpcStarted.WithLabelValues("unary", service, method).Inc()
+	started := time.Now()
+	resp, err := handler(ctx, req)
+	observeRPC(ctx, "unary", info.FullMethod, started, err)
+	return resp, err
+}
+
+// observeStream ведёт метрики и журнал потоковых RPC
+func observeStream(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	service, method := splitMethod(info.FullMethod)
+	rpcType := streamType(info)
+	grpcStarted.WithLabelValues(rpcType, service, method).Inc()
+	started := time.Now()
+	err := handler(srv, ss)
+	observeRPC(ss.Context(), rpcType, info.FullMethod, started, err)
+	return err
+}
+
+// recoverUnary превращает панику обработчика в ошибку Internal, не роняя сервер
+func recoverUnary(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (resp interface{}, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("Panic in gRPC %s: %v\n%s", info.FullMethod, r, debug.Stack())
+			err = status.Error(codes.Internal, "internal server error")
+		}
+	}()
+	return handler(ctx, req)
+}
+
+// recoverStream — то же для потоковых RPC
+func recoverStream(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("Panic in gRPC %s: %v\n%s", info.FullMethod, r, debug.Stack())
+			err = status.Error(codes.Internal, "internal server error")
+		}
+	}()
+	return handler(srv, ss)
+}
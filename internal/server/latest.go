@@ -0,0 +1,255 @@
+package server
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/vovakirdan/gohub/internal/api"
+	"github.com/vovakirdan/gohub/internal/db"
+	"github.com/vovakirdan/gohub/internal/labels"
+
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// За какой период при старте загружаются последние значения из БД
+const latestWarmWindow = 24 * time.Hour
+
+// LatestState — последнее состояние сервера/тега
+type LatestState struct {
+	ServerID     string            `json:"server_id"`
+	Tag          string            `json:"tag"`
+	Labels       map[string]string `json:"labels"`
+	CPUUsage     float64           `json:"cpu_usage"`
+	MemoryUsage  float64           `json:"memory_usage"`
+	DiskUsage    float64           `json:"disk_usage"`
+	NetworkUsage float64           `json:"network_usage"`
+	// Последнее значение каждого ряда сэмплов
+	Samples []db.SampleRow `json:"samples"`
+	// Время последних фиксированных метрик (нулевое, если агент присылает только сэмплы)
+	CollectedAt time.Time `json:"collected_at"`
+	LastSeen    time.Time `json:"last_seen"`
+	// Состояние по heartbeat (up/down/unknown)
+	Status string `json:"status"`
+	// Состояние по давности данных (online/stale/offline), пусто до первой проверки
+	State string `json:"state"`
+	// Сервер в окне обслуживания
+	InMaintenance bool `json:"in_maintenance"`
+}
+
+// latestEntry — запись кеша; сэмплы по ключу ряда (имя и лейблы)
+type latestEntry struct {
+	state   LatestState
+	samples map[string]db.SampleRow
+}
+
+// latestCache — последние значения по серверам/тегам (ключ server_id:tag)
+type latestCache struct {
+	mu      sync.RWMutex
+	entries map[string]*latestEntry
+}
+
+func newLatestCache() *latestCache {
+	return &latestCache{entries: make(map[string]*latestEntry)}
+}
+
+// entry возвращает запись, создавая её при необходимости; вызывается под mu
+func (c *latestCache) entry(serverID, tag string) *latestEntry {
+	key := serverID + ":" + tag
+	e, ok := c.entries[key]
+	if !ok {
+		e = &latestEntry{
+			state:   LatestState{ServerID: serverID, Tag: tag},
+			samples: make(map[string]db.SampleRow),
+		}
+		c.entries[key] = e
+	}
+	return e
+}
+
+// setMetrics обновляет фиксированные метрики, если они не старше сохранённых
+func (e *latestEntry) setMetrics(values [4]float64, collectedAt time.Time) {
+	if collectedAt.Before(e.state.CollectedAt) {
+		return
+	}
+	e.state.CPUUsage, e.state.MemoryUsage, e.state.DiskUsage, e.state.NetworkUsage =
+		values[0], values[1], values[2], values[3]
+	e.state.CollectedAt = collectedAt
+}
+
+// setSample обновляет значение ряда, если оно не старше сохранённого
+func (e *latestEntry) setSample(row db.SampleRow) {
+	key := row.Name + "{" + labels.Labels(row.Labels).String() + "}"
+	if prev, ok := e.samples[key]; ok && row.Timestamp.Before(prev.Timestamp) {
+		return
+	}
+	e.samples[key] = row
+}
+
+func (e *latestEntry) touch(l map[string]string, seen time.Time) {
+	if l != nil {
+		e.state.Labels = l
+	}
+	if seen.After(e.state.LastSeen) {
+		e.state.LastSeen = seen
+	}
+}
+
+// update запоминает принятый запрос агента; legacy — nil, если фиксированных полей нет
+func (c *latestCache) update(serverID, tag string, l map[string]string, legacy *[4]float64, collectedAt time.Time, samples []db.SampleRow, seen time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e := c.entry(serverID, tag)
+	e.touch(l, seen)
+	if legacy != nil {
+		e.setMetrics(*legacy, collectedAt)
+	}
+	for _, row := range samples {
+		e.setSample(row)
+	}
+}
+
+// delete забывает сервер/тег
+func (c *latestCache) delete(serverID, tag string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.entries, serverID+":"+tag)
+}
+
+// seen возвращает идентификаторы, лейблы и время последних данных всех серверов (без значений)
+func (c *latestCache) seen() []LatestState {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	result := make([]LatestState, 0, len(c.entries))
+	for _, e := range c.entries {
+		result = append(result, LatestState{
+			ServerID: e.state.ServerID,
+			Tag:      e.state.Tag,
+			Labels:   e.state.Labels,
+			LastSeen: e.state.LastSeen,
+		})
+	}
+	return result
+}
+
+// snapshot возвращает копию состояний, отфильтрованную по тегу и лейблам, отсортированную по server_id/tag
+func (c *latestCache) snapshot(tag string, selector map[string]string, now time.Time) []LatestState {
+	c.mu.RLock()
+	result := make([]LatestState, 0, len(c.entries))
+	for _, e := range c.entries {
+		if tag != "" && e.state.Tag != tag {
+			continue
+		}
+		if !labels.Match(e.state.Labels, selector) {
+			continue
+		}
+		st := e.state
+		st.Samples = make([]db.SampleRow, 0, len(e.samples))
+		for _, row := range e.samples {
+			st.Samples = append(st.Samples, row)
+		}
+		result = append(result, st)
+	}
+	c.mu.RUnlock()
+
+	for i := range result {
+		st := &result[i]
+		st.Status, st.LastSeen = agentStatus(st.ServerID, st.Tag, st.LastSeen, now)
+		sort.Slice(st.Samples, func(a, b int) bool {
+			if st.Samples[a].Name != st.Samples[b].Name {
+				return st.Samples[a].Name < st.Samples[b].Name
+			}
+			return labels.Labels(st.Samples[a].Labels).String() < labels.Labels(st.Samples[b].Labels).String()
+		})
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].ServerID != result[j].ServerID {
+			return result[i].ServerID < result[j].ServerID
+		}
+		return result[i].Tag < result[j].Tag
+	})
+	return result
+}
+
+// WarmLatest заполняет кеш последних значений из реестра и истории за latestWarmWindow
+func (s *MetricsServer) WarmLatest(ctx context.Context) error {
+	servers, err := s.storage.LoadServers(ctx, nil)
+	if err != nil {
+		return err
+	}
+	since := time.Now().Add(-latestWarmWindow)
+	metrics, err := s.storage.LoadLatestMetrics(ctx, since)
+	if err != nil {
+		return err
+	}
+	samples, err := s.storage.LoadLatestSamples(ctx, since)
+	if err != nil {
+		return err
+	}
+
+	c := s.latest
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, row := range servers {
+		c.entry(row.ServerID, row.Tag).touch(row.Labels, row.LastSeen)
+	}
+	for _, row := range metrics {
+		collectedAt, err := time.Parse(time.RFC3339Nano, row.CreatedAt)
+		if err != nil {
+			return err
+		}
+		e := c.entry(row.ServerID, row.Tag)
+		if e.state.Labels == nil {
+			e.state.Labels = row.Labels
+		}
+		e.setMetrics([4]float64{row.CPUUsage, row.MemoryUsage, row.DiskUsage, row.NetworkUsage}, collectedAt)
+	}
+	for _, row := range samples {
+		c.entry(row.ServerID, row.Tag).setSample(row)
+	}
+	return nil
+}
+
+// FleetSnapshot возвращает последние значения серверов из кеша (фильтры по тегу и лейблам необязательны)
+func (s *MetricsServer) FleetSnapshot(tag string, l map[string]string) []LatestState {
+	states := s.latest.snapshot(tag, l, time.Now())
+	for i := range states {
+		states[i].State = s.monitor.get(states[i].ServerID, states[i].Tag)
+		states[i].InMaintenance = s.maintenance.inMaintenance(states[i].ServerID, states[i].Tag)
+	}
+	return states
+}
+
+// GetFleetSnapshot отдаёт последние значения всех серверов без запросов к БД
+func (s *MetricsServer) GetFleetSnapshot(ctx context.Context, req *api.FleetSnapshotRequest) (*api.FleetSnapshot, error) {
+	now := time.Now()
+	states := s.FleetSnapshot(req.Tag, req.Labels)
+	resp := &api.FleetSnapshot{
+		Servers:     make([]*api.ServerSnapshot, 0, len(states)),
+		GeneratedAt: timestamppb.New(now),
+	}
+	for _, st := range states {
+		msg := &api.ServerSnapshot{
+			ServerId:      st.ServerID,
+			Tag:           st.Tag,
+			Labels:        st.Labels,
+			CpuUsage:      st.CPUUsage,
+			MemoryUsage:   st.MemoryUsage,
+			DiskUsage:     st.DiskUsage,
+			NetworkUsage:  st.NetworkUsage,
+			LastSeen:      timestamppb.New(st.LastSeen),
+			Status:        serverStatusProto(st.Status),
+			State:         st.State,
+			InMaintenance: st.InMaintenance,
+		}
+		if !st.CollectedAt.IsZero() {
+			msg.CollectedAt = timestamppb.New(st.CollectedAt)
+		}
+		for _, row := range st.Samples {
+			msg.Samples = append(msg.Samples, storedSample(row).Sample)
+		}
+		resp.Servers = append(resp.Servers, msg)
+	}
+	return resp, nil
+}
@@ -0,0 +1,63 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+)
+
+// Префикс адреса Unix-сокета в конфиге
+const unixAddrPrefix = "unix:"
+
+// Listen открывает адрес из конфига: "host:port" или "unix:/path/to.sock".
+// Оставшийся от прошлого запуска файл сокета удаляется.
+func Listen(addr string) (net.Listener, error) {
+	if path, ok := strings.CutPrefix(addr, unixAddrPrefix); ok {
+		if fi, err := os.Stat(path); err == nil && fi.Mode()&fs.ModeSocket != 0 {
+			if err := os.Remove(path); err != nil {
+				return nil, fmt.Errorf("failed to remove stale socket %s: %w", path, err)
+			}
+		} else if err == nil {
+			return nil, fmt.Errorf("failed to listen on %s: file exists and is not a socket", addr)
+		} else if !errors.Is(err, fs.ErrNotExist) {
+			return nil, fmt.Errorf("failed to listen on %s: %w", addr, err)
+		}
+		lis, err := net.Listen("unix", path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to listen on %s: %w", addr, err)
+		}
+		return lis, nil
+	}
+	lis, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen on %s: %w", addr, err)
+	}
+	return lis, nil
+}
+
+// isGRPCRequest — запрос gRPC по HTTP/2 (не gRPC-Web)
+func isGRPCRequest(r *http.Request) bool {
+	ct := r.Header.Get("Content-Type")
+	return r.ProtoMajor == 2 && (ct == "application/grpc" || strings.HasPrefix(ct, "application/grpc+"))
+}
+
+// SinglePortHandler обслуживает gRPC на HTTP-порту: HTTP/2 без TLS (h2c) с content-type
+// application/grpc уходит в gRPC-сервер, остальное — в next. Используется вместо Start,
+// когда отдельный gRPC-порт не открывается.
+func (s *MetricsServer) SinglePortHandler(next http.Handler) http.Handler {
+	s.startOnce.Do(s.startBackground)
+	return h2c.NewHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if isGRPCRequest(r) {
+			s.serveGRPCHTTP(s.grpcServer, w, r)
+			return
+		}
+		next.ServeHTTP(w, r)
+	}), &http2.Server{})
+}
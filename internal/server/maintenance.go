@@ -0,0 +1,305 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/vovakirdan/gohub/internal/api"
+	"github.com/vovakirdan/gohub/internal/db"
+	"github.com/vovakirdan/gohub/internal/labels"
+	ws "github.com/vovakirdan/gohub/internal/websocket"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// ErrInvalidMaintenanceWindow — окно обслуживания не прошло проверку
+var ErrInvalidMaintenanceWindow = errors.New("invalid maintenance window")
+
+// Как часто пересчитывать активные окна обслуживания (расписание с точностью до минуты)
+const maintenanceCheckInterval = 15 * time.Second
+
+// Самое длинное окно обслуживания
+const maxMaintenanceDuration = 7 * 24 * time.Hour
+
+var serverInMaintenance = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+	Name: "gohub_server_in_maintenance",
+	Help: "Whether the server is in a maintenance window (1) or not (0)",
+}, []string{"server_id", "tag"})
+
+func init() {
+	prometheus.MustRegister(serverInMaintenance)
+}
+
+// maintenanceWindow — окно обслуживания с разобранным расписанием
+type maintenanceWindow struct {
+	db.MaintenanceWindowRow
+	schedule *cronSchedule
+	duration time.Duration
+	loc      *time.Location
+}
+
+func newMaintenanceWindow(row db.MaintenanceWindowRow) (*maintenanceWindow, error) {
+	if !ruleNameRe.MatchString(row.Name) {
+		return nil, fmt.Errorf("%w: name must match %s", ErrInvalidMaintenanceWindow, ruleNameRe)
+	}
+	sched, err := parseCron(row.Schedule)
+	if err != nil {
+		return nil, fmt.Errorf("%w: schedule: %v", ErrInvalidMaintenanceWindow, err)
+	}
+	d, err := time.ParseDuration(row.Duration)
+	if err != nil || d < time.Minute || d > maxMaintenanceDuration {
+		return nil, fmt.Errorf("%w: duration must be between 1m and %s, got %q", ErrInvalidMaintenanceWindow, maxMaintenanceDuration, row.Duration)
+	}
+	loc := time.UTC
+	if row.Timezone != "" {
+		if loc, err = time.LoadLocation(row.Timezone); err != nil {
+			return nil, fmt.Errorf("%w: timezone: %v", ErrInvalidMaintenanceWindow, err)
+		}
+	}
+	for k := range row.Labels {
+		if err := labels.ValidateKey(k); err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidMaintenanceWindow, err)
+		}
+	}
+	return &maintenanceWindow{MaintenanceWindowRow: row, schedule: sched, duration: d, loc: loc}, nil
+}
+
+// activeAt возвращает конец окна, если в момент t оно открыто
+func (w *maintenanceWindow) activeAt(t time.Time) (time.Time, bool) {
+	start, ok := w.schedule.lastStart(t.In(w.loc), w.duration)
+	if !ok {
+		return time.Time{}, false
+	}
+	return start.Add(w.duration), true
+}
+
+// matches — окно относится к серверу
+func (w *maintenanceWindow) matches(serverID, tag string, l map[string]string) bool {
+	if w.ServerID != "" && w.ServerID != serverID {
+		return false
+	}
+	if w.Tag != "" && w.Tag != tag {
+		return false
+	}
+	return labels.Match(l, w.Labels)
+}
+
+// MaintenanceWindowStatus — окно обслуживания и его текущее состояние
+type MaintenanceWindowStatus struct {
+	db.MaintenanceWindowRow
+	Active bool       `json:"active"`
+	EndsAt *time.Time `json:"ends_at,omitempty"`
+}
+
+// maintenanceTracker — окна обслуживания и серверы, находящиеся в них
+type maintenanceTracker struct {
+	mu      sync.RWMutex
+	windows map[string]*maintenanceWindow
+	// окна, открытые на момент последней проверки
+	active []*maintenanceWindow
+	// серверы в обслуживании (ключ server_id:tag) и имя окна
+	servers map[string]string
+}
+
+func newMaintenanceTracker() *maintenanceTracker {
+	return &maintenanceTracker{
+		windows: make(map[string]*maintenanceWindow),
+		servers: make(map[string]string),
+	}
+}
+
+// refresh пересчитывает открытые окна
+func (m *maintenanceTracker) refresh(now time.Time) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.active = m.active[:0]
+	for _, w := range m.windows {
+		if _, ok := w.activeAt(now); ok {
+			m.active = append(m.active, w)
+		}
+	}
+	sort.Slice(m.active, func(i, j int) bool { return m.active[i].Name < m.active[j].Name })
+}
+
+// window возвращает открытое окно, под которое подходит сервер, или ""
+func (m *maintenanceTracker) window(serverID, tag string, l map[string]string) string {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	for _, w := range m.active {
+		if w.matches(serverID, tag, l) {
+			return w.Name
+		}
+	}
+	return ""
+}
+
+// inMaintenance — сервер был в обслуживании при последней проверке
+func (m *maintenanceTracker) inMaintenance(serverID, tag string) bool {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	_, ok := m.servers[serverID+":"+tag]
+	return ok
+}
+
+// LoadMaintenanceWindows загружает окна обслуживания из БД
+func (s *MetricsServer) LoadMaintenanceWindows(ctx context.Context) error {
+	rows, err := s.storage.LoadMaintenanceWindows(ctx)
+	if err != nil {
+		return err
+	}
+	windows := make(map[string]*maintenanceWindow, len(rows))
+	for _, row := range rows {
+		w, err := newMaintenanceWindow(row)
+		if err != nil {
+			return fmt.Errorf("maintenance window %q: %w", row.Name, err)
+		}
+		windows[w.Name] = w
+	}
+	s.maintenance.mu.Lock()
+	s.maintenance.windows = windows
+	s.maintenance.mu.Unlock()
+	s.checkMaintenance(time.Now())
+	return nil
+}
+
+// watchMaintenance периодически пересчитывает окна обслуживания до остановки
+func (s *MetricsServer) watchMaintenance() {
+	ticker := time.NewTicker(maintenanceCheckInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			s.checkMaintenance(time.Now())
+		case <-s.done:
+			return
+		}
+	}
+}
+
+// checkMaintenance пересчитывает открытые окна и рассылает вход серверов в обслуживание и выход из него
+func (s *MetricsServer) checkMaintenance(now time.Time) {
+	m := s.maintenance
+	m.refresh(now)
+	s.silences.refresh(now)
+
+	current := make(map[string]string)
+	seen := s.latest.seen()
+	for _, st := range seen {
+		if name := m.window(st.ServerID, st.Tag, st.Labels); name != "" {
+			current[st.ServerID+":"+st.Tag] = name
+		}
+	}
+
+	m.mu.Lock()
+	prev := m.servers
+	m.servers = current
+	m.mu.Unlock()
+
+	for _, st := range seen {
+		key := st.ServerID + ":" + st.Tag
+		was, cur := prev[key], current[key]
+		if was == cur {
+			continue
+		}
+		msg := ws.WSMaintenance{
+			ServerID:      st.ServerID,
+			Tag:           st.Tag,
+			Labels:        st.Labels,
+			InMaintenance: cur != "",
+			Window:        cur,
+			Timestamp:     now.Unix(),
+		}
+		if cur != "" {
+			msg.Message = "Server entered maintenance"
+			log.Printf("Server %s/%s entered maintenance window %s", st.ServerID, st.Tag, cur)
+			serverInMaintenance.WithLabelValues(st.ServerID, st.Tag).Set(1)
+		} else {
+			msg.Message = "Server left maintenance"
+			log.Printf("Server %s/%s left maintenance window %s", st.ServerID, st.Tag, was)
+			serverInMaintenance.WithLabelValues(st.ServerID, st.Tag).Set(0)
+		}
+		s.hub.BroadcastMaintenance(msg)
+	}
+}
+
+// withoutMaintenance отбрасывает сэмплы серверов в обслуживании: по ним правила не вычисляются
+func (s *MetricsServer) withoutMaintenance(samples []*api.StoredSample) []*api.StoredSample {
+	s.maintenance.mu.RLock()
+	idle := len(s.maintenance.active) == 0
+	s.maintenance.mu.RUnlock()
+	if idle {
+		return samples
+	}
+	out := samples[:0:0]
+	for _, smp := range samples {
+		if s.maintenance.window(smp.ServerId, smp.Tag, smp.Sample.Labels) == "" {
+			out = append(out, smp)
+		}
+	}
+	return out
+}
+
+// MaintenanceWindows возвращает окна обслуживания с признаком, открыты ли они сейчас
+func (s *MetricsServer) MaintenanceWindows() []MaintenanceWindowStatus {
+	now := time.Now()
+	s.maintenance.mu.RLock()
+	result := make([]MaintenanceWindowStatus, 0, len(s.maintenance.windows))
+	for _, w := range s.maintenance.windows {
+		st := MaintenanceWindowStatus{MaintenanceWindowRow: w.MaintenanceWindowRow}
+		if end, ok := w.activeAt(now); ok {
+			st.Active = true
+			st.EndsAt = &end
+		}
+		result = append(result, st)
+	}
+	s.maintenance.mu.RUnlock()
+	sort.Slice(result, func(i, j int) bool { return result[i].Name < result[j].Name })
+	return result
+}
+
+// SetMaintenanceWindow создаёт или заменяет окно обслуживания
+func (s *MetricsServer) SetMaintenanceWindow(ctx context.Context, row db.MaintenanceWindowRow) error {
+	w, err := newMaintenanceWindow(row)
+	if err != nil {
+		return err
+	}
+	if err := s.storage.SaveMaintenanceWindow(ctx, row); err != nil {
+		return err
+	}
+	s.maintenance.mu.Lock()
+	s.maintenance.windows[w.Name] = w
+	s.maintenance.mu.Unlock()
+	s.checkMaintenance(time.Now())
+	return nil
+}
+
+// DeleteMaintenanceWindow удаляет окно обслуживания; false — окна нет
+func (s *MetricsServer) DeleteMaintenanceWindow(ctx context.Context, name string) (bool, error) {
+	deleted, err := s.storage.DeleteMaintenanceWindow(ctx, name)
+	if err != nil {
+		return false, err
+	}
+	s.maintenance.mu.Lock()
+	_, ok := s.maintenance.windows[name]
+	delete(s.maintenance.windows, name)
+	s.maintenance.mu.Unlock()
+	s.checkMaintenance(time.Now())
+	return deleted || ok, nil
+}
+
+// ServersWithMaintenance возвращает серверы из БД и отмечает находящиеся в обслуживании
+func (s *MetricsServer) ServersWithMaintenance(ctx context.Context, selector map[string]string) ([]db.ServerRow, error) {
+	servers, err := s.storage.LoadServersWithTags(ctx, selector)
+	if err != nil {
+		return nil, err
+	}
+	for i := range servers {
+		servers[i].InMaintenance = s.maintenance.window(servers[i].ServerID, servers[i].Tag, servers[i].Labels) != ""
+	}
+	return servers, nil
+}
@@ -0,0 +1,204 @@
+package server
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/vovakirdan/gohub/internal/config"
+	"github.com/vovakirdan/gohub/internal/db"
+	ws "github.com/vovakirdan/gohub/internal/websocket"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Состояния сервера по давности последних данных
+const (
+	StateOnline  = "online"
+	StateStale   = "stale"
+	StateOffline = "offline"
+)
+
+// Параметры монитора по умолчанию, если в конфиге не заданы
+const (
+	defaultMonitorCheckInterval = 5 * time.Second
+	defaultMonitorInterval      = 30 * time.Second
+	defaultMonitorStaleAfter    = 2
+	defaultMonitorOfflineAfter  = 5
+	monitorEventTimeout         = 5 * time.Second
+)
+
+var serverUp = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+	Name: "gohub_server_up",
+	Help: "Whether the server reports on time (1) or is stale or offline (0)",
+}, []string{"server_id", "tag"})
+
+func init() {
+	prometheus.MustRegister(serverUp)
+}
+
+// statusMonitor переводит серверы между online, stale и offline по давности последних данных
+type statusMonitor struct {
+	checkInterval   time.Duration
+	defaultInterval time.Duration
+	staleAfter      int
+	offlineAfter    int
+
+	mu     sync.RWMutex
+	states map[string]string // ключ server_id:tag
+}
+
+func newStatusMonitor(cfg config.MonitorConfig) *statusMonitor {
+	m := &statusMonitor{
+		checkInterval:   cfg.CheckInterval,
+		defaultInterval: cfg.DefaultInterval,
+		staleAfter:      cfg.StaleAfter,
+		offlineAfter:    cfg.OfflineAfter,
+		states:          make(map[string]string),
+	}
+	if m.checkInterval <= 0 {
+		m.checkInterval = defaultMonitorCheckInterval
+	}
+	if m.defaultInterval <= 0 {
+		m.defaultInterval = defaultMonitorInterval
+	}
+	if m.staleAfter <= 0 {
+		m.staleAfter = defaultMonitorStaleAfter
+	}
+	if m.offlineAfter <= m.staleAfter {
+		m.offlineAfter = m.staleAfter + defaultMonitorOfflineAfter - defaultMonitorStaleAfter
+	}
+	return m
+}
+
+func (m *statusMonitor) get(serverID, tag string) string {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.states[serverID+":"+tag]
+}
+
+// set запоминает состояние; возвращает прежнее
+func (m *statusMonitor) set(serverID, tag, state string) string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	prev := m.states[serverID+":"+tag]
+	m.states[serverID+":"+tag] = state
+	return prev
+}
+
+func (m *statusMonitor) forget(serverID, tag string) {
+	m.mu.Lock()
+	delete(m.states, serverID+":"+tag)
+	m.mu.Unlock()
+	serverUp.DeleteLabelValues(serverID, tag)
+}
+
+// state определяет состояние по времени без данных и ожидаемому интервалу
+func (m *statusMonitor) state(lastSeen time.Time, interval time.Duration, now time.Time) string {
+	if interval <= 0 {
+		interval = m.defaultInterval
+	}
+	elapsed := now.Sub(lastSeen)
+	switch {
+	case elapsed <= time.Duration(m.staleAfter)*interval:
+		return StateOnline
+	case elapsed <= time.Duration(m.offlineAfter)*interval:
+		return StateStale
+	default:
+		return StateOffline
+	}
+}
+
+// expectedInterval — как часто агент должен присылать данные: интервал heartbeat,
+// затем интервал из указаний агентам, иначе 0 (интервал монитора по умолчанию)
+func (s *MetricsServer) expectedInterval(serverID, tag string) time.Duration {
+	if hb, ok := agentHeartbeats.get(serverID, tag); ok && hb.IntervalMs > 0 {
+		return time.Duration(hb.IntervalMs) * time.Millisecond
+	}
+	return time.Duration(s.control.sendIntervalMs(serverID)) * time.Millisecond
+}
+
+// LoadServerStates восстанавливает состояния серверов по последним событиям,
+// чтобы после перезапуска не фиксировать повторные переходы
+func (s *MetricsServer) LoadServerStates(ctx context.Context) error {
+	rows, err := s.storage.LoadServerStates(ctx)
+	if err != nil {
+		return err
+	}
+	for _, r := range rows {
+		s.monitor.set(r.ServerID, r.Tag, r.ToState)
+		setServerUp(r.ServerID, r.Tag, r.ToState)
+	}
+	return nil
+}
+
+func setServerUp(serverID, tag, state string) {
+	up := 0.0
+	if state == StateOnline {
+		up = 1
+	}
+	serverUp.WithLabelValues(serverID, tag).Set(up)
+}
+
+// watchServers периодически проверяет состояния серверов до остановки
+func (s *MetricsServer) watchServers() {
+	ticker := time.NewTicker(s.monitor.checkInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			s.checkServers(time.Now())
+		case <-s.done:
+			return
+		}
+	}
+}
+
+// checkServers сравнивает время последних данных каждого сервера с ожидаемым интервалом
+// и фиксирует переходы: событие в server_events, рассылка по WebSocket, gohub_server_up
+func (s *MetricsServer) checkServers(now time.Time) {
+	for _, st := range s.latest.seen() {
+		_, lastSeen := agentStatus(st.ServerID, st.Tag, st.LastSeen, now)
+		state := s.monitor.state(lastSeen, s.expectedInterval(st.ServerID, st.Tag), now)
+		prev := s.monitor.set(st.ServerID, st.Tag, state)
+		if prev == state {
+			continue
+		}
+		setServerUp(st.ServerID, st.Tag, state)
+		s.recordTransition(st.ServerID, st.Tag, st.Labels, prev, state, lastSeen, now)
+	}
+}
+
+// recordTransition сохраняет и рассылает смену состояния; первое состояние сервера не рассылается
+func (s *MetricsServer) recordTransition(serverID, tag string, l map[string]string, from, to string, lastSeen, now time.Time) {
+	ev := db.ServerEventRow{ServerID: serverID, Tag: tag, FromState: from, ToState: to, CreatedAt: now}
+	if !lastSeen.IsZero() {
+		ev.LastSeen = &lastSeen
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), monitorEventTimeout)
+	_, err := s.storage.SaveServerEvent(ctx, ev)
+	cancel()
+	if err != nil {
+		log.Printf("Failed to save state change of %s/%s: %v", serverID, tag, err)
+	}
+	if from == "" {
+		return
+	}
+	log.Printf("Server %s/%s is %s (was %s, last seen %s)", serverID, tag, to, from, lastSeen.Format(time.RFC3339))
+	s.hub.BroadcastServerEvent(ws.WSServerEvent{
+		Message:   "Server state changed",
+		ServerID:  serverID,
+		Tag:       tag,
+		Labels:    l,
+		FromState: from,
+		ToState:   to,
+		LastSeen:  lastSeen.Unix(),
+		Timestamp: now.Unix(),
+	})
+}
+
+// ServerEvents возвращает последние смены состояния серверов
+func (s *MetricsServer) ServerEvents(ctx context.Context, serverID, tag string, limit int64) ([]db.ServerEventRow, error) {
+	return s.storage.LoadServerEvents(ctx, serverID, tag, limit)
+}
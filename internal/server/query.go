@@ -0,0 +1,65 @@
+package server
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/vovakirdan/gohub/internal/api"
+	"github.com/vovakirdan/gohub/internal/db"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// aggregationNames — соответствие enum Aggregation и функций агрегации БД
+var aggregationNames = map[api.Aggregation]string{
+	api.Aggregation_AGGREGATION_AVG:  db.AggAvg,
+	api.Aggregation_AGGREGATION_MIN:  db.AggMin,
+	api.Aggregation_AGGREGATION_MAX:  db.AggMax,
+	api.Aggregation_AGGREGATION_P95:  db.AggP95,
+	api.Aggregation_AGGREGATION_LAST: db.AggLast,
+}
+
+// QueryRange возвращает ряды, агрегированные по шагам за диапазон времени
+func (s *MetricsServer) QueryRange(ctx context.Context, req *api.QueryRangeRequest) (*api.QueryRangeResponse, error) {
+	q := db.RangeQuery{
+		ServerID:    req.ServerId,
+		Tag:         req.Tag,
+		Labels:      req.Labels,
+		Metric:      req.Metric,
+		Step:        time.Duration(req.StepSeconds) * time.Second,
+		Aggregation: aggregationNames[req.Aggregation],
+	}
+	if req.From != nil {
+		q.From = req.From.AsTime()
+	}
+	if req.To != nil {
+		q.To = req.To.AsTime()
+	}
+	if err := q.Validate(); err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	data, err := s.storage.QueryRange(ctx, q)
+	if err != nil {
+		log.Printf("DB query range error: %v", err)
+		return nil, err
+	}
+
+	series := make([]*api.Series, 0, len(data))
+	for _, row := range data {
+		points := make([]*api.Point, 0, len(row.Points))
+		for _, p := range row.Points {
+			points = append(points, &api.Point{Timestamp: timestamppb.New(p.Time), Value: p.Value})
+		}
+		series = append(series, &api.Series{
+			ServerId: row.ServerID,
+			Tag:      row.Tag,
+			Labels:   row.Labels,
+			Points:   points,
+		})
+	}
+	return &api.QueryRangeResponse{Series: series}, nil
+}
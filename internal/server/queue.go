@@ -0,0 +1,382 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/vovakirdan/gohub/internal/config"
+	"github.com/vovakirdan/gohub/internal/db"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Политики при полной очереди приёма
+const (
+	fullPolicyBlock      = "block"
+	fullPolicyDropOldest = "drop_oldest"
+	fullPolicyReject     = "reject"
+)
+
+// Параметры очереди по умолчанию, если в конфиге не заданы
+const (
+	defaultIngestQueueSize       = 10000
+	defaultIngestWorkers         = 4
+	defaultIngestBatchSize       = 1000
+	defaultIngestFlushInterval   = 200 * time.Millisecond
+	defaultIngestRetryBackoff    = 500 * time.Millisecond
+	defaultIngestMaxRetryBackoff = 10 * time.Second
+)
+
+// Таймаут одной попытки записи пачки
+const ingestWriteTimeout = 30 * time.Second
+
+var (
+	ingestQueueDepth = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "gohub_ingest_queue_depth",
+		Help: "Agent requests waiting in the ingest queue",
+	})
+	ingestQueueCapacity = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "gohub_ingest_queue_capacity",
+		Help: "Capacity of the ingest queue in agent requests",
+	})
+	ingestQueueLatency = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Name:    "gohub_ingest_queue_latency_seconds",
+		Help:    "Time from accepting an agent request to writing it to the database",
+		Buckets: []float64{.01, .05, .1, .25, .5, 1, 2.5, 5, 10, 30, 60, 120},
+	})
+	ingestWriteDuration = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Name:    "gohub_ingest_write_duration_seconds",
+		Help:    "Duration of one batch write attempt",
+		Buckets: prometheus.DefBuckets,
+	})
+	ingestWrittenRows = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "gohub_ingest_written_rows_total",
+		Help: "Rows written to the database by the ingest queue",
+	}, []string{"table"})
+	ingestRetries = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "gohub_ingest_retries_total",
+		Help: "Batch write attempts retried after a database error",
+	})
+	ingestDropped = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "gohub_ingest_dropped_rows_total",
+		Help: "Rows lost by the ingest queue",
+	}, []string{"reason"})
+)
+
+func init() {
+	prometheus.MustRegister(ingestQueueDepth, ingestQueueCapacity, ingestQueueLatency,
+		ingestWriteDuration, ingestWrittenRows, ingestRetries, ingestDropped)
+}
+
+// ingestItem — принятый запрос агента, ожидающий записи
+type ingestItem struct {
+	metrics *db.MetricRecord // nil — агент прислал только сэмплы
+	samples []db.SampleRow
+
+	serverID string
+	tag      string
+	labels   map[string]string
+	received time.Time
+	enqueued time.Time
+}
+
+func (it *ingestItem) rows() int {
+	n := len(it.samples)
+	if it.metrics != nil {
+		n++
+	}
+	return n
+}
+
+// ingestQueue — ограниченная очередь приёма с фоновой пакетной записью в БД
+type ingestQueue struct {
+	storage *db.Storage
+	// обновление реестра серверов после записи
+	touch func(ctx context.Context, serverID, tag string, l map[string]string, seen time.Time)
+
+	workers         int
+	batchSize       int
+	flushInterval   time.Duration
+	maxRetries      int
+	retryBackoff    time.Duration
+	maxRetryBackoff time.Duration
+	policy          string
+
+	ch chan *ingestItem
+	// closed защищён mu: после закрытия очереди запись в ch запрещена
+	mu     sync.RWMutex
+	closed bool
+	wg     sync.WaitGroup
+	// закрывается, если при остановке не успели дописать очередь: повторы прекращаются
+	abort chan struct{}
+}
+
+func newIngestQueue(cfg config.IngestConfig, storage *db.Storage) (*ingestQueue, error) {
+	q := &ingestQueue{
+		storage:         storage,
+		workers:         cfg.Workers,
+		batchSize:       cfg.BatchSize,
+		flushInterval:   cfg.FlushInterval,
+		maxRetries:      cfg.MaxRetries,
+		retryBackoff:    cfg.RetryBackoff,
+		maxRetryBackoff: cfg.MaxRetryBackoff,
+		policy:          cfg.FullPolicy,
+		abort:           make(chan struct{}),
+	}
+	size := cfg.QueueSize
+	if size <= 0 {
+		size = defaultIngestQueueSize
+	}
+	if q.workers <= 0 {
+		q.workers = defaultIngestWorkers
+	}
+	if q.batchSize <= 0 {
+		q.batchSize = defaultIngestBatchSize
+	}
+	if q.flushInterval <= 0 {
+		q.flushInterval = defaultIngestFlushInterval
+	}
+	if q.maxRetries < 0 {
+		q.maxRetries = 0
+	}
+	if q.retryBackoff <= 0 {
+		q.retryBackoff = defaultIngestRetryBackoff
+	}
+	if q.maxRetryBackoff <= 0 {
+		q.maxRetryBackoff = defaultIngestMaxRetryBackoff
+	}
+	switch q.policy {
+	case "":
+		q.policy = fullPolicyBlock
+	case fullPolicyBlock, fullPolicyDropOldest, fullPolicyReject:
+	default:
+		return nil, fmt.Errorf("invalid ingest.full_policy %q: want %s, %s or %s",
+			q.policy, fullPolicyBlock, fullPolicyDropOldest, fullPolicyReject)
+	}
+	q.ch = make(chan *ingestItem, size)
+	ingestQueueCapacity.Set(float64(size))
+	return q, nil
+}
+
+// start запускает горутины записи
+func (q *ingestQueue) start() {
+	q.wg.Add(q.workers)
+	for i := 0; i < q.workers; i++ {
+		go q.worker()
+	}
+}
+
+// enqueue ставит запрос в очередь. Поведение при полной очереди задаёт policy:
+// block ждёт места (не дольше ctx), drop_oldest выбрасывает самые старые запросы,
+// reject отвечает ResourceExhausted, и агент повторяет отправку позже.
+func (q *ingestQueue) enqueue(ctx context.Context, it *ingestItem) error {
+	q.mu.RLock()
+	defer q.mu.RUnlock()
+	if q.closed {
+		return errShuttingDown
+	}
+	it.enqueued = time.Now()
+	defer func() { ingestQueueDepth.Set(float64(len(q.ch))) }()
+
+	select {
+	case q.ch <- it:
+		return nil
+	default:
+	}
+
+	switch q.policy {
+	case fullPolicyReject:
+		ingestDropped.WithLabelValues("rejected").Add(float64(it.rows()))
+		return status.Error(codes.ResourceExhausted, "ingest queue is full, retry later")
+	case fullPolicyDropOldest:
+		for {
+			select {
+			case q.ch <- it:
+				return nil
+			default:
+			}
+			select {
+			case old := <-q.ch:
+				ingestDropped.WithLabelValues("drop_oldest").Add(float64(old.rows()))
+			default:
+			}
+		}
+	default:
+		select {
+		case q.ch <- it:
+			return nil
+		case <-ctx.Done():
+			return status.FromContextError(ctx.Err()).Err()
+		}
+	}
+}
+
+// worker копит запросы в пачку и пишет её по заполнении batchSize или раз в flushInterval
+func (q *ingestQueue) worker() {
+	defer q.wg.Done()
+	ticker := time.NewTicker(q.flushInterval)
+	defer ticker.Stop()
+
+	var batch []*ingestItem
+	rows := 0
+	flush := func() {
+		if len(batch) > 0 {
+			q.flush(batch)
+		}
+		batch, rows = nil, 0
+	}
+	for {
+		select {
+		case it, ok := <-q.ch:
+			if !ok {
+				flush()
+				return
+			}
+			ingestQueueDepth.Set(float64(len(q.ch)))
+			batch = append(batch, it)
+			rows += it.rows()
+			if rows >= q.batchSize {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+		}
+	}
+}
+
+// flush записывает пачку с повторами и обновляет реестр серверов.
+// Если Postgres отклонил данные, одна строка сорвала бы весь COPY: тогда запросы пишутся по одному,
+// и теряются только отклонённые.
+func (q *ingestQueue) flush(batch []*ingestItem) {
+	err := q.writeItems(batch)
+	if err != nil && db.IsDataError(err) && len(batch) > 1 {
+		log.Printf("Ingest: batch of %d request(s) rejected by the database, writing them one by one: %v", len(batch), err)
+		written := batch[:0:0]
+		for _, it := range batch {
+			if err := q.writeItems([]*ingestItem{it}); err != nil {
+				q.drop([]*ingestItem{it}, err)
+				continue
+			}
+			written = append(written, it)
+		}
+		batch = written
+	} else if err != nil {
+		q.drop(batch, err)
+		return
+	}
+
+	// Реестр обновляем раз на сервер за пачку, по последнему запросу
+	latest := make(map[string]*ingestItem)
+	now := time.Now()
+	for _, it := range batch {
+		ingestQueueLatency.Observe(now.Sub(it.enqueued).Seconds())
+		key := it.serverID + ":" + it.tag
+		if prev, ok := latest[key]; !ok || it.received.After(prev.received) {
+			latest[key] = it
+		}
+	}
+	if q.touch == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), ingestWriteTimeout)
+	defer cancel()
+	for _, it := range latest {
+		q.touch(ctx, it.serverID, it.tag, it.labels, it.received)
+	}
+}
+
+// writeItems пишет запросы одной пачкой и учитывает записанные строки
+func (q *ingestQueue) writeItems(items []*ingestItem) error {
+	var metrics []db.MetricRecord
+	var samples []db.SampleRow
+	for _, it := range items {
+		if it.metrics != nil {
+			metrics = append(metrics, *it.metrics)
+		}
+		samples = append(samples, it.samples...)
+	}
+	if err := q.write(metrics, samples); err != nil {
+		return err
+	}
+	ingestWrittenRows.WithLabelValues("metrics").Add(float64(len(metrics)))
+	ingestWrittenRows.WithLabelValues("samples").Add(float64(len(samples)))
+	return nil
+}
+
+// drop учитывает запросы, которые не удалось записать
+func (q *ingestQueue) drop(items []*ingestItem, err error) {
+	rows := 0
+	for _, it := range items {
+		rows += it.rows()
+	}
+	reason := "write_failed"
+	if db.IsDataError(err) {
+		reason = "invalid_data"
+	}
+	if len(items) == 1 {
+		log.Printf("Ingest: dropping %d row(s) from %s/%s: %v", rows, items[0].serverID, items[0].tag, err)
+	} else {
+		log.Printf("Ingest: dropping batch of %d request(s), %d row(s): %v", len(items), rows, err)
+	}
+	ingestDropped.WithLabelValues(reason).Add(float64(rows))
+}
+
+// write пишет пачку, повторяя при ошибке с экспоненциальной паузой; отклонённые Postgres данные не повторяются
+func (q *ingestQueue) write(metrics []db.MetricRecord, samples []db.SampleRow) error {
+	backoff := q.retryBackoff
+	for attempt := 0; ; attempt++ {
+		ctx, cancel := context.WithTimeout(context.Background(), ingestWriteTimeout)
+		start := time.Now()
+		err := q.storage.WriteBatch(ctx, metrics, samples)
+		cancel()
+		ingestWriteDuration.Observe(time.Since(start).Seconds())
+		if err == nil {
+			return nil
+		}
+		if attempt >= q.maxRetries || db.IsDataError(err) {
+			return err
+		}
+		log.Printf("Ingest: batch write failed (attempt %d/%d), retrying in %s: %v", attempt+1, q.maxRetries+1, backoff, err)
+		ingestRetries.Inc()
+		select {
+		case <-time.After(backoff):
+		case <-q.abort:
+			return fmt.Errorf("shutdown deadline exceeded: %w", err)
+		}
+		backoff *= 2
+		if backoff > q.maxRetryBackoff {
+			backoff = q.maxRetryBackoff
+		}
+	}
+}
+
+// close перестаёт принимать запросы и дожидается записи очереди.
+// Если ctx истекает раньше, повторы прекращаются, а недописанные пачки теряются.
+func (q *ingestQueue) close(ctx context.Context) {
+	q.mu.Lock()
+	if q.closed {
+		q.mu.Unlock()
+		return
+	}
+	q.closed = true
+	close(q.ch)
+	q.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		q.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		log.Println("Ingest queue drained")
+	case <-ctx.Done():
+		close(q.abort)
+		log.Printf("Ingest queue did not drain in time (%v), %d request(s) left", ctx.Err(), len(q.ch))
+	}
+}
@@ -0,0 +1,191 @@
+package server
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/vovakirdan/gohub/internal/api"
+	"github.com/vovakirdan/gohub/internal/db"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// Состояния сервера в реестре
+const (
+	ServerUp      = "up"
+	ServerDown    = "down"
+	ServerUnknown = "unknown"
+)
+
+// ServerInfo — запись реестра с текущим состоянием агента
+type ServerInfo struct {
+	db.ServerInfoRow
+	Status string `json:"status"`
+}
+
+// agentStatus определяет состояние агента по heartbeat; lastSeen сдвигается на последний heartbeat, если он позже
+func agentStatus(serverID, tag string, lastSeen, now time.Time) (string, time.Time) {
+	hb, ok := agentHeartbeats.get(serverID, tag)
+	if !ok {
+		return ServerUnknown, lastSeen
+	}
+	if hb.LastSeen.After(lastSeen) {
+		lastSeen = hb.LastSeen
+	}
+	if isUp(hb, now) {
+		return ServerUp, lastSeen
+	}
+	return ServerDown, lastSeen
+}
+
+// serverInfo дополняет запись реестра состоянием по heartbeat
+func serverInfo(row db.ServerInfoRow, now time.Time) ServerInfo {
+	info := ServerInfo{ServerInfoRow: row}
+	info.Status, info.LastSeen = agentStatus(row.ServerID, row.Tag, row.LastSeen, now)
+	return info
+}
+
+// Servers возвращает реестр серверов (можно фильтровать по лейблам)
+func (s *MetricsServer) Servers(ctx context.Context, l map[string]string) ([]ServerInfo, error) {
+	rows, err := s.storage.LoadServers(ctx, l)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	result := make([]ServerInfo, 0, len(rows))
+	for _, row := range rows {
+		result = append(result, serverInfo(row, now))
+	}
+	return result, nil
+}
+
+// Server возвращает один сервер; nil — сервера нет в реестре
+func (s *MetricsServer) Server(ctx context.Context, serverID, tag string) (*ServerInfo, error) {
+	row, err := s.storage.LoadServer(ctx, serverID, tag)
+	if err != nil || row == nil {
+		return nil, err
+	}
+	info := serverInfo(*row, time.Now())
+	return &info, nil
+}
+
+// Decommission выводит сервер из эксплуатации: удаляет его из реестра и серии из Prometheus,
+// при purge — и историю. Если агент продолжит присылать данные, он зарегистрируется снова.
+// Возвращает false, если сервера нет в реестре.
+func (s *MetricsServer) Decommission(ctx context.Context, serverID, tag string, purge bool) (bool, error) {
+	ok, err := s.storage.DeleteServer(ctx, serverID, tag, purge)
+	if err != nil || !ok {
+		return ok, err
+	}
+
+	key := serverID + ":" + tag
+	s.latest.delete(serverID, tag)
+	s.monitor.forget(serverID, tag)
+	s.alerts.forgetServer(serverID, tag, time.Now())
+	serverInMaintenance.DeleteLabelValues(serverID, tag)
+	s.anomalies.forget(serverID, tag)
+	s.forecasts.forget(serverID, tag)
+	s.labelsMu.Lock()
+	delete(s.assigned, key)
+	s.labelsMu.Unlock()
+
+	agentMetrics.Delete(serverID, tag)
+	agentSamples.Delete(serverID, tag)
+	agentHeartbeats.delete(serverID, tag)
+	agentClocks.delete(serverID, tag)
+	s.control.forget(serverID, tag)
+
+	log.Printf("Server %s/%s decommissioned (purge history: %v)", serverID, tag, purge)
+	return true, nil
+}
+
+// touchServer обновляет реестр; ошибка БД агенту не возвращается
+func (s *MetricsServer) touchServer(ctx context.Context, serverID, tag string, l map[string]string, seen time.Time) {
+	if err := s.storage.TouchServer(ctx, serverID, tag, l, seen); err != nil {
+		log.Printf("Failed to update registry for %s/%s: %v", serverID, tag, err)
+	}
+}
+
+// serverStatusProto переводит состояние агента в значение API
+func serverStatusProto(st string) api.ServerStatus {
+	switch st {
+	case ServerUp:
+		return api.ServerStatus_SERVER_STATUS_UP
+	case ServerDown:
+		return api.ServerStatus_SERVER_STATUS_DOWN
+	}
+	return api.ServerStatus_SERVER_STATUS_UNKNOWN
+}
+
+// serverInfoProto переводит запись реестра в сообщение API, дополняя его состоянием монитора и обслуживанием
+func (s *MetricsServer) serverInfoProto(info ServerInfo) *api.ServerInfo {
+	msg := &api.ServerInfo{
+		ServerId:      info.ServerID,
+		Tag:           info.Tag,
+		Labels:        info.Labels,
+		FirstSeen:     timestamppb.New(info.FirstSeen),
+		LastSeen:      timestamppb.New(info.LastSeen),
+		Status:        serverStatusProto(info.Status),
+		State:         s.monitor.get(info.ServerID, info.Tag),
+		InMaintenance: s.maintenance.inMaintenance(info.ServerID, info.Tag),
+	}
+	if len(info.Inventory) > 0 {
+		inv := &api.Inventory{}
+		if err := (protojson.UnmarshalOptions{DiscardUnknown: true}).Unmarshal(info.Inventory, inv); err != nil {
+			log.Printf("Failed to decode inventory of %s/%s: %v", info.ServerID, info.Tag, err)
+		} else {
+			msg.Inventory = inv
+		}
+	}
+	return msg
+}
+
+// ListServers возвращает реестр серверов
+func (s *MetricsServer) ListServers(ctx context.Context, req *api.ListServersRequest) (*api.ListServersResponse, error) {
+	servers, err := s.Servers(ctx, req.Labels)
+	if err != nil {
+		log.Printf("DB select error: %v", err)
+		return nil, err
+	}
+	resp := &api.ListServersResponse{Servers: make([]*api.ServerInfo, 0, len(servers))}
+	for _, info := range servers {
+		resp.Servers = append(resp.Servers, s.serverInfoProto(info))
+	}
+	return resp, nil
+}
+
+// GetServer возвращает один сервер из реестра
+func (s *MetricsServer) GetServer(ctx context.Context, req *api.GetServerRequest) (*api.ServerInfo, error) {
+	if req.ServerId == "" {
+		return nil, status.Error(codes.InvalidArgument, "server_id is required")
+	}
+	info, err := s.Server(ctx, req.ServerId, req.Tag)
+	if err != nil {
+		log.Printf("DB select error: %v", err)
+		return nil, err
+	}
+	if info == nil {
+		return nil, status.Errorf(codes.NotFound, "server %s/%s not found", req.ServerId, req.Tag)
+	}
+	return s.serverInfoProto(*info), nil
+}
+
+// DeleteServer выводит сервер из эксплуатации
+func (s *MetricsServer) DeleteServer(ctx context.Context, req *api.DeleteServerRequest) (*api.DeleteServerResponse, error) {
+	if req.ServerId == "" {
+		return nil, status.Error(codes.InvalidArgument, "server_id is required")
+	}
+	ok, err := s.Decommission(ctx, req.ServerId, req.Tag, req.PurgeHistory)
+	if err != nil {
+		log.Printf("Failed to decommission %s/%s: %v", req.ServerId, req.Tag, err)
+		return nil, err
+	}
+	if !ok {
+		return nil, status.Errorf(codes.NotFound, "server %s/%s not found", req.ServerId, req.Tag)
+	}
+	return &api.DeleteServerResponse{Status: "OK"}, nil
+}
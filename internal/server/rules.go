@@ -0,0 +1,251 @@
+package server
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"maps"
+	"regexp"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/vovakirdan/gohub/internal/api"
+	"github.com/vovakirdan/gohub/internal/db"
+	"github.com/vovakirdan/gohub/internal/labels"
+
+	"github.com/spf13/viper"
+)
+
+// ErrInvalidAlertRule — правило не разобрано или не прошло проверку
+var ErrInvalidAlertRule = errors.New("invalid alert rule")
+
+// ErrReadOnlyAlertRule — правило из файла правил нельзя менять через API
+var ErrReadOnlyAlertRule = errors.New("alert rule is defined in the rules file")
+
+// Важность по умолчанию
+const defaultAlertSeverity = "warning"
+
+var (
+	ruleNameRe = regexp.MustCompile(`^[A-Za-z0-9_.:-]+$`)
+	// <метрика | anomaly(метрика) | forecast(метрика, окно)> <оператор> <порог> [for <длительность>] [on <селектор>]
+	ruleExprRe = regexp.MustCompile(`^\s*(?:anomaly\(\s*([A-Za-z_][A-Za-z0-9_.:]*)\s*\)` +
+		`|forecast\(\s*([A-Za-z_][A-Za-z0-9_.:]*)\s*,\s*([^\s)]+)\s*\)|([A-Za-z_][A-Za-z0-9_.:]*))` +
+		`\s*(>=|<=|==|!=|>|<)\s*(\S+?)` +
+		`(?:\s+for\s+(\S+))?(?:\s+on\s+(.+?))?\s*$`)
+)
+
+// alertCondition — разобранное условие правила
+type alertCondition struct {
+	metric string
+	// Сравнивается не значение, а оценка аномалии ряда (в стандартных отклонениях)
+	anomaly bool
+	// Окно тренда для forecast(...): сравнивается время до заполнения в секундах
+	window    time.Duration
+	op        string
+	threshold float64
+	forDur    time.Duration
+	serverID  string
+	tag       string
+	labels    map[string]string
+}
+
+// parseAlertExpr разбирает условие вида "cpu_usage > 90 for 5m on tag=prod,env=prod",
+// "anomaly(cpu_usage) > 3 for 10m" или "forecast(disk_usage, 24h) < 72h". Порог forecast(...) —
+// секунды или длительность. В селекторе server_id и tag сравниваются с сервером,
+// остальные ключи — с лейблами ряда.
+func parseAlertExpr(expr string) (alertCondition, error) {
+	m := ruleExprRe.FindStringSubmatch(expr)
+	if m == nil {
+		return alertCondition{}, fmt.Errorf("%w: expected \"<metric> <op> <threshold> [for <duration>] [on k=v,...]\", got %q", ErrInvalidAlertRule, expr)
+	}
+	c := alertCondition{metric: m[4], op: m[5]}
+	var err error
+	switch {
+	case m[1] != "":
+		c.metric, c.anomaly = m[1], true
+	case m[2] != "":
+		c.metric = m[2]
+		if c.window, err = time.ParseDuration(m[3]); err != nil || c.window <= 0 {
+			return c, fmt.Errorf("%w: invalid forecast window %q", ErrInvalidAlertRule, m[3])
+		}
+	}
+	if c.threshold, err = strconv.ParseFloat(m[6], 64); err != nil {
+		d, derr := time.ParseDuration(m[6])
+		if c.window == 0 || derr != nil {
+			return c, fmt.Errorf("%w: invalid threshold %q", ErrInvalidAlertRule, m[6])
+		}
+		c.threshold = d.Seconds()
+	}
+	if m[7] != "" {
+		if c.forDur, err = time.ParseDuration(m[7]); err != nil || c.forDur < 0 {
+			return c, fmt.Errorf("%w: invalid duration %q", ErrInvalidAlertRule, m[7])
+		}
+	}
+	for _, pair := range strings.Split(m[8], ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		k, v, ok := strings.Cut(pair, "=")
+		if !ok {
+			return c, fmt.Errorf("%w: invalid selector %q: expected key=value", ErrInvalidAlertRule, pair)
+		}
+		k, v = strings.TrimSpace(k), strings.TrimSpace(v)
+		switch k {
+		case "server_id":
+			c.serverID = v
+		case "tag":
+			c.tag = v
+		default:
+			if err := labels.ValidateKey(k); err != nil {
+				return c, fmt.Errorf("%w: %v", ErrInvalidAlertRule, err)
+			}
+			if c.labels == nil {
+				c.labels = make(map[string]string)
+			}
+			c.labels[k] = v
+		}
+	}
+	return c, nil
+}
+
+// holds — значение удовлетворяет условию
+func (c *alertCondition) holds(v float64) bool {
+	switch c.op {
+	case ">":
+		return v > c.threshold
+	case ">=":
+		return v >= c.threshold
+	case "<":
+		return v < c.threshold
+	case "<=":
+		return v <= c.threshold
+	case "==":
+		return v == c.threshold
+	case "!=":
+		return v != c.threshold
+	}
+	return false
+}
+
+// matches — правило относится к ряду
+func (c *alertCondition) matches(smp *api.StoredSample) bool {
+	if smp.Sample.Name != c.metric {
+		return false
+	}
+	if c.serverID != "" && c.serverID != smp.ServerId {
+		return false
+	}
+	if c.tag != "" && c.tag != smp.Tag {
+		return false
+	}
+	return labels.Match(smp.Sample.Labels, c.labels)
+}
+
+// sameSeries — условия относятся к одним и тем же рядам
+func (c *alertCondition) sameSeries(o *alertCondition) bool {
+	return c.metric == o.metric && c.anomaly == o.anomaly && c.window == o.window &&
+		c.serverID == o.serverID && c.tag == o.tag && maps.Equal(c.labels, o.labels)
+}
+
+// alertRule — правило с разобранным условием и шаблонами аннотаций
+type alertRule struct {
+	db.AlertRuleRow
+	cond        alertCondition
+	annotations map[string]*template.Template
+}
+
+// alertTemplateData — данные для шаблонов аннотаций
+type alertTemplateData struct {
+	Rule      string
+	Severity  string
+	State     string
+	ServerID  string
+	Tag       string
+	Metric    string
+	Labels    map[string]string
+	Value     float64
+	Threshold float64
+}
+
+// newAlertRule проверяет правило и готовит его к вычислению
+func newAlertRule(row db.AlertRuleRow) (*alertRule, error) {
+	if !ruleNameRe.MatchString(row.Name) {
+		return nil, fmt.Errorf("%w: name must match %s", ErrInvalidAlertRule, ruleNameRe)
+	}
+	cond, err := parseAlertExpr(row.Expr)
+	if err != nil {
+		return nil, err
+	}
+	if row.Severity == "" {
+		row.Severity = defaultAlertSeverity
+	}
+	for k := range row.Labels {
+		if err := labels.ValidateKey(k); err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidAlertRule, err)
+		}
+	}
+	r := &alertRule{AlertRuleRow: row, cond: cond, annotations: make(map[string]*template.Template, len(row.Annotations))}
+	for k, text := range row.Annotations {
+		tmpl, err := template.New(k).Option("missingkey=zero").Parse(text)
+		if err != nil {
+			return nil, fmt.Errorf("%w: annotation %q: %v", ErrInvalidAlertRule, k, err)
+		}
+		r.annotations[k] = tmpl
+	}
+	return r, nil
+}
+
+// renderAnnotations подставляет данные оповещения в шаблоны аннотаций
+func (r *alertRule) renderAnnotations(a *db.AlertRow) map[string]string {
+	if len(r.annotations) == 0 {
+		return nil
+	}
+	data := alertTemplateData{
+		Rule:      r.Name,
+		Severity:  r.Severity,
+		State:     a.State,
+		ServerID:  a.ServerID,
+		Tag:       a.Tag,
+		Metric:    a.Metric,
+		Labels:    a.Labels,
+		Value:     a.Value,
+		Threshold: r.cond.threshold,
+	}
+	out := make(map[string]string, len(r.annotations))
+	for k, tmpl := range r.annotations {
+		var buf bytes.Buffer
+		if err := tmpl.Execute(&buf, data); err != nil {
+			out[k] = r.Annotations[k]
+			continue
+		}
+		out[k] = buf.String()
+	}
+	return out
+}
+
+// loadRulesFile читает правила из YAML-файла вида
+//
+//	rules:
+//	  - name: high_cpu
+//	    expr: "cpu_usage > 90 for 5m on tag=prod"
+//	    severity: critical
+func loadRulesFile(path string) ([]db.AlertRuleRow, error) {
+	v := viper.New()
+	v.SetConfigFile(path)
+	if err := v.ReadInConfig(); err != nil {
+		return nil, fmt.Errorf("error reading rules file: %w", err)
+	}
+	var file struct {
+		Rules []db.AlertRuleRow `mapstructure:"rules"`
+	}
+	if err := v.Unmarshal(&file); err != nil {
+		return nil, fmt.Errorf("error unmarshalling rules file: %w", err)
+	}
+	for i := range file.Rules {
+		file.Rules[i].Source = "file"
+	}
+	return file.Rules, nil
+}
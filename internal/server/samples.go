@@ -0,0 +1,174 @@
+package server
+
+import (
+	"context"
+	"log"
+	"regexp"
+	"sync"
+	"time"
+
+	"github.com/vovakirdan/gohub/internal/api"
+	"github.com/vovakirdan/gohub/internal/db"
+	"github.com/vovakirdan/gohub/internal/labels"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Через сколько серия сэмпла без обновлений пропадает из Prometheus
+const sampleSeriesTTL = 10 * time.Minute
+
+// Префикс метрик Prometheus для сэмплов (не пересекается с agent_cpu_usage и т.п.)
+const samplePrometheusPrefix = "agent_sample_"
+
+// sampleNameRe — допустимые имена сэмплов (совместимы с именами метрик Prometheus)
+var sampleNameRe = regexp.MustCompile(`^[a-zA-Z_:][a-zA-Z0-9_:]*$`)
+
+// Сэмплы агентов для Prometheus
+var agentSamples = newSampleCollector()
+
+// sampleTypeName переводит тип сэмпла в строку для БД
+func sampleTypeName(t api.SampleType) string {
+	if t == api.SampleType_COUNTER {
+		return "counter"
+	}
+	return "gauge"
+}
+
+// sampleTypeFromName — обратное преобразование
+func sampleTypeFromName(name string) api.SampleType {
+	if name == "counter" {
+		return api.SampleType_COUNTER
+	}
+	return api.SampleType_GAUGE
+}
+
+// convertSamples проверяет сэмплы запроса и готовит их к сохранению.
+// Лейблы сэмпла дополняют лейблы агента; некорректные сэмплы и лейблы отбрасываются.
+// Сэмплы без времени получают defaultTime; при расхождении часов агента (skewed) время сэмплов не используется.
+func convertSamples(req *api.MetricsRequest, agentLabels labels.Labels, defaultTime time.Time, skewed bool) []db.SampleRow {
+	rows := make([]db.SampleRow, 0, len(req.Samples))
+	for _, smp := range req.Samples {
+		if smp == nil || !sampleNameRe.MatchString(smp.Name) {
+			log.Printf("Dropping sample with invalid name from %s/%s", req.ServerId, req.Tag)
+			continue
+		}
+		own := make(map[string]string, len(smp.Labels))
+		for k, v := range smp.Labels {
+			if err := labels.ValidateKey(k); err != nil {
+				log.Printf("Dropping label of sample %s from %s/%s: %v", smp.Name, req.ServerId, req.Tag, err)
+				continue
+			}
+			own[k] = v
+		}
+		ts := defaultTime
+		if smp.Timestamp != nil && !skewed {
+			ts = smp.Timestamp.AsTime()
+		}
+		rows = append(rows, db.SampleRow{
+			ServerID:  req.ServerId,
+			Tag:       req.Tag,
+			Name:      smp.Name,
+			Labels:    labels.Merge(agentLabels, own),
+			Value:     smp.Value,
+			Type:      sampleTypeName(smp.Type),
+			Unit:      smp.Unit,
+			Timestamp: ts,
+		})
+	}
+	return rows
+}
+
+// ListSamples возвращает последние сэмплы с фильтрами
+func (s *MetricsServer) ListSamples(ctx context.Context, req *api.ListSamplesRequest) (*api.ListSamplesResponse, error) {
+	limit := int64(50)
+	if req.Limit > 0 {
+		limit = req.Limit
+	}
+	data, err := s.storage.LoadSamples(ctx, req.ServerId, req.Tag, req.Name, req.Labels, limit)
+	if err != nil {
+		log.Printf("DB select error: %v", err)
+		return nil, err
+	}
+
+	samples := make([]*api.StoredSample, 0, len(data))
+	for _, row := range data {
+		samples = append(samples, storedSample(row))
+	}
+	return &api.ListSamplesResponse{Samples: samples}, nil
+}
+
+// sampleSeries — последнее значение серии сэмпла
+type sampleSeries struct {
+	row     db.SampleRow
+	updated time.Time
+}
+
+// sampleCollector отдаёт последние значения сэмплов в Prometheus
+type sampleCollector struct {
+	mu     sync.Mutex
+	series map[string]*sampleSeries
+	// тип метрики закрепляется за именем при первом появлении,
+	// иначе разные агенты могли бы сломать скрейп несовместимыми типами
+	types map[string]string
+}
+
+func newSampleCollector() *sampleCollector {
+	return &sampleCollector{
+		series: make(map[string]*sampleSeries),
+		types:  make(map[string]string),
+	}
+}
+
+// Set обновляет последние значения серий
+func (c *sampleCollector) Set(rows []db.SampleRow) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := time.Now()
+	for _, row := range rows {
+		if _, ok := c.types[row.Name]; !ok {
+			c.types[row.Name] = row.Type
+		}
+		key := row.ServerID + ":" + row.Tag + ":" + row.Name + ":" + labels.Labels(row.Labels).String()
+		c.series[key] = &sampleSeries{row: row, updated: now}
+	}
+}
+
+// Delete удаляет все серии агента
+func (c *sampleCollector) Delete(serverID, tag string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for key, s := range c.series {
+		if s.row.ServerID == serverID && s.row.Tag == tag {
+			delete(c.series, key)
+		}
+	}
+}
+
+func (c *sampleCollector) Describe(ch chan<- *prometheus.Desc) {}
+
+func (c *sampleCollector) Collect(ch chan<- prometheus.Metric) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	for key, s := range c.series {
+		if now.Sub(s.updated) > sampleSeriesTTL {
+			delete(c.series, key)
+			continue
+		}
+		l := labels.Labels(s.row.Labels)
+		keys := l.Keys()
+		names := append([]string{"server_id", "tag"}, keys...)
+		values := []string{s.row.ServerID, s.row.Tag}
+		for _, k := range keys {
+			values = append(values, l[k])
+		}
+		valueType := prometheus.GaugeValue
+		if c.types[s.row.Name] == "counter" {
+			valueType = prometheus.CounterValue
+		}
+		// help должен совпадать у всех серий одного имени, поэтому единицы в него не попадают
+		desc := prometheus.NewDesc(samplePrometheusPrefix+s.row.Name, "Agent sample "+s.row.Name, names, nil)
+		ch <- prometheus.MustNewConstMetric(desc, valueType, s.row.Value, values...)
+	}
+}
@@ -2,134 +2,355 @@ package server
 
 import (
 	"context"
+	"errors"
 	"fmt"
-	"gohub/internal/api"
-	"gohub/internal/db"
-	ws "gohub/internal/websocket"
+	"github.com/vovakirdan/gohub/internal/api"
+	"github.com/vovakirdan/gohub/internal/config"
+	"github.com/vovakirdan/gohub/internal/db"
+	"github.com/vovakirdan/gohub/internal/labels"
+	"github.com/vovakirdan/gohub/internal/notify"
+	ws "github.com/vovakirdan/gohub/internal/websocket"
+	metricsv1 "github.com/vovakirdan/gohub/pkg/api/metrics/v1"
 	"log"
-	"net"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/prometheus/client_golang/prometheus"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/keepalive"
+	"google.golang.org/grpc/reflection"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/types/known/timestamppb"
 )
 
-// Определяем GaugeVec для каждой метрики
-var (
-	agentCPUUsage = prometheus.NewGaugeVec(
-		prometheus.GaugeOpts{
-			Name: "agent_cpu_usage",
-			Help: "Current CPU usage (percent) from gRPC agents",
-		},
-		[]string{"server_id", "tag"},
-	)
-	agentMemUsage = prometheus.NewGaugeVec(
-		prometheus.GaugeOpts{
-			Name: "agent_memory_usage",
-			Help: "Current memory usage (percent) from gRPC agents",
-		},
-		[]string{"server_id", "tag"},
-	)
-	agentDiskUsage = prometheus.NewGaugeVec(
-		prometheus.GaugeOpts{
-			Name: "agent_disk_usage",
-			Help: "Current disk usage (percent) from gRPC agents",
-		},
-		[]string{"server_id", "tag"},
-	)
-	agentNetworkUsage = prometheus.NewGaugeVec(
-		prometheus.GaugeOpts{
-			Name: "agent_network_usage",
-			Help: "Current network usage (bytes) from gRPC agents",
-		},
-		[]string{"server_id", "tag"},
-	)
-)
+// Метрики агентов с произвольными лейблами
+var agentMetrics = newAgentCollector()
+
+// Срок хранения истории, если database.retention не задан
+const defaultRetention = 3 * 24 * time.Hour
 
 // Init
 func init() {
-	// Регистрируем все наши векторы
-	prometheus.MustRegister(
-		agentCPUUsage,
-		agentMemUsage,
-		agentDiskUsage,
-		agentNetworkUsage,
-	)
+	// Регистрируем коллекторы метрик и heartbeat агентов
+	prometheus.MustRegister(agentMetrics, agentHeartbeats, agentSamples, agentClocks)
 }
 
 // MetricsServer реализация gRPC-сервиса
 type MetricsServer struct {
 	api.UnimplementedMetricsServiceServer
-	mu      sync.Mutex
-	metrics map[string]*api.MetricsRequest
+	// последние значения по серверам/тегам
+	latest *latestCache
+
+	// лейблы, назначенные на сервере (ключ server_id:tag, tag="" — весь сервер)
+	labelsMu sync.RWMutex
+	assigned map[string]map[string]string
+
+	// указания агентам (интервал, slow_down, повторная отправка инвентаря)
+	control *control
+	// агенты, ожидающие запросы диагностики
+	diagnostics *diagnosticWatchers
+	// допустимое расхождение часов агентов
+	maxClockSkew time.Duration
+	// подписчики StreamMetrics
+	broker *sampleBroker
+	// проверка входящих данных агентов
+	validator *validator
+	// очередь записи принятых измерений в БД
+	ingest *ingestQueue
+	// состояния online/stale/offline
+	monitor *statusMonitor
+	// правила и активные оповещения
+	alerts *alertEngine
+	// каналы уведомлений об оповещениях
+	notifier *notify.Dispatcher
+	// заглушки уведомлений и окна обслуживания
+	silences    *silenceSet
+	maintenance *maintenanceTracker
+	// базовые линии рядов и оценки аномалий
+	anomalies *anomalyDetector
+	// прогноз заполнения по трендам истории
+	forecasts *forecaster
+	// сколько хранить историю metrics и samples
+	retention time.Duration
+
+	grpcServer *grpc.Server
+	grpcCfg    config.GRPCListenerConfig
+	health     *health.Server
+	// проверка здоровья запускается один раз, из Start или SinglePortHandler
+	startOnce sync.Once
+	// gRPC слушает свой порт (Start); иначе вызовы идут только через HTTP-порт
+	served atomic.Bool
+	// вызовы gRPC через HTTP-порт, которых Shutdown дожидается сам
+	httpCalls *httpCalls
+	// закрывается при остановке сервера
+	done         chan struct{}
+	shutdownOnce sync.Once
 
 	storage *db.Storage
 	hub     *ws.Hub
 }
 
 // NewMetricsServer создаёт сервер с подключённой БД
-func NewMetricsServer(storage *db.Storage, hub *ws.Hub) *MetricsServer {
-	return &MetricsServer{
-		metrics: make(map[string]*api.MetricsRequest),
-		storage: storage,
-		hub:     hub,
+func NewMetricsServer(storage *db.Storage, hub *ws.Hub, cfg *config.Config) (*MetricsServer, error) {
+	agentsCfg := cfg.Agents
+	if ms := agentsCfg.SendIntervalMs; ms < 0 || (ms > 0 && ms < MinSendIntervalMs) {
+		return nil, fmt.Errorf("agents.send_interval_ms: must be 0 or at least %d, got %d", MinSendIntervalMs, ms)
 	}
+	v, err := newValidator(cfg.Validation)
+	if err != nil {
+		return nil, err
+	}
+	q, err := newIngestQueue(cfg.Ingest, storage)
+	if err != nil {
+		return nil, err
+	}
+	notifier, err := notify.New(cfg.Notify)
+	if err != nil {
+		return nil, err
+	}
+	anomalies, err := newAnomalyDetector(cfg.Anomaly)
+	if err != nil {
+		return nil, err
+	}
+	forecasts, err := newForecaster(cfg.Forecast, cfg.Database.Retention)
+	if err != nil {
+		return nil, err
+	}
+	retention := cfg.Database.Retention
+	if retention <= 0 {
+		retention = max(defaultRetention, forecasts.longestWindow())
+	}
+	s := &MetricsServer{
+		latest:       newLatestCache(),
+		assigned:     make(map[string]map[string]string),
+		control:      newControl(agentsCfg),
+		diagnostics:  newDiagnosticWatchers(),
+		maxClockSkew: agentsCfg.MaxClockSkew,
+		broker:       newSampleBroker(),
+		validator:    v,
+		ingest:       q,
+		monitor:      newStatusMonitor(cfg.Monitor),
+		alerts:       newAlertEngine(cfg.Alerts),
+		notifier:     notifier,
+		silences:     newSilenceSet(),
+		maintenance:  newMaintenanceTracker(),
+		anomalies:    anomalies,
+		forecasts:    forecasts,
+		retention:    retention,
+		grpcCfg:      cfg.Server.GRPC,
+		storage:      storage,
+		hub:          hub,
+		httpCalls:    newHTTPCalls(),
+		done:         make(chan struct{}),
+	}
+	q.touch = s.touchServer
+	s.newGRPCServer()
+	return s, nil
+}
+
+// Retention возвращает срок хранения истории metrics и samples
+func (s *MetricsServer) Retention() time.Duration {
+	return s.retention
+}
+
+// LoadAssignedLabels загружает назначенные на сервере лейблы из БД
+func (s *MetricsServer) LoadAssignedLabels(ctx context.Context) error {
+	rows, err := s.storage.LoadServerLabels(ctx)
+	if err != nil {
+		return err
+	}
+	s.labelsMu.Lock()
+	defer s.labelsMu.Unlock()
+	s.assigned = make(map[string]map[string]string, len(rows))
+	for _, r := range rows {
+		s.assigned[r.ServerID+":"+r.Tag] = r.Labels
+	}
+	return nil
+}
+
+// SetAssignedLabels сохраняет лейблы сервера в БД и в кеше
+func (s *MetricsServer) SetAssignedLabels(ctx context.Context, serverID, tag string, l map[string]string) error {
+	for k := range l {
+		if err := labels.ValidateKey(k); err != nil {
+			return err
+		}
+	}
+	if err := s.storage.SaveServerLabels(ctx, serverID, tag, l); err != nil {
+		return err
+	}
+	s.labelsMu.Lock()
+	defer s.labelsMu.Unlock()
+	if len(l) == 0 {
+		delete(s.assigned, serverID+":"+tag)
+	} else {
+		s.assigned[serverID+":"+tag] = l
+	}
+	return nil
+}
+
+// effectiveLabels объединяет лейблы агента с назначенными на сервере.
+// Приоритет: агент < весь сервер (tag="") < конкретный тег.
+func (s *MetricsServer) effectiveLabels(serverID, tag string, agent map[string]string) labels.Labels {
+	valid := make(map[string]string, len(agent))
+	for k, v := range agent {
+		if err := labels.ValidateKey(k); err != nil {
+			log.Printf("Dropping label from %s/%s: %v", serverID, tag, err)
+			continue
+		}
+		valid[k] = v
+	}
+
+	s.labelsMu.RLock()
+	defer s.labelsMu.RUnlock()
+	return labels.Merge(valid, s.assigned[serverID+":"], s.assigned[serverID+":"+tag])
 }
 
 // SendMetrics обрабатывает запрос на запись метрик
 func (s *MetricsServer) SendMetrics(ctx context.Context, req *api.MetricsRequest) (*api.MetricsResponse, error) {
-	s.mu.Lock()
-	s.metrics[req.ServerId+":"+req.Tag] = req
-	s.mu.Unlock()
+	defer s.control.begin()()
+
+	if s.shuttingDown() {
+		return nil, errShuttingDown
+	}
+	if err := s.validator.validateMetrics(req); err != nil {
+		return nil, err
+	}
+
+	lbls := s.effectiveLabels(req.ServerId, req.Tag, req.Labels)
+	received := time.Now()
+	skewed := agentClocks.observe(req.ServerId, req.Tag, req.SentAt, received, s.maxClockSkew)
+	collectedAt := sampleTime(req.CollectedAt, received, skewed)
+	samples := convertSamples(req, lbls, collectedAt, skewed)
+	legacy := hasLegacyFields(req)
 
 	// Логируем
-	log.Printf("Received metrics: host=%s, tag=%s, CPU=%.2f, MEM=%.2f, DISK=%.2f, NET=%.2f",
-		req.ServerId, req.Tag, req.CpuUsage, req.MemoryUsage, req.DiskUsage, req.NetworkUsage,
+	log.Printf("Received metrics: host=%s, tag=%s, labels={%s}, CPU=%.2f, MEM=%.2f, DISK=%.2f, NET=%.2f, samples=%d",
+		req.ServerId, req.Tag, lbls, req.CpuUsage, req.MemoryUsage, req.DiskUsage, req.NetworkUsage, len(samples),
 	)
 
-	// Сохраняем в БД
-	if err := s.storage.SaveMetrics(
-		ctx,
-		req.ServerId,
-		req.Tag,
-		req.CpuUsage,
-		req.MemoryUsage,
-		req.DiskUsage,
-		req.NetworkUsage,
-	); err != nil {
-		log.Printf("DB insert error: %v", err)
-		return &api.MetricsResponse{Status: "DB Error"}, err
-	}
-
-	// Обновляем метрики
-	agentCPUUsage.WithLabelValues(req.ServerId, req.Tag).Set(req.CpuUsage)
-	agentMemUsage.WithLabelValues(req.ServerId, req.Tag).Set(req.MemoryUsage)
-	agentDiskUsage.WithLabelValues(req.ServerId, req.Tag).Set(req.DiskUsage)
-	agentNetworkUsage.WithLabelValues(req.ServerId, req.Tag).Set(req.NetworkUsage)
-
-	// Рассылаем по WebSocket
-	s.hub.BroadcastMetrics(ws.WSMetricUpdate{
-		Message:      "New metrics received",
-		ServerID:     req.ServerId,
-		Tag:          req.Tag,
-		CPUUsage:     req.CpuUsage,
-		MemoryUsage:  req.MemoryUsage,
-		DiskUsage:    req.DiskUsage,
-		NetworkUsage: req.NetworkUsage,
-		Timestamp:    time.Now().Unix(),
-	})
-
-	return &api.MetricsResponse{Status: "OK"}, nil
+	// Ставим в очередь на запись; ответ агенту не ждёт БД
+	item := &ingestItem{samples: samples, serverID: req.ServerId, tag: req.Tag, labels: lbls, received: received}
+	if legacy {
+		item.metrics = &db.MetricRecord{
+			ServerID:     req.ServerId,
+			Tag:          req.Tag,
+			CPUUsage:     req.CpuUsage,
+			MemoryUsage:  req.MemoryUsage,
+			DiskUsage:    req.DiskUsage,
+			NetworkUsage: req.NetworkUsage,
+			Labels:       lbls,
+			CreatedAt:    collectedAt,
+		}
+	}
+	if err := s.ingest.enqueue(ctx, item); err != nil {
+		return nil, err
+	}
+	var values *[4]float64
+	if legacy {
+		values = &[4]float64{req.CpuUsage, req.MemoryUsage, req.DiskUsage, req.NetworkUsage}
+	}
+	s.latest.update(req.ServerId, req.Tag, lbls, values, collectedAt, samples, received)
+	agentSamples.Set(samples)
+	s.publish(req, lbls, collectedAt, legacy, samples)
+
+	// Сохраняем инвентарь, если агент его приложил
+	if req.Inventory != nil {
+		if err := s.saveInventory(ctx, req); err != nil {
+			log.Printf("Failed to save inventory for %s/%s: %v", req.ServerId, req.Tag, err)
+		}
+	}
+
+	// Фиксированные метрики обновляем и рассылаем, только если агент их прислал
+	if legacy {
+		agentMetrics.Set(req.ServerId, req.Tag, lbls,
+			req.CpuUsage, req.MemoryUsage, req.DiskUsage, req.NetworkUsage,
+		)
+
+		// Рассылаем по WebSocket
+		s.hub.BroadcastMetrics(ws.WSMetricUpdate{
+			Message:       "New metrics received",
+			ServerID:      req.ServerId,
+			Tag:           req.Tag,
+			Labels:        lbls,
+			CPUUsage:      req.CpuUsage,
+			MemoryUsage:   req.MemoryUsage,
+			DiskUsage:     req.DiskUsage,
+			NetworkUsage:  req.NetworkUsage,
+			InMaintenance: s.maintenance.inMaintenance(req.ServerId, req.Tag),
+			Timestamp:     collectedAt.Unix(),
+		})
+	}
+
+	return s.control.respond(&api.MetricsResponse{Status: "OK"}, req.ServerId, req.Tag), nil
+}
+
+// publish отправляет принятые измерения подписчикам StreamMetrics и правилам оповещений
+func (s *MetricsServer) publish(req *api.MetricsRequest, lbls labels.Labels, collectedAt time.Time, legacy bool, samples []db.SampleRow) {
+	var out []*api.StoredSample
+	if legacy {
+		out = legacySamples(req.ServerId, req.Tag, lbls, collectedAt,
+			[4]float64{req.CpuUsage, req.MemoryUsage, req.DiskUsage, req.NetworkUsage})
+	}
+	for _, row := range samples {
+		out = append(out, storedSample(row))
+	}
+	s.broker.publish(out)
+	// Серверы в обслуживании не обучают базовые линии и не вычисляют правила
+	active := s.withoutMaintenance(out)
+	s.alerts.observe(active, s.anomalies.observe(active))
+}
+
+// hasLegacyFields — в запросе есть фиксированные поля cpu/memory/disk/network.
+// Старые агенты присылают только их; новый агент может прислать одни сэмплы.
+func hasLegacyFields(req *api.MetricsRequest) bool {
+	if len(req.Samples) == 0 {
+		return true
+	}
+	return req.CpuUsage != 0 || req.MemoryUsage != 0 || req.DiskUsage != 0 || req.NetworkUsage != 0
+}
+
+// saveInventory сохраняет инвентарь агента и отмечает его полученным
+func (s *MetricsServer) saveInventory(ctx context.Context, req *api.MetricsRequest) error {
+	data, err := protojson.MarshalOptions{UseProtoNames: true}.Marshal(req.Inventory)
+	if err != nil {
+		return err
+	}
+	if err := s.storage.SaveInventory(ctx, req.ServerId, req.Tag, data); err != nil {
+		return err
+	}
+	s.control.markInventory(req.ServerId + ":" + req.Tag)
+	return nil
 }
 
-// ListMetrics возвращает список метрик (упрощённо)
+// ListMetrics возвращает метрики за диапазон времени постранично
 func (s *MetricsServer) ListMetrics(ctx context.Context, req *api.ListMetricsRequest) (*api.ListMetricsResponse, error) {
 	limit := int64(50) // дефолт
 	if req.Limit > 0 {
 		limit = req.Limit
 	}
-	data, err := s.storage.LoadMetrics(ctx, req.ServerId, req.Tag, limit)
+	q := db.MetricsQuery{
+		ServerID:  req.ServerId,
+		Tag:       req.Tag,
+		Labels:    req.Labels,
+		Ascending: req.Order == api.SortOrder_SORT_ORDER_ASC,
+		Limit:     limit,
+		PageToken: req.PageToken,
+	}
+	if req.From != nil {
+		q.From = req.From.AsTime()
+	}
+	if req.To != nil {
+		q.To = req.To.AsTime()
+	}
+	data, next, err := s.storage.LoadMetrics(ctx, q)
+	if errors.Is(err, db.ErrInvalidPageToken) {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
 	if err != nil {
 		log.Printf("DB select error: %v", err)
 		return nil, err
@@ -137,7 +358,7 @@ func (s *MetricsServer) ListMetrics(ctx context.Context, req *api.ListMetricsReq
 
 	metrics := make([]*api.Metric, 0, len(data))
 	for _, row := range data {
-		metrics = append(metrics, &api.Metric{
+		m := &api.Metric{
 			Id:           row.ID,
 			ServerId:     row.ServerID,
 			Tag:          row.Tag,
@@ -146,29 +367,72 @@ func (s *MetricsServer) ListMetrics(ctx context.Context, req *api.ListMetricsReq
 			DiskUsage:    row.DiskUsage,
 			NetworkUsage: row.NetworkUsage,
 			CreatedAt:    row.CreatedAt,
-		})
+			Labels:       row.Labels,
+		}
+		if t, err := time.Parse(time.RFC3339Nano, row.CreatedAt); err == nil {
+			m.CreatedTime = timestamppb.New(t)
+		}
+		metrics = append(metrics, m)
 	}
 
 	return &api.ListMetricsResponse{
-		Metrics: metrics,
+		Metrics:       metrics,
+		NextPageToken: next,
 	}, nil
 }
 
-// StreamMetrics - пока заглушка
-func (s *MetricsServer) StreamMetrics(req *api.StreamRequest, stream api.MetricsService_StreamMetricsServer) error {
-	return fmt.Errorf("not implemented")
-}
-
 // Start запускает gRPC-сервер
 func (s *MetricsServer) Start() error {
-	listener, err := net.Listen("tcp", ":50051")
+	listener, err := Listen(s.grpcCfg.Addr)
 	if err != nil {
-		return fmt.Errorf("failed to listen on :50051: %w", err)
+		return err
+	}
+
+	s.startOnce.Do(s.startBackground)
+	s.served.Store(true)
+
+	log.Printf("gRPC server is running on %s", s.grpcCfg.Addr)
+	return s.grpcServer.Serve(listener)
+}
+
+// startBackground запускает проверку здоровья, монитор серверов, оповещения и запись очереди приёма
+func (s *MetricsServer) startBackground() {
+	go s.watchHealth(s.health)
+	go s.watchServers()
+	go s.runAlerts()
+	go s.watchMaintenance()
+	if s.anomalies.enabled {
+		go s.runAnomalies()
+	}
+	if s.forecasts.enabled {
+		go s.runForecasts()
+	}
+	s.notifier.Start()
+	s.ingest.start()
+}
+
+// newGRPCServer создаёт gRPC-сервер со всеми сервисами; он же обслуживает gRPC-Web на HTTP-порту
+func (s *MetricsServer) newGRPCServer() {
+	// Перехватчики выполняются по порядку: метрики и журнал видят ошибку после восстановления от паники
+	opts := []grpc.ServerOption{
+		grpc.ChainUnaryInterceptor(observeUnary, recoverUnary),
+		grpc.ChainStreamInterceptor(observeStream, recoverStream),
+	}
+	if s.grpcCfg.ConnectionTimeout > 0 {
+		opts = append(opts, grpc.ConnectionTimeout(s.grpcCfg.ConnectionTimeout))
+	}
+	if s.grpcCfg.MaxConnectionIdle > 0 {
+		opts = append(opts, grpc.KeepaliveParams(keepalive.ServerParameters{MaxConnectionIdle: s.grpcCfg.MaxConnectionIdle}))
 	}
+	s.grpcServer = grpc.NewServer(opts...)
+	api.RegisterMetricsServiceServer(s.grpcServer, s)
+	// Версионированный API; устаревший package api обслуживается на переходный период
+	metricsv1.RegisterMetricsServiceServer(s.grpcServer, &v1Server{s: s})
 
-	grpcServer := grpc.NewServer()
-	api.RegisterMetricsServiceServer(grpcServer, s)
+	// grpc.health.v1, привязанный к доступности БД
+	s.health = health.NewServer()
+	healthpb.RegisterHealthServer(s.grpcServer, s.health)
 
-	log.Println("gRPC server is running on :50051")
-	return grpcServer.Serve(listener)
+	// Reflection для grpcurl и подобных инструментов
+	reflection.Register(s.grpcServer)
 }
@@ -0,0 +1,133 @@
+package server
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"sync"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// errShuttingDown — ответ агентам и подписчикам во время остановки; агент повторит запрос позже
+var errShuttingDown = status.Error(codes.Unavailable, "server is shutting down")
+
+// shuttingDown — сервер останавливается
+func (s *MetricsServer) shuttingDown() bool {
+	select {
+	case <-s.done:
+		return true
+	default:
+		return false
+	}
+}
+
+// httpCalls считает вызовы gRPC, пришедшие через HTTP-порт (gRPC-Web и single_port).
+// GracefulStop не умеет закрывать такие соединения (Drain у них не реализован и паникует),
+// поэтому при остановке их дожидается сам сервер.
+type httpCalls struct {
+	mu     sync.Mutex
+	n      int
+	closed bool
+	// закрывается, когда приём закрыт и начатых вызовов не осталось
+	idle chan struct{}
+}
+
+func newHTTPCalls() *httpCalls {
+	return &httpCalls{idle: make(chan struct{})}
+}
+
+// enter регистрирует вызов; false — сервер останавливается и вызов надо отклонить
+func (c *httpCalls) enter() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		return false
+	}
+	c.n++
+	return true
+}
+
+func (c *httpCalls) leave() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.n--
+	if c.closed && c.n == 0 {
+		close(c.idle)
+	}
+}
+
+// close перестаёт принимать вызовы и возвращает канал, закрываемый после последнего начатого
+func (c *httpCalls) close() <-chan struct{} {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.closed {
+		c.closed = true
+		if c.n == 0 {
+			close(c.idle)
+		}
+	}
+	return c.idle
+}
+
+// serveGRPCHTTP передаёт вызов gRPC с HTTP-порта в h; во время остановки отвечает 503 (Unavailable)
+func (s *MetricsServer) serveGRPCHTTP(h http.Handler, w http.ResponseWriter, r *http.Request) {
+	if !s.httpCalls.enter() {
+		http.Error(w, "server is shutting down", http.StatusServiceUnavailable)
+		return
+	}
+	defer s.httpCalls.leave()
+	h.ServeHTTP(w, r)
+}
+
+// StopAccepting помечает сервер останавливающимся: агенты получают Unavailable,
+// потоки подписчиков и фоновые задачи завершаются. Вызывается до остановки HTTP-сервера,
+// чтобы потоки gRPC-Web не держали его до таймаута; Shutdown вызывает его сам.
+func (s *MetricsServer) StopAccepting() {
+	s.shutdownOnce.Do(func() {
+		close(s.done)
+		// Балансировщики по grpc.health.v1 перестают слать новых агентов
+		s.health.Shutdown()
+	})
+}
+
+// Shutdown останавливает gRPC-сервер: перестаёт принимать агентов, завершает потоки подписчиков,
+// дожидается обработки начатых запросов и дописывает очередь приёма в БД.
+// Если ctx истекает раньше, оставшиеся запросы обрываются.
+// HTTP-сервер нужно остановить до вызова Shutdown: вызовы gRPC-Web и single_port идут через него.
+func (s *MetricsServer) Shutdown(ctx context.Context) {
+	s.StopAccepting()
+
+	// Вызовы через HTTP-порт дожидаемся сами
+	select {
+	case <-s.httpCalls.close():
+	case <-ctx.Done():
+	}
+
+	if !s.served.Load() || ctx.Err() != nil {
+		// Отдельный gRPC-порт не открывался (single_port) или время вышло:
+		// GracefulStop запаниковал бы на соединениях, пришедших через HTTP
+		s.grpcServer.Stop()
+		log.Println("gRPC server stopped")
+	} else {
+		stopped := make(chan struct{})
+		go func() {
+			s.grpcServer.GracefulStop()
+			close(stopped)
+		}()
+		select {
+		case <-stopped:
+			log.Println("gRPC server stopped")
+		case <-ctx.Done():
+			log.Printf("gRPC server did not drain in time (%v), closing remaining calls", ctx.Err())
+			s.grpcServer.Stop()
+		}
+	}
+	// Принятые запросы дописываем в БД
+	s.ingest.close(ctx)
+	// Оценки аномалий и базовые линии сохраняем после последних принятых сэмплов
+	s.flushAnomalies(ctx)
+	// Отправляем уведомления, уже стоящие в очередях каналов
+	s.notifier.Close(ctx)
+}
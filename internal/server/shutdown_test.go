@@ -0,0 +1,166 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/vovakirdan/gohub/internal/api"
+	"github.com/vovakirdan/gohub/internal/config"
+	ws "github.com/vovakirdan/gohub/internal/websocket"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+)
+
+// newTestServer создаёт сервер без БД и без фоновых задач: запросы, которым нужна БД, в тестах не выполняются
+func newTestServer(t *testing.T, cfg *config.Config) *MetricsServer {
+	t.Helper()
+	srv, err := NewMetricsServer(nil, ws.NewHub(), cfg)
+	if err != nil {
+		t.Fatalf("NewMetricsServer: %v", err)
+	}
+	srv.startOnce.Do(func() {})
+	return srv
+}
+
+// waitHTTPCalls ждёт, пока через HTTP-порт не пойдёт n вызовов gRPC
+func waitHTTPCalls(t *testing.T, srv *MetricsServer, n int) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		srv.httpCalls.mu.Lock()
+		cur := srv.httpCalls.n
+		srv.httpCalls.mu.Unlock()
+		if cur == n {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("expected %d gRPC call(s) over HTTP", n)
+}
+
+// openGRPCWebStream открывает StreamMetrics по gRPC-Web и возвращает канал с телом ответа после его закрытия
+func openGRPCWebStream(t *testing.T, url string) <-chan string {
+	t.Helper()
+	// Пустой StreamRequest: флаг кадра и нулевая длина
+	req, err := http.NewRequest(http.MethodPost, url+api.MetricsService_StreamMetrics_FullMethodName, bytes.NewReader(make([]byte, 5)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", "application/grpc-web+proto")
+	req.Header.Set("X-Grpc-Web", "1")
+	body := make(chan string, 1)
+	go func() {
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			body <- "error: " + err.Error()
+			return
+		}
+		defer resp.Body.Close()
+		data, _ := io.ReadAll(resp.Body)
+		// Статус приходит в трейлере тела или, если сообщений не было, в заголовках
+		body <- string(data) + "\ngrpc-status: " + resp.Header.Get("Grpc-Status")
+	}()
+	return body
+}
+
+func TestShutdownWithGRPCWebStream(t *testing.T) {
+	for _, served := range []bool{false, true} {
+		name := "http-only"
+		if served {
+			name = "grpc-port"
+		}
+		t.Run(name, func(t *testing.T) {
+			cfg := &config.Config{}
+			cfg.Server.GRPC.Addr = "127.0.0.1:0"
+			srv := newTestServer(t, cfg)
+			if served {
+				started := make(chan error, 1)
+				go func() { started <- srv.Start() }()
+				for !srv.served.Load() {
+					select {
+					case err := <-started:
+						t.Fatalf("Start: %v", err)
+					case <-time.After(10 * time.Millisecond):
+					}
+				}
+			}
+
+			httpServer := httptest.NewServer(srv.GRPCWebHandler(http.NotFoundHandler()))
+			defer httpServer.Close()
+			body := openGRPCWebStream(t, httpServer.URL)
+			waitHTTPCalls(t, srv, 1)
+
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			srv.StopAccepting()
+			if err := httpServer.Config.Shutdown(ctx); err != nil {
+				t.Fatalf("HTTP shutdown: %v", err)
+			}
+			srv.Shutdown(ctx)
+			if ctx.Err() != nil {
+				t.Fatal("shutdown did not finish in time")
+			}
+
+			// Поток закрыт с Unavailable (grpc-status 14 в трейлере gRPC-Web)
+			select {
+			case b := <-body:
+				if !strings.Contains(b, "grpc-status: 14") && !strings.Contains(b, "grpc-status:14") {
+					t.Fatalf("expected Unavailable trailer, got %q", b)
+				}
+			case <-time.After(5 * time.Second):
+				t.Fatal("stream was not closed")
+			}
+
+			// Новые вызовы после остановки отклоняются
+			if srv.httpCalls.enter() {
+				t.Fatal("call accepted after shutdown")
+			}
+		})
+	}
+}
+
+func TestShutdownSinglePortWithAgentStream(t *testing.T) {
+	srv := newTestServer(t, &config.Config{})
+	httpServer := httptest.NewServer(srv.SinglePortHandler(http.NotFoundHandler()))
+	defer httpServer.Close()
+
+	conn, err := grpc.NewClient(strings.TrimPrefix(httpServer.URL, "http://"), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	stream, err := api.NewMetricsServiceClient(conn).StreamMetrics(context.Background(), &api.StreamRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	waitHTTPCalls(t, srv, 1)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	srv.StopAccepting()
+	if err := httpServer.Config.Shutdown(ctx); err != nil {
+		t.Fatalf("HTTP shutdown: %v", err)
+	}
+	srv.Shutdown(ctx)
+	if ctx.Err() != nil {
+		t.Fatal("shutdown did not finish in time")
+	}
+
+	if _, err := stream.Recv(); status.Code(err) != codes.Unavailable {
+		t.Fatalf("expected Unavailable, got %v", err)
+	}
+	// Новые вызовы агентов получают Unavailable, а не обрыв соединения
+	_, err = api.NewMetricsServiceClient(conn).SendMetrics(ctx, &api.MetricsRequest{ServerId: "a"})
+	if status.Code(err) != codes.Unavailable {
+		t.Fatalf("expected Unavailable after shutdown, got %v", err)
+	}
+}
@@ -0,0 +1,174 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/vovakirdan/gohub/internal/db"
+	"github.com/vovakirdan/gohub/internal/labels"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// ErrInvalidSilence — заглушка не прошла проверку
+var ErrInvalidSilence = errors.New("invalid silence")
+
+var (
+	silencesActive = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "gohub_silences_active",
+		Help: "Silences currently suppressing notifications",
+	})
+	notificationsSuppressed = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "gohub_alert_notifications_suppressed_total",
+		Help: "Alert notifications not sent because of a silence or a maintenance window",
+	}, []string{"reason"})
+)
+
+func init() {
+	prometheus.MustRegister(silencesActive, notificationsSuppressed)
+}
+
+// silenceMatches — заглушка относится к оповещению
+func silenceMatches(sil *db.SilenceRow, serverID, tag string, l map[string]string) bool {
+	if sil.ServerID != "" && sil.ServerID != serverID {
+		return false
+	}
+	if sil.Tag != "" && sil.Tag != tag {
+		return false
+	}
+	return labels.Match(l, sil.Labels)
+}
+
+// silenceSet — заглушки, которые ещё не истекли
+type silenceSet struct {
+	mu    sync.RWMutex
+	items map[int64]db.SilenceRow
+}
+
+func newSilenceSet() *silenceSet {
+	return &silenceSet{items: make(map[int64]db.SilenceRow)}
+}
+
+// refresh забывает истёкшие заглушки и обновляет gohub_silences_active
+func (s *silenceSet) refresh(now time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	active := 0
+	for id, sil := range s.items {
+		switch {
+		case !now.Before(sil.EndsAt):
+			delete(s.items, id)
+		case !now.Before(sil.StartsAt):
+			active++
+		}
+	}
+	silencesActive.Set(float64(active))
+}
+
+// match возвращает действующую заглушку оповещения
+func (s *silenceSet) match(serverID, tag string, l map[string]string, now time.Time) (db.SilenceRow, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for _, sil := range s.items {
+		if now.Before(sil.StartsAt) || !now.Before(sil.EndsAt) {
+			continue
+		}
+		if silenceMatches(&sil, serverID, tag, l) {
+			return sil, true
+		}
+	}
+	return db.SilenceRow{}, false
+}
+
+// LoadSilences загружает из БД заглушки, которые ещё не истекли
+func (s *MetricsServer) LoadSilences(ctx context.Context) error {
+	now := time.Now()
+	rows, err := s.storage.LoadSilences(ctx, now)
+	if err != nil {
+		return err
+	}
+	s.silences.mu.Lock()
+	for _, row := range rows {
+		s.silences.items[row.ID] = row
+	}
+	s.silences.mu.Unlock()
+	s.silences.refresh(now)
+	return nil
+}
+
+// Silences возвращает заглушки: неистёкшие из памяти или (all) все из БД
+func (s *MetricsServer) Silences(ctx context.Context, all bool) ([]db.SilenceRow, error) {
+	if all {
+		return s.storage.LoadSilences(ctx, time.Time{})
+	}
+	now := time.Now()
+	s.silences.mu.RLock()
+	result := make([]db.SilenceRow, 0, len(s.silences.items))
+	for _, sil := range s.silences.items {
+		if now.Before(sil.EndsAt) {
+			result = append(result, sil)
+		}
+	}
+	s.silences.mu.RUnlock()
+	sort.Slice(result, func(i, j int) bool { return result[i].ID > result[j].ID })
+	return result, nil
+}
+
+// CreateSilence проверяет и сохраняет заглушку; StartsAt по умолчанию — сейчас
+func (s *MetricsServer) CreateSilence(ctx context.Context, sil db.SilenceRow) (db.SilenceRow, error) {
+	now := time.Now()
+	if sil.ServerID == "" && sil.Tag == "" && len(sil.Labels) == 0 {
+		return sil, fmt.Errorf("%w: at least one of server_id, tag or labels is required", ErrInvalidSilence)
+	}
+	for k := range sil.Labels {
+		if err := labels.ValidateKey(k); err != nil {
+			return sil, fmt.Errorf("%w: %v", ErrInvalidSilence, err)
+		}
+	}
+	if sil.StartsAt.IsZero() {
+		sil.StartsAt = now
+	}
+	if !sil.EndsAt.After(sil.StartsAt) || !sil.EndsAt.After(now) {
+		return sil, fmt.Errorf("%w: ends_at must be in the future and after starts_at", ErrInvalidSilence)
+	}
+	sil, err := s.storage.SaveSilence(ctx, sil)
+	if err != nil {
+		return sil, err
+	}
+	s.silences.mu.Lock()
+	s.silences.items[sil.ID] = sil
+	s.silences.mu.Unlock()
+	s.silences.refresh(now)
+	return sil, nil
+}
+
+// ExpireSilence завершает заглушку сейчас; false — заглушки нет или она уже истекла
+func (s *MetricsServer) ExpireSilence(ctx context.Context, id int64) (bool, error) {
+	now := time.Now()
+	ok, err := s.storage.ExpireSilence(ctx, id, now)
+	if err != nil {
+		return false, err
+	}
+	s.silences.mu.Lock()
+	delete(s.silences.items, id)
+	s.silences.mu.Unlock()
+	s.silences.refresh(now)
+	return ok, nil
+}
+
+// suppressed — уведомление об оповещении подавлено заглушкой или окном обслуживания
+func (s *MetricsServer) suppressed(a *db.AlertRow, now time.Time) bool {
+	if _, ok := s.silences.match(a.ServerID, a.Tag, a.Labels, now); ok {
+		notificationsSuppressed.WithLabelValues("silence").Inc()
+		return true
+	}
+	if s.maintenance.window(a.ServerID, a.Tag, a.Labels) != "" {
+		notificationsSuppressed.WithLabelValues("maintenance").Inc()
+		return true
+	}
+	return false
+}
@@ -0,0 +1,355 @@
+package server
+
+import (
+	"context"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/vovakirdan/gohub/internal/api"
+	"github.com/vovakirdan/gohub/internal/db"
+	"github.com/vovakirdan/gohub/internal/labels"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// Размер буфера подписчика: медленный подписчик теряет новые измерения, а не тормозит приём
+const streamBufferSize = 1024
+
+// Размер пачки при догрузке истории
+const streamReplayBatch = 1000
+
+// Имена фиксированных полей MetricsRequest в потоке измерений
+var legacySampleNames = [4]string{"cpu_usage", "memory_usage", "disk_usage", "network_usage"}
+
+var (
+	streamSubscribers = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "gohub_stream_subscribers",
+		Help: "Number of active StreamMetrics subscribers",
+	})
+	streamDropped = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "gohub_stream_dropped_samples_total",
+		Help: "Samples dropped because a StreamMetrics subscriber buffer was full",
+	})
+)
+
+func init() {
+	prometheus.MustRegister(streamSubscribers, streamDropped)
+}
+
+// streamFilter — фильтр подписки на поток
+type streamFilter struct {
+	serverID string
+	tag      string
+	labels   map[string]string
+	names    map[string]bool
+}
+
+func newStreamFilter(req *api.StreamRequest) *streamFilter {
+	f := &streamFilter{serverID: req.ServerId, tag: req.Tag, labels: req.Labels}
+	if len(req.Names) > 0 {
+		f.names = make(map[string]bool, len(req.Names))
+		for _, n := range req.Names {
+			f.names[n] = true
+		}
+	}
+	return f
+}
+
+func (f *streamFilter) match(s *api.StoredSample) bool {
+	if f.serverID != "" && f.serverID != s.ServerId {
+		return false
+	}
+	if f.tag != "" && f.tag != s.Tag {
+		return false
+	}
+	if f.names != nil && !f.names[s.Sample.Name] {
+		return false
+	}
+	return labels.Match(s.Sample.Labels, f.labels)
+}
+
+// wantsLegacy — нужны ли подписчику фиксированные поля
+func (f *streamFilter) wantsLegacy() bool {
+	if f.names == nil {
+		return true
+	}
+	for _, n := range legacySampleNames {
+		if f.names[n] {
+			return true
+		}
+	}
+	return false
+}
+
+// subscriber — подписчик потока с ограниченным буфером
+type subscriber struct {
+	filter *streamFilter
+	ch     chan *api.StoredSample
+	// Сколько измерений не поместилось в буфер
+	dropped atomic.Int64
+}
+
+// sampleBroker рассылает принятые измерения подписчикам StreamMetrics
+type sampleBroker struct {
+	mu          sync.RWMutex
+	subscribers map[*subscriber]struct{}
+}
+
+func newSampleBroker() *sampleBroker {
+	return &sampleBroker{subscribers: make(map[*subscriber]struct{})}
+}
+
+func (b *sampleBroker) subscribe(f *streamFilter) *subscriber {
+	sub := &subscriber{filter: f, ch: make(chan *api.StoredSample, streamBufferSize)}
+	b.mu.Lock()
+	b.subscribers[sub] = struct{}{}
+	b.mu.Unlock()
+	streamSubscribers.Inc()
+	return sub
+}
+
+func (b *sampleBroker) unsubscribe(sub *subscriber) {
+	b.mu.Lock()
+	delete(b.subscribers, sub)
+	b.mu.Unlock()
+	streamSubscribers.Dec()
+}
+
+// publish рассылает измерения; если буфер подписчика полон, измерение для него теряется
+func (b *sampleBroker) publish(samples []*api.StoredSample) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	for sub := range b.subscribers {
+		for _, s := range samples {
+			if !sub.filter.match(s) {
+				continue
+			}
+			select {
+			case sub.ch <- s:
+			default:
+				sub.dropped.Add(1)
+				streamDropped.Inc()
+			}
+		}
+	}
+}
+
+// legacySamples представляет фиксированные поля записи как сэмплы
+func legacySamples(serverID, tag string, l map[string]string, ts time.Time, values [4]float64) []*api.StoredSample {
+	out := make([]*api.StoredSample, 0, len(values))
+	pbTime := timestamppb.New(ts)
+	units := [4]string{"percent", "percent", "percent", "bytes"}
+	for i, name := range legacySampleNames {
+		out = append(out, &api.StoredSample{
+			ServerId: serverID,
+			Tag:      tag,
+			Sample: &api.Sample{
+				Name:      name,
+				Labels:    l,
+				Value:     values[i],
+				Timestamp: pbTime,
+				Type:      api.SampleType_GAUGE,
+				Unit:      units[i],
+			},
+		})
+	}
+	return out
+}
+
+// storedSample переводит строку samples в сообщение потока
+func storedSample(row db.SampleRow) *api.StoredSample {
+	return &api.StoredSample{
+		Id:       row.ID,
+		ServerId: row.ServerID,
+		Tag:      row.Tag,
+		Sample: &api.Sample{
+			Name:      row.Name,
+			Labels:    row.Labels,
+			Value:     row.Value,
+			Timestamp: timestamppb.New(row.Timestamp),
+			Type:      sampleTypeFromName(row.Type),
+			Unit:      row.Unit,
+		},
+	}
+}
+
+// historyCursor постранично читает историю одной таблицы по возрастанию времени
+type historyCursor struct {
+	fetch func(afterTime time.Time, afterID int64) ([]*api.StoredSample, time.Time, int64, int, error)
+
+	buf       []*api.StoredSample
+	afterTime time.Time
+	afterID   int64
+	done      bool
+}
+
+// peek возвращает следующее измерение (nil — история закончилась)
+func (c *historyCursor) peek() (*api.StoredSample, error) {
+	for len(c.buf) == 0 && !c.done {
+		batch, lastTime, lastID, rows, err := c.fetch(c.afterTime, c.afterID)
+		if err != nil {
+			return nil, err
+		}
+		c.buf = batch
+		c.afterTime, c.afterID = lastTime, lastID
+		c.done = rows < streamReplayBatch
+	}
+	if len(c.buf) == 0 {
+		return nil, nil
+	}
+	return c.buf[0], nil
+}
+
+func (c *historyCursor) pop() {
+	c.buf = c.buf[1:]
+}
+
+// replayCursor — время последнего отправленного из истории измерения каждой серии
+type replayCursor map[string]time.Time
+
+func streamSeries(smp *api.StoredSample) string {
+	return seriesKey(smp.ServerId, smp.Tag, smp.Sample.Name, smp.Sample.Labels)
+}
+
+func (c replayCursor) add(smp *api.StoredSample) {
+	key, ts := streamSeries(smp), smp.Sample.Timestamp.AsTime()
+	if ts.After(c[key]) {
+		c[key] = ts
+	}
+}
+
+// replayed — измерение уже отправлено из истории: серия догружена до его времени или дальше.
+// Сравнение по сериям, а не по общему времени: отставшие часы агента или пачка из буфера агента
+// не теряются из-за более свежих измерений других серверов.
+func (c replayCursor) replayed(smp *api.StoredSample) bool {
+	until, ok := c[streamSeries(smp)]
+	return ok && !smp.Sample.Timestamp.AsTime().After(until)
+}
+
+// replayHistory отправляет историю с момента since, объединяя metrics и samples по времени.
+// Возвращает время последнего отправленного измерения каждой серии.
+func (s *MetricsServer) replayHistory(ctx context.Context, f *streamFilter, since time.Time, send func(*api.StoredSample) error) (replayCursor, error) {
+	hf := db.HistoryFilter{ServerID: f.serverID, Tag: f.tag, Labels: f.labels}
+	for name := range f.names {
+		hf.Names = append(hf.Names, name)
+	}
+
+	var cursors []*historyCursor
+	if f.wantsLegacy() {
+		cursors = append(cursors, &historyCursor{
+			afterTime: since, afterID: 0,
+			fetch: func(afterTime time.Time, afterID int64) ([]*api.StoredSample, time.Time, int64, int, error) {
+				rows, err := s.storage.LoadMetricsAfter(ctx, db.HistoryFilter{ServerID: hf.ServerID, Tag: hf.Tag, Labels: hf.Labels}, afterTime, afterID, streamReplayBatch)
+				if err != nil || len(rows) == 0 {
+					return nil, afterTime, afterID, 0, err
+				}
+				var out []*api.StoredSample
+				for _, r := range rows {
+					ts, err := time.Parse(time.RFC3339Nano, r.CreatedAt)
+					if err != nil {
+						return nil, afterTime, afterID, 0, err
+					}
+					afterTime, afterID = ts, r.ID
+					for _, smp := range legacySamples(r.ServerID, r.Tag, r.Labels, ts,
+						[4]float64{r.CPUUsage, r.MemoryUsage, r.DiskUsage, r.NetworkUsage}) {
+						smp.Id = r.ID
+						if f.match(smp) {
+							out = append(out, smp)
+						}
+					}
+				}
+				return out, afterTime, afterID, len(rows), nil
+			},
+		})
+	}
+	cursors = append(cursors, &historyCursor{
+		afterTime: since, afterID: 0,
+		fetch: func(afterTime time.Time, afterID int64) ([]*api.StoredSample, time.Time, int64, int, error) {
+			rows, err := s.storage.LoadSamplesAfter(ctx, hf, afterTime, afterID, streamReplayBatch)
+			if err != nil || len(rows) == 0 {
+				return nil, afterTime, afterID, 0, err
+			}
+			out := make([]*api.StoredSample, 0, len(rows))
+			for _, r := range rows {
+				afterTime, afterID = r.Timestamp, r.ID
+				out = append(out, storedSample(r))
+			}
+			return out, afterTime, afterID, len(rows), nil
+		},
+	})
+
+	last := make(replayCursor)
+	for {
+		// Выбираем самое раннее измерение среди курсоров
+		var next *historyCursor
+		var nextSample *api.StoredSample
+		for _, c := range cursors {
+			smp, err := c.peek()
+			if err != nil {
+				return last, err
+			}
+			if smp != nil && (nextSample == nil || smp.Sample.Timestamp.AsTime().Before(nextSample.Sample.Timestamp.AsTime())) {
+				next, nextSample = c, smp
+			}
+		}
+		if next == nil {
+			return last, nil
+		}
+		next.pop()
+		if err := send(nextSample); err != nil {
+			return last, err
+		}
+		last.add(nextSample)
+	}
+}
+
+// StreamMetrics отдаёт измерения по мере приёма. Если задан since, сначала отдаётся история
+// из БД, затем живые данные (измерения серии не новее последнего из истории этой серии пропускаются).
+// Если за время догрузки истории буфер подписчика переполнился, поток закрывается с Aborted:
+// потерянные измерения уже в БД, и клиент получит их, переподписавшись с since последнего полученного.
+func (s *MetricsServer) StreamMetrics(req *api.StreamRequest, stream api.MetricsService_StreamMetricsServer) error {
+	ctx := stream.Context()
+	filter := newStreamFilter(req)
+
+	// Подписываемся до чтения истории, чтобы не потерять измерения на стыке
+	sub := s.broker.subscribe(filter)
+	defer s.broker.unsubscribe(sub)
+
+	var replayed replayCursor
+	if req.Since != nil {
+		var err error
+		replayed, err = s.replayHistory(ctx, filter, req.Since.AsTime(), stream.Send)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			log.Printf("StreamMetrics replay error: %v", err)
+			return status.Errorf(codes.Unavailable, "failed to replay history: %v", err)
+		}
+		if n := sub.dropped.Load(); n > 0 {
+			return status.Errorf(codes.Aborted,
+				"%d live sample(s) dropped while replaying history: resubscribe with since set to the last received sample", n)
+		}
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-s.done:
+			return errShuttingDown
+		case smp := <-sub.ch:
+			if replayed.replayed(smp) {
+				continue
+			}
+			if err := stream.Send(smp); err != nil {
+				return err
+			}
+		}
+	}
+}
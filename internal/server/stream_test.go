@@ -0,0 +1,53 @@
+package server
+
+import (
+	"testing"
+	"time"
+
+	"github.com/vovakirdan/gohub/internal/api"
+
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+func TestReplayCursorPerSeries(t *testing.T) {
+	base := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	sample := func(serverID, name string, env string, ts time.Time) *api.StoredSample {
+		return &api.StoredSample{ServerId: serverID, Sample: &api.Sample{
+			Name: name, Labels: map[string]string{"env": env}, Timestamp: timestamppb.New(ts),
+		}}
+	}
+
+	c := make(replayCursor)
+	c.add(sample("db-1", "cpu_usage", "prod", base))
+	c.add(sample("web-1", "cpu_usage", "prod", base.Add(5*time.Second)))
+
+	cases := []struct {
+		name     string
+		smp      *api.StoredSample
+		replayed bool
+	}{
+		{"same series, same time", sample("db-1", "cpu_usage", "prod", base), true},
+		{"same series, older", sample("db-1", "cpu_usage", "prod", base.Add(-time.Second)), true},
+		{"same series, newer", sample("db-1", "cpu_usage", "prod", base.Add(time.Second)), false},
+		// Другой сервер уже догружен дальше, но эта серия — нет
+		{"series behind another server", sample("db-1", "cpu_usage", "prod", base.Add(3*time.Second)), false},
+		{"other metric", sample("db-1", "memory_usage", "prod", base), false},
+		{"other labels", sample("db-1", "cpu_usage", "staging", base), false},
+		{"series not in history", sample("db-2", "cpu_usage", "prod", base.Add(-time.Hour)), false},
+	}
+	for _, tc := range cases {
+		if got := c.replayed(tc.smp); got != tc.replayed {
+			t.Errorf("%s: replayed=%t, want %t", tc.name, got, tc.replayed)
+		}
+	}
+
+	// Курсор серии не откатывается назад
+	c.add(sample("db-1", "cpu_usage", "prod", base.Add(-time.Minute)))
+	if !c.replayed(sample("db-1", "cpu_usage", "prod", base)) {
+		t.Error("cursor moved backwards")
+	}
+	// Без since курсора нет и ничего не пропускается
+	if replayCursor(nil).replayed(sample("db-1", "cpu_usage", "prod", base)) {
+		t.Error("nil cursor skipped a sample")
+	}
+}
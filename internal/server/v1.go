@@ -0,0 +1,148 @@
+package server
+
+import (
+	"context"
+
+	"github.com/vovakirdan/gohub/internal/api"
+	metricsv1 "github.com/vovakirdan/gohub/pkg/api/metrics/v1"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+)
+
+// v1Server обслуживает gohub.metrics.v1.MetricsService поверх обработчиков устаревшего API (MetricsServer).
+// Номера полей в v1 и устаревшем package api совпадают, поэтому сообщения
+// переводятся через wire-формат без ручного копирования полей.
+type v1Server struct {
+	metricsv1.UnimplementedMetricsServiceServer
+	s api.MetricsServiceServer
+}
+
+// convertMessage переводит сообщение одного пакета в совместимое сообщение другого
+func convertMessage(src, dst proto.Message) error {
+	data, err := proto.Marshal(src)
+	if err != nil {
+		return status.Errorf(codes.Internal, "failed to convert %s: %v", src.ProtoReflect().Descriptor().FullName(), err)
+	}
+	if err := proto.Unmarshal(data, dst); err != nil {
+		return status.Errorf(codes.Internal, "failed to convert %s: %v", dst.ProtoReflect().Descriptor().FullName(), err)
+	}
+	return nil
+}
+
+// unary вызывает обработчик устаревшего API для запроса v1
+func unary[L, LR, R proto.Message](ctx context.Context, req proto.Message, legacy L, call func(context.Context, L) (LR, error), resp R) (R, error) {
+	var zero R
+	if err := convertMessage(req, legacy); err != nil {
+		return zero, err
+	}
+	out, err := call(ctx, legacy)
+	if err != nil {
+		return zero, err
+	}
+	if err := convertMessage(out, resp); err != nil {
+		return zero, err
+	}
+	return resp, nil
+}
+
+// serverStream отдаёт сообщения устаревшего API в поток v1
+type serverStream[L, V any] struct {
+	grpc.ServerStream
+	dst grpc.ServerStreamingServer[V]
+}
+
+func (a *serverStream[L, V]) Send(m *L) error {
+	out := new(V)
+	if err := convertMessage(any(m).(proto.Message), any(out).(proto.Message)); err != nil {
+		return err
+	}
+	return a.dst.Send(out)
+}
+
+// clientStream читает сообщения v1 как сообщения устаревшего API
+type clientStream[L, LR, V, VR any] struct {
+	grpc.ServerStream
+	src grpc.ClientStreamingServer[V, VR]
+}
+
+func (a *clientStream[L, LR, V, VR]) Recv() (*L, error) {
+	m, err := a.src.Recv()
+	if err != nil {
+		return nil, err
+	}
+	out := new(L)
+	if err := convertMessage(any(m).(proto.Message), any(out).(proto.Message)); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (a *clientStream[L, LR, V, VR]) SendAndClose(m *LR) error {
+	out := new(VR)
+	if err := convertMessage(any(m).(proto.Message), any(out).(proto.Message)); err != nil {
+		return err
+	}
+	return a.src.SendAndClose(out)
+}
+
+func (v *v1Server) SendMetrics(ctx context.Context, req *metricsv1.MetricsRequest) (*metricsv1.MetricsResponse, error) {
+	return unary(ctx, req, &api.MetricsRequest{}, v.s.SendMetrics, &metricsv1.MetricsResponse{})
+}
+
+func (v *v1Server) StreamMetrics(req *metricsv1.StreamRequest, stream metricsv1.MetricsService_StreamMetricsServer) error {
+	legacy := &api.StreamRequest{}
+	if err := convertMessage(req, legacy); err != nil {
+		return err
+	}
+	return v.s.StreamMetrics(legacy, &serverStream[api.StoredSample, metricsv1.StoredSample]{ServerStream: stream, dst: stream})
+}
+
+func (v *v1Server) ListMetrics(ctx context.Context, req *metricsv1.ListMetricsRequest) (*metricsv1.ListMetricsResponse, error) {
+	return unary(ctx, req, &api.ListMetricsRequest{}, v.s.ListMetrics, &metricsv1.ListMetricsResponse{})
+}
+
+func (v *v1Server) Heartbeat(ctx context.Context, req *metricsv1.HeartbeatRequest) (*metricsv1.HeartbeatResponse, error) {
+	return unary(ctx, req, &api.HeartbeatRequest{}, v.s.Heartbeat, &metricsv1.HeartbeatResponse{})
+}
+
+func (v *v1Server) WatchDiagnostics(req *metricsv1.WatchDiagnosticsRequest, stream metricsv1.MetricsService_WatchDiagnosticsServer) error {
+	legacy := &api.WatchDiagnosticsRequest{}
+	if err := convertMessage(req, legacy); err != nil {
+		return err
+	}
+	return v.s.WatchDiagnostics(legacy, &serverStream[api.DiagnosticRequest, metricsv1.DiagnosticRequest]{ServerStream: stream, dst: stream})
+}
+
+func (v *v1Server) ReportDiagnostic(stream metricsv1.MetricsService_ReportDiagnosticServer) error {
+	return v.s.ReportDiagnostic(&clientStream[api.DiagnosticOutput, api.DiagnosticAck, metricsv1.DiagnosticOutput, metricsv1.DiagnosticAck]{
+		ServerStream: stream,
+		src:          stream,
+	})
+}
+
+func (v *v1Server) ListSamples(ctx context.Context, req *metricsv1.ListSamplesRequest) (*metricsv1.ListSamplesResponse, error) {
+	return unary(ctx, req, &api.ListSamplesRequest{}, v.s.ListSamples, &metricsv1.ListSamplesResponse{})
+}
+
+func (v *v1Server) QueryRange(ctx context.Context, req *metricsv1.QueryRangeRequest) (*metricsv1.QueryRangeResponse, error) {
+	return unary(ctx, req, &api.QueryRangeRequest{}, v.s.QueryRange, &metricsv1.QueryRangeResponse{})
+}
+
+func (v *v1Server) ListServers(ctx context.Context, req *metricsv1.ListServersRequest) (*metricsv1.ListServersResponse, error) {
+	return unary(ctx, req, &api.ListServersRequest{}, v.s.ListServers, &metricsv1.ListServersResponse{})
+}
+
+func (v *v1Server) GetServer(ctx context.Context, req *metricsv1.GetServerRequest) (*metricsv1.ServerInfo, error) {
+	return unary(ctx, req, &api.GetServerRequest{}, v.s.GetServer, &metricsv1.ServerInfo{})
+}
+
+func (v *v1Server) DeleteServer(ctx context.Context, req *metricsv1.DeleteServerRequest) (*metricsv1.DeleteServerResponse, error) {
+	return unary(ctx, req, &api.DeleteServerRequest{}, v.s.DeleteServer, &metricsv1.DeleteServerResponse{})
+}
+
+func (v *v1Server) GetFleetSnapshot(ctx context.Context, req *metricsv1.FleetSnapshotRequest) (*metricsv1.FleetSnapshot, error) {
+	return unary(ctx, req, &api.FleetSnapshotRequest{}, v.s.GetFleetSnapshot, &metricsv1.FleetSnapshot{})
+}
@@ -0,0 +1,419 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"reflect"
+	"testing"
+
+	"github.com/vovakirdan/gohub/internal/api"
+	metricsv1 "github.com/vovakirdan/gohub/pkg/api/metrics/v1"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/test/bufconn"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+)
+
+// relName — имя сообщения или перечисления без пакета
+func relName(d protoreflect.Descriptor) string {
+	return string(d.FullName())[len(d.ParentFile().Package())+1:]
+}
+
+// typeName — тип поля для сравнения: вид, а для сообщений и перечислений ещё и имя (без пакета, если тип из того же файла)
+func typeName(fd protoreflect.FieldDescriptor) string {
+	var d protoreflect.Descriptor
+	switch {
+	case fd.Message() != nil:
+		d = fd.Message()
+	case fd.Enum() != nil:
+		d = fd.Enum()
+	default:
+		return fd.Kind().String()
+	}
+	if d.ParentFile().Path() == fd.ParentFile().Path() {
+		return fd.Kind().String() + " " + relName(d)
+	}
+	return fd.Kind().String() + " " + string(d.FullName())
+}
+
+// describeMessages собирает поля всех сообщений файла (с вложенными) по имени сообщения и номеру поля
+func describeMessages(msgs protoreflect.MessageDescriptors, out map[string]map[protoreflect.FieldNumber]string) {
+	for i := 0; i < msgs.Len(); i++ {
+		md := msgs.Get(i)
+		fields := make(map[protoreflect.FieldNumber]string)
+		for j := 0; j < md.Fields().Len(); j++ {
+			fd := md.Fields().Get(j)
+			desc := fmt.Sprintf("%s %s %s", fd.Name(), fd.Cardinality(), typeName(fd))
+			if fd.IsMap() {
+				desc += fmt.Sprintf(" map<%s, %s>", typeName(fd.MapKey()), typeName(fd.MapValue()))
+			}
+			if oo := fd.ContainingOneof(); oo != nil {
+				desc += " oneof " + string(oo.Name())
+			}
+			fields[fd.Number()] = desc
+		}
+		out[relName(md)] = fields
+		describeMessages(md.Messages(), out)
+	}
+}
+
+// describeEnums собирает значения всех перечислений файла (с вложенными)
+func describeEnums(enums protoreflect.EnumDescriptors, msgs protoreflect.MessageDescriptors, out map[string]map[protoreflect.EnumNumber]string) {
+	for i := 0; i < enums.Len(); i++ {
+		ed := enums.Get(i)
+		values := make(map[protoreflect.EnumNumber]string)
+		for j := 0; j < ed.Values().Len(); j++ {
+			values[ed.Values().Get(j).Number()] = string(ed.Values().Get(j).Name())
+		}
+		out[relName(ed)] = values
+	}
+	for i := 0; i < msgs.Len(); i++ {
+		describeEnums(msgs.Get(i).Enums(), msgs.Get(i).Messages(), out)
+	}
+}
+
+// describeMethods собирает RPC сервиса: типы запроса и ответа и вид потоков
+func describeMethods(sd protoreflect.ServiceDescriptor) map[string]string {
+	out := make(map[string]string)
+	for i := 0; i < sd.Methods().Len(); i++ {
+		m := sd.Methods().Get(i)
+		out[string(m.Name())] = fmt.Sprintf("%s stream=%t -> %s stream=%t",
+			relName(m.Input()), m.IsStreamingClient(), relName(m.Output()), m.IsStreamingServer())
+	}
+	return out
+}
+
+// TestV1DescriptorsMatchLegacy проверяет, что v1 и устаревший package api совпадают по wire-формату:
+// на этом держится перевод сообщений в v1Server
+func TestV1DescriptorsMatchLegacy(t *testing.T) {
+	legacy, v1 := api.File_internal_api_metrics_proto, metricsv1.File_gohub_metrics_v1_metrics_proto
+
+	legacyMsgs := make(map[string]map[protoreflect.FieldNumber]string)
+	v1Msgs := make(map[string]map[protoreflect.FieldNumber]string)
+	describeMessages(legacy.Messages(), legacyMsgs)
+	describeMessages(v1.Messages(), v1Msgs)
+	if len(legacyMsgs) == 0 {
+		t.Fatal("no messages in package api")
+	}
+	for name, fields := range legacyMsgs {
+		if !reflect.DeepEqual(fields, v1Msgs[name]) {
+			t.Errorf("message %s differs:\napi: %v\nv1:  %v", name, fields, v1Msgs[name])
+		}
+	}
+	for name := range v1Msgs {
+		if _, ok := legacyMsgs[name]; !ok {
+			t.Errorf("message %s is missing in package api", name)
+		}
+	}
+
+	legacyEnums := make(map[string]map[protoreflect.EnumNumber]string)
+	v1Enums := make(map[string]map[protoreflect.EnumNumber]string)
+	describeEnums(legacy.Enums(), legacy.Messages(), legacyEnums)
+	describeEnums(v1.Enums(), v1.Messages(), v1Enums)
+	if !reflect.DeepEqual(legacyEnums, v1Enums) {
+		t.Errorf("enums differ:\napi: %v\nv1:  %v", legacyEnums, v1Enums)
+	}
+
+	legacySvc := legacy.Services().ByName("MetricsService")
+	v1Svc := v1.Services().ByName("MetricsService")
+	if legacySvc == nil || v1Svc == nil {
+		t.Fatal("MetricsService is missing")
+	}
+	if got, want := describeMethods(v1Svc), describeMethods(legacySvc); !reflect.DeepEqual(got, want) {
+		t.Errorf("MetricsService methods differ:\napi: %v\nv1:  %v", want, got)
+	}
+}
+
+// fillMessage заполняет все поля сообщения ненулевыми значениями (в oneof — первое поле)
+func fillMessage(m protoreflect.Message, depth int) {
+	fields := m.Descriptor().Fields()
+	for i := 0; i < fields.Len(); i++ {
+		fd := fields.Get(i)
+		if oo := fd.ContainingOneof(); oo != nil && m.WhichOneof(oo) != nil {
+			continue
+		}
+		switch {
+		case fd.IsMap():
+			mp := m.Mutable(fd).Map()
+			key := fieldValue(fd.MapKey(), 1).MapKey()
+			if fd.MapValue().Message() != nil {
+				v := mp.NewValue()
+				fillMessage(v.Message(), depth+1)
+				mp.Set(key, v)
+			} else {
+				mp.Set(key, fieldValue(fd.MapValue(), 1))
+			}
+		case fd.IsList():
+			l := m.Mutable(fd).List()
+			for n := 1; n <= 2; n++ {
+				if fd.Message() != nil {
+					v := l.NewElement()
+					fillMessage(v.Message(), depth+1)
+					l.Append(v)
+				} else {
+					l.Append(fieldValue(fd, n))
+				}
+			}
+		case fd.Message() != nil:
+			if depth < 4 {
+				fillMessage(m.Mutable(fd).Message(), depth+1)
+			}
+		default:
+			m.Set(fd, fieldValue(fd, 1))
+		}
+	}
+}
+
+// fieldValue — ненулевое скалярное значение поля, зависящее от номера поля и n
+func fieldValue(fd protoreflect.FieldDescriptor, n int) protoreflect.Value {
+	x := int64(fd.Number())*10 + int64(n)
+	switch fd.Kind() {
+	case protoreflect.BoolKind:
+		return protoreflect.ValueOfBool(true)
+	case protoreflect.EnumKind:
+		values := fd.Enum().Values()
+		return protoreflect.ValueOfEnum(values.Get(values.Len() - 1).Number())
+	case protoreflect.Int32Kind, protoreflect.Sint32Kind, protoreflect.Sfixed32Kind:
+		return protoreflect.ValueOfInt32(int32(x))
+	case protoreflect.Int64Kind, protoreflect.Sint64Kind, protoreflect.Sfixed64Kind:
+		return protoreflect.ValueOfInt64(x)
+	case protoreflect.Uint32Kind, protoreflect.Fixed32Kind:
+		return protoreflect.ValueOfUint32(uint32(x))
+	case protoreflect.Uint64Kind, protoreflect.Fixed64Kind:
+		return protoreflect.ValueOfUint64(uint64(x))
+	case protoreflect.FloatKind:
+		return protoreflect.ValueOfFloat32(float32(x) + 0.5)
+	case protoreflect.DoubleKind:
+		return protoreflect.ValueOfFloat64(float64(x) + 0.25)
+	case protoreflect.StringKind:
+		return protoreflect.ValueOfString(fmt.Sprintf("%s-%d", fd.Name(), n))
+	case protoreflect.BytesKind:
+		return protoreflect.ValueOfBytes([]byte{byte(x), 0xff})
+	}
+	panic(fmt.Sprintf("unsupported kind %s", fd.Kind()))
+}
+
+// filled создаёт заполненное сообщение по полному имени типа
+func filled(t *testing.T, name protoreflect.FullName) proto.Message {
+	t.Helper()
+	mt, err := protoregistry.GlobalTypes.FindMessageByName(name)
+	if err != nil {
+		t.Fatalf("message %s: %v", name, err)
+	}
+	m := mt.New()
+	fillMessage(m, 0)
+	return m.Interface()
+}
+
+// newMessage создаёт пустое сообщение по полному имени типа
+func newMessage(t *testing.T, name protoreflect.FullName) proto.Message {
+	t.Helper()
+	mt, err := protoregistry.GlobalTypes.FindMessageByName(name)
+	if err != nil {
+		t.Fatalf("message %s: %v", name, err)
+	}
+	return mt.New().Interface()
+}
+
+// assertSameJSON сравнивает сообщения разных пакетов по JSON-представлению: совпадают имена полей и значения
+func assertSameJSON(t *testing.T, what string, got, want proto.Message) {
+	t.Helper()
+	decode := func(m proto.Message) any {
+		data, err := protojson.Marshal(m)
+		if err != nil {
+			t.Fatalf("%s: marshal %s: %v", what, m.ProtoReflect().Descriptor().FullName(), err)
+		}
+		var v any
+		if err := json.Unmarshal(data, &v); err != nil {
+			t.Fatal(err)
+		}
+		return v
+	}
+	if g, w := decode(got), decode(want); !reflect.DeepEqual(g, w) {
+		t.Errorf("%s differs:\ngot:  %v\nwant: %v", what, g, w)
+	}
+	if len(got.ProtoReflect().GetUnknown()) > 0 {
+		t.Errorf("%s has unknown fields", what)
+	}
+}
+
+// legacyEcho — устаревший API, который запоминает запросы и отвечает заполненными сообщениями
+type legacyEcho struct {
+	api.UnimplementedMetricsServiceServer
+	reqs []proto.Message
+	resp proto.Message
+}
+
+// reply запоминает запрос и возвращает заготовленный ответ
+func reply[R proto.Message](e *legacyEcho, req proto.Message) (R, error) {
+	e.reqs = append(e.reqs, req)
+	return e.resp.(R), nil
+}
+
+func (e *legacyEcho) SendMetrics(_ context.Context, req *api.MetricsRequest) (*api.MetricsResponse, error) {
+	return reply[*api.MetricsResponse](e, req)
+}
+
+func (e *legacyEcho) ListMetrics(_ context.Context, req *api.ListMetricsRequest) (*api.ListMetricsResponse, error) {
+	return reply[*api.ListMetricsResponse](e, req)
+}
+
+func (e *legacyEcho) Heartbeat(_ context.Context, req *api.HeartbeatRequest) (*api.HeartbeatResponse, error) {
+	return reply[*api.HeartbeatResponse](e, req)
+}
+
+func (e *legacyEcho) ListSamples(_ context.Context, req *api.ListSamplesRequest) (*api.ListSamplesResponse, error) {
+	return reply[*api.ListSamplesResponse](e, req)
+}
+
+func (e *legacyEcho) QueryRange(_ context.Context, req *api.QueryRangeRequest) (*api.QueryRangeResponse, error) {
+	return reply[*api.QueryRangeResponse](e, req)
+}
+
+func (e *legacyEcho) ListServers(_ context.Context, req *api.ListServersRequest) (*api.ListServersResponse, error) {
+	return reply[*api.ListServersResponse](e, req)
+}
+
+func (e *legacyEcho) GetServer(_ context.Context, req *api.GetServerRequest) (*api.ServerInfo, error) {
+	return reply[*api.ServerInfo](e, req)
+}
+
+func (e *legacyEcho) DeleteServer(_ context.Context, req *api.DeleteServerRequest) (*api.DeleteServerResponse, error) {
+	return reply[*api.DeleteServerResponse](e, req)
+}
+
+func (e *legacyEcho) GetFleetSnapshot(_ context.Context, req *api.FleetSnapshotRequest) (*api.FleetSnapshot, error) {
+	return reply[*api.FleetSnapshot](e, req)
+}
+
+func (e *legacyEcho) StreamMetrics(req *api.StreamRequest, stream api.MetricsService_StreamMetricsServer) error {
+	e.reqs = append(e.reqs, req)
+	for i := 0; i < 2; i++ {
+		if err := stream.Send(e.resp.(*api.StoredSample)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (e *legacyEcho) WatchDiagnostics(req *api.WatchDiagnosticsRequest, stream api.MetricsService_WatchDiagnosticsServer) error {
+	e.reqs = append(e.reqs, req)
+	for i := 0; i < 2; i++ {
+		if err := stream.Send(e.resp.(*api.DiagnosticRequest)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (e *legacyEcho) ReportDiagnostic(stream api.MetricsService_ReportDiagnosticServer) error {
+	for {
+		req, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			return stream.SendAndClose(e.resp.(*api.DiagnosticAck))
+		}
+		if err != nil {
+			return err
+		}
+		e.reqs = append(e.reqs, req)
+	}
+}
+
+// TestV1RoundTrip вызывает каждый RPC gohub.metrics.v1 по gRPC и проверяет, что запрос доходит до устаревшего
+// API без потерь, а ответ возвращается клиенту v1 без потерь
+func TestV1RoundTrip(t *testing.T) {
+	echo := &legacyEcho{}
+	lis := bufconn.Listen(1 << 20)
+	grpcServer := grpc.NewServer()
+	metricsv1.RegisterMetricsServiceServer(grpcServer, &v1Server{s: echo})
+	go grpcServer.Serve(lis)
+	defer grpcServer.Stop()
+
+	conn, err := grpc.NewClient("passthrough:///bufconn",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return lis.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	legacyName := func(d protoreflect.Descriptor) protoreflect.FullName {
+		return api.File_internal_api_metrics_proto.Package().Append(protoreflect.Name(relName(d)))
+	}
+
+	methods := metricsv1.File_gohub_metrics_v1_metrics_proto.Services().ByName("MetricsService").Methods()
+	for i := 0; i < methods.Len(); i++ {
+		md := methods.Get(i)
+		t.Run(string(md.Name()), func(t *testing.T) {
+			req := filled(t, md.Input().FullName())
+			echo.reqs = nil
+			echo.resp = filled(t, legacyName(md.Output()))
+			ctx := context.Background()
+			method := fmt.Sprintf("/%s/%s", md.Parent().FullName(), md.Name())
+
+			var resps []proto.Message
+			if !md.IsStreamingClient() && !md.IsStreamingServer() {
+				resp := newMessage(t, md.Output().FullName())
+				if err := conn.Invoke(ctx, method, req, resp); err != nil {
+					t.Fatalf("%s: %v", method, err)
+				}
+				resps = append(resps, resp)
+			} else {
+				desc := &grpc.StreamDesc{ServerStreams: md.IsStreamingServer(), ClientStreams: md.IsStreamingClient()}
+				stream, err := conn.NewStream(ctx, desc, method)
+				if err != nil {
+					t.Fatalf("%s: %v", method, err)
+				}
+				sent := 1
+				if md.IsStreamingClient() {
+					sent = 2
+				}
+				for n := 0; n < sent; n++ {
+					if err := stream.SendMsg(req); err != nil {
+						t.Fatalf("%s: send: %v", method, err)
+					}
+				}
+				if err := stream.CloseSend(); err != nil {
+					t.Fatal(err)
+				}
+				for {
+					resp := newMessage(t, md.Output().FullName())
+					if err := stream.RecvMsg(resp); errors.Is(err, io.EOF) {
+						break
+					} else if err != nil {
+						t.Fatalf("%s: recv: %v", method, err)
+					}
+					resps = append(resps, resp)
+				}
+			}
+
+			wantReqs, wantResps := 1, 1
+			if md.IsStreamingClient() {
+				wantReqs = 2
+			}
+			if md.IsStreamingServer() {
+				wantResps = 2
+			}
+			if len(echo.reqs) != wantReqs || len(resps) != wantResps {
+				t.Fatalf("expected %d request(s) and %d response(s), got %d and %d", wantReqs, wantResps, len(echo.reqs), len(resps))
+			}
+			for _, got := range echo.reqs {
+				if got.ProtoReflect().Descriptor().FullName() != legacyName(md.Input()) {
+					t.Fatalf("legacy API got %s", got.ProtoReflect().Descriptor().FullName())
+				}
+				assertSameJSON(t, "request", got, req)
+			}
+			for _, got := range resps {
+				assertSameJSON(t, "response", got, echo.resp)
+			}
+		})
+	}
+}
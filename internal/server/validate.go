@@ -0,0 +1,249 @@
+package server
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/vovakirdan/gohub/internal/api"
+	"github.com/vovakirdan/gohub/internal/config"
+	"github.com/vovakirdan/gohub/internal/labels"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Ограничения по умолчанию, если в конфиге не заданы
+const (
+	defaultMaxServerIDLength   = 128
+	defaultMaxTagLength        = 64
+	defaultIDCharset           = `^[A-Za-z0-9._:@-]+$`
+	defaultMaxLabelValueLength = 256
+	defaultMaxSamples          = 1000
+)
+
+var (
+	payloadRejects = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "gohub_payload_rejects_total",
+		Help: "Agent requests rejected by validation",
+	}, []string{"server_id", "tag"})
+	payloadClamped = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "gohub_payload_clamped_total",
+		Help: "Agent values clamped to the allowed range by validation",
+	}, []string{"server_id", "tag"})
+)
+
+func init() {
+	prometheus.MustRegister(payloadRejects, payloadClamped)
+}
+
+// validator проверяет запросы агентов по ограничениям из конфига
+type validator struct {
+	maxServerIDLength   int
+	maxTagLength        int
+	idRe                *regexp.Regexp
+	maxLabelValueLength int
+	maxSamples          int
+	clampPercent        bool
+}
+
+func newValidator(cfg config.ValidationConfig) (*validator, error) {
+	v := &validator{
+		maxServerIDLength:   cfg.MaxServerIDLength,
+		maxTagLength:        cfg.MaxTagLength,
+		maxLabelValueLength: cfg.MaxLabelValueLength,
+		maxSamples:          cfg.MaxSamples,
+		clampPercent:        cfg.ClampPercent,
+	}
+	if v.maxServerIDLength <= 0 {
+		v.maxServerIDLength = defaultMaxServerIDLength
+	}
+	if v.maxTagLength <= 0 {
+		v.maxTagLength = defaultMaxTagLength
+	}
+	if v.maxLabelValueLength <= 0 {
+		v.maxLabelValueLength = defaultMaxLabelValueLength
+	}
+	if v.maxSamples <= 0 {
+		v.maxSamples = defaultMaxSamples
+	}
+	charset := cfg.IDCharset
+	if charset == "" {
+		charset = defaultIDCharset
+	}
+	re, err := regexp.Compile(charset)
+	if err != nil {
+		return nil, fmt.Errorf("invalid validation.id_charset: %w", err)
+	}
+	v.idRe = re
+	return v, nil
+}
+
+// violations — накопленные нарушения по полям
+type violations []*errdetails.BadRequest_FieldViolation
+
+func (vs *violations) add(field, format string, args ...interface{}) {
+	*vs = append(*vs, &errdetails.BadRequest_FieldViolation{
+		Field:       field,
+		Description: fmt.Sprintf(format, args...),
+	})
+}
+
+// storableText — строку примут поля text и jsonb в Postgres: без NUL-байтов и в корректном UTF-8.
+// Одна такая строка сорвала бы запись всей пачки приёма.
+func storableText(vs *violations, field, s string) bool {
+	switch {
+	case strings.IndexByte(s, 0) >= 0:
+		vs.add(field, "must not contain NUL bytes")
+	case !utf8.ValidString(s):
+		vs.add(field, "must be valid UTF-8")
+	default:
+		return true
+	}
+	return false
+}
+
+// checkIdentity проверяет server_id и tag
+func (v *validator) checkIdentity(vs *violations, serverID, tag string) {
+	switch {
+	case serverID == "":
+		vs.add("server_id", "server_id is required")
+	case !storableText(vs, "server_id", serverID):
+	case len(serverID) > v.maxServerIDLength:
+		vs.add("server_id", "longer than %d bytes", v.maxServerIDLength)
+	case !v.idRe.MatchString(serverID):
+		vs.add("server_id", "must match %s", v.idRe)
+	}
+	switch {
+	case tag == "":
+	case !storableText(vs, "tag", tag):
+	case len(tag) > v.maxTagLength:
+		vs.add("tag", "longer than %d bytes", v.maxTagLength)
+	case !v.idRe.MatchString(tag):
+		vs.add("tag", "must match %s", v.idRe)
+	}
+}
+
+// checkLabels проверяет ключи, длину и содержимое значений лейблов
+func (v *validator) checkLabels(vs *violations, field string, l map[string]string) {
+	for _, k := range labels.Labels(l).Keys() {
+		if err := labels.ValidateKey(k); err != nil {
+			vs.add(field+"."+k, "%v", err)
+			continue
+		}
+		if !storableText(vs, field+"."+k, l[k]) {
+			continue
+		}
+		if len(l[k]) > v.maxLabelValueLength {
+			vs.add(field+"."+k, "value longer than %d bytes", v.maxLabelValueLength)
+		}
+	}
+}
+
+// checkValue проверяет значение: конечное, неотрицательное (для gauge в процентах — не больше 100).
+// Возвращает значение после урезания и признак урезания.
+func (v *validator) checkValue(vs *violations, field string, value float64, percent, nonNegative bool) (float64, bool) {
+	switch {
+	case math.IsNaN(value) || math.IsInf(value, 0):
+		vs.add(field, "must be a finite number")
+	case nonNegative && value < 0:
+		vs.add(field, "must not be negative")
+	case percent && value > 100:
+		if v.clampPercent {
+			return 100, true
+		}
+		vs.add(field, "percentage must not exceed 100")
+	}
+	return value, false
+}
+
+// validateMetrics проверяет запрос SendMetrics; проценты сверх 100 урезаются в самом запросе
+func (v *validator) validateMetrics(req *api.MetricsRequest) error {
+	var vs violations
+	v.checkIdentity(&vs, req.ServerId, req.Tag)
+	v.checkLabels(&vs, "labels", req.Labels)
+
+	clamped := 0
+	fields := []struct {
+		name    string
+		value   *float64
+		percent bool
+	}{
+		{"cpu_usage", &req.CpuUsage, true},
+		{"memory_usage", &req.MemoryUsage, true},
+		{"disk_usage", &req.DiskUsage, true},
+		{"network_usage", &req.NetworkUsage, false},
+	}
+	for _, f := range fields {
+		value, c := v.checkValue(&vs, f.name, *f.value, f.percent, true)
+		if c {
+			*f.value = value
+			clamped++
+		}
+	}
+
+	if len(req.Samples) > v.maxSamples {
+		vs.add("samples", "too many samples: %d (max %d)", len(req.Samples), v.maxSamples)
+	} else {
+		for i, smp := range req.Samples {
+			field := fmt.Sprintf("samples[%d]", i)
+			if smp == nil {
+				vs.add(field, "sample is empty")
+				continue
+			}
+			if !sampleNameRe.MatchString(smp.Name) {
+				vs.add(field+".name", "must match %s", sampleNameRe)
+			}
+			v.checkLabels(&vs, field+".labels", smp.Labels)
+			storableText(&vs, field+".unit", smp.Unit)
+			// Счётчики не убывают; для gauge отрицательные значения допустимы (например, температура)
+			value, c := v.checkValue(&vs, field+".value", smp.Value, smp.Unit == "percent", smp.Type == api.SampleType_COUNTER)
+			if c {
+				smp.Value = value
+				clamped++
+			}
+		}
+	}
+
+	if clamped > 0 && len(vs) == 0 {
+		payloadClamped.WithLabelValues(req.ServerId, req.Tag).Add(float64(clamped))
+	}
+	return v.reject(req.ServerId, req.Tag, vs)
+}
+
+// validateHeartbeat проверяет запрос Heartbeat
+func (v *validator) validateHeartbeat(req *api.HeartbeatRequest) error {
+	var vs violations
+	v.checkIdentity(&vs, req.ServerId, req.Tag)
+	if req.IntervalMs < 0 {
+		vs.add("interval_ms", "must not be negative")
+	}
+	return v.reject(req.ServerId, req.Tag, vs)
+}
+
+// reject возвращает InvalidArgument с нарушениями по полям и учитывает отказ в Prometheus
+func (v *validator) reject(serverID, tag string, vs violations) error {
+	if len(vs) == 0 {
+		return nil
+	}
+	// Некорректные идентификаторы не попадают в лейблы Prometheus
+	var idErr violations
+	v.checkIdentity(&idErr, serverID, tag)
+	if len(idErr) > 0 {
+		serverID, tag = "", ""
+	}
+	payloadRejects.WithLabelValues(serverID, tag).Inc()
+	log.Printf("Rejected request from %q/%q: %d invalid field(s), first: %s: %s",
+		serverID, tag, len(vs), vs[0].Field, vs[0].Description)
+
+	st := status.New(codes.InvalidArgument, fmt.Sprintf("invalid request: %s: %s", vs[0].Field, vs[0].Description))
+	if detailed, err := st.WithDetails(&errdetails.BadRequest{FieldViolations: vs}); err == nil {
+		st = detailed
+	}
+	return st.Err()
+}
@@ -0,0 +1,59 @@
+package server
+
+import (
+	"testing"
+
+	"github.com/vovakirdan/gohub/internal/api"
+	"github.com/vovakirdan/gohub/internal/config"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestValidateMetricsRejectsUnstorableText(t *testing.T) {
+	v, err := newValidator(config.ValidationConfig{IDCharset: `^.+$`})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cases := []struct {
+		field string
+		req   *api.MetricsRequest
+	}{
+		{"server_id", &api.MetricsRequest{ServerId: "a\x00b"}},
+		{"tag", &api.MetricsRequest{ServerId: "a", Tag: "t\x00"}},
+		{"labels.env", &api.MetricsRequest{ServerId: "a", Labels: map[string]string{"env": "pr\x00od"}}},
+		{"labels.env", &api.MetricsRequest{ServerId: "a", Labels: map[string]string{"env": "\xff"}}},
+		{"samples[0].labels.mount", &api.MetricsRequest{ServerId: "a", Samples: []*api.Sample{
+			{Name: "disk_free", Labels: map[string]string{"mount": "/\x00"}},
+		}}},
+		{"samples[0].unit", &api.MetricsRequest{ServerId: "a", Samples: []*api.Sample{
+			{Name: "disk_free", Unit: "bytes\x00"},
+		}}},
+	}
+	for _, c := range cases {
+		err := v.validateMetrics(c.req)
+		st := status.Convert(err)
+		if st.Code() != codes.InvalidArgument {
+			t.Fatalf("%s: expected InvalidArgument, got %v", c.field, err)
+		}
+		var fields []string
+		for _, d := range st.Details() {
+			if br, ok := d.(*errdetails.BadRequest); ok {
+				for _, fv := range br.FieldViolations {
+					fields = append(fields, fv.Field)
+				}
+			}
+		}
+		if len(fields) != 1 || fields[0] != c.field {
+			t.Fatalf("expected violation of %s, got %v", c.field, fields)
+		}
+	}
+
+	ok := &api.MetricsRequest{ServerId: "a", Labels: map[string]string{"env": "прод"}, Samples: []*api.Sample{
+		{Name: "disk_free", Unit: "bytes", Labels: map[string]string{"mount": "/"}},
+	}}
+	if err := v.validateMetrics(ok); err != nil {
+		t.Fatalf("valid request rejected: %v", err)
+	}
+}
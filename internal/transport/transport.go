@@ -0,0 +1,211 @@
+package transport
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/vovakirdan/gohub/internal/api"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+)
+
+// AgentClient — то, что нужно агенту для общения с сервером
+type AgentClient interface {
+	SendMetrics(ctx context.Context, in *api.MetricsRequest, opts ...grpc.CallOption) (*api.MetricsResponse, error)
+	Heartbeat(ctx context.Context, in *api.HeartbeatRequest, opts ...grpc.CallOption) (*api.HeartbeatResponse, error)
+}
+
+// HTTPClient отправляет запросы агента на POST /api/ingest и /api/heartbeat в бинарном protobuf.
+// Прокси берётся из окружения (HTTPS_PROXY, HTTP_PROXY, NO_PROXY).
+type HTTPClient struct {
+	ingestURL    string
+	heartbeatURL string
+	client       *http.Client
+}
+
+// NewHTTPClient создаёт HTTP-клиент для ingestURL вида https://gohub.example.com/api/ingest.
+// Адрес heartbeat вычисляется относительно него (…/api/heartbeat).
+func NewHTTPClient(ingestURL string) *HTTPClient {
+	heartbeatURL := ingestURL
+	if u, err := url.Parse(ingestURL); err == nil {
+		heartbeatURL = u.ResolveReference(&url.URL{Path: "heartbeat"}).String()
+	}
+	return &HTTPClient{
+		ingestURL:    ingestURL,
+		heartbeatURL: heartbeatURL,
+		client: &http.Client{
+			Transport: &http.Transport{Proxy: http.ProxyFromEnvironment},
+			Timeout:   10 * time.Second,
+		},
+	}
+}
+
+// SendMetrics реализует AgentClient поверх HTTP
+func (c *HTTPClient) SendMetrics(ctx context.Context, in *api.MetricsRequest, _ ...grpc.CallOption) (*api.MetricsResponse, error) {
+	resp := &api.MetricsResponse{}
+	if err := c.post(ctx, c.ingestURL, in, resp); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+// Heartbeat реализует AgentClient поверх HTTP
+func (c *HTTPClient) Heartbeat(ctx context.Context, in *api.HeartbeatRequest, _ ...grpc.CallOption) (*api.HeartbeatResponse, error) {
+	resp := &api.HeartbeatResponse{}
+	if err := c.post(ctx, c.heartbeatURL, in, resp); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+// post отправляет in и разбирает ответ в out
+func (c *HTTPClient) post(ctx context.Context, target string, in, out proto.Message) error {
+	body, err := proto.Marshal(in)
+	if err != nil {
+		return fmt.Errorf("failed to marshal request: %w", err)
+	}
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, target, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	httpReq.Header.Set("Content-Type", "application/x-protobuf")
+	httpReq.Header.Set("Accept", "application/x-protobuf")
+
+	httpResp, err := c.client.Do(httpReq)
+	if err != nil {
+		return status.Errorf(codes.Unavailable, "http transport: %v", err)
+	}
+	defer httpResp.Body.Close()
+
+	data, err := io.ReadAll(io.LimitReader(httpResp.Body, 1<<20))
+	if err != nil {
+		return status.Errorf(codes.Unavailable, "http transport: %v", err)
+	}
+	if httpResp.StatusCode != http.StatusOK {
+		return status.Errorf(codeFromHTTP(httpResp.StatusCode), "http transport: %s: %s",
+			httpResp.Status, bytes.TrimSpace(data))
+	}
+
+	if err := proto.Unmarshal(data, out); err != nil {
+		return fmt.Errorf("failed to unmarshal response: %w", err)
+	}
+	return nil
+}
+
+// codeFromHTTP переводит HTTP-статус в gRPC-код
+func codeFromHTTP(code int) codes.Code {
+	switch code {
+	case http.StatusBadRequest:
+		return codes.InvalidArgument
+	case http.StatusUnauthorized:
+		return codes.Unauthenticated
+	case http.StatusForbidden:
+		return codes.PermissionDenied
+	case http.StatusTooManyRequests:
+		return codes.ResourceExhausted
+	case http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return codes.Unavailable
+	default:
+		return codes.Unknown
+	}
+}
+
+// FallbackClient шлёт метрики по gRPC, а при ошибках транспорта переключается на HTTP.
+// Пока активен HTTP, раз в retryGRPC снова пробует gRPC.
+type FallbackClient struct {
+	grpc      AgentClient
+	http      AgentClient
+	retryGRPC time.Duration
+
+	mu         sync.Mutex
+	useHTTP    bool
+	switchedAt time.Time
+}
+
+// NewFallbackClient создаёт клиент с автоматическим переключением транспорта
+func NewFallbackClient(grpcClient, httpClient AgentClient, retryGRPC time.Duration) *FallbackClient {
+	return &FallbackClient{grpc: grpcClient, http: httpClient, retryGRPC: retryGRPC}
+}
+
+// SendMetrics реализует AgentClient
+func (c *FallbackClient) SendMetrics(ctx context.Context, in *api.MetricsRequest, opts ...grpc.CallOption) (*api.MetricsResponse, error) {
+	var resp *api.MetricsResponse
+	err := c.do(ctx, func(ctx context.Context, client AgentClient) (err error) {
+		resp, err = client.SendMetrics(ctx, in, opts...)
+		return err
+	})
+	return resp, err
+}
+
+// Heartbeat реализует AgentClient
+func (c *FallbackClient) Heartbeat(ctx context.Context, in *api.HeartbeatRequest, opts ...grpc.CallOption) (*api.HeartbeatResponse, error) {
+	var resp *api.HeartbeatResponse
+	err := c.do(ctx, func(ctx context.Context, client AgentClient) (err error) {
+		resp, err = client.Heartbeat(ctx, in, opts...)
+		return err
+	})
+	return resp, err
+}
+
+// do выполняет вызов по gRPC, а при ошибке транспорта — по HTTP
+func (c *FallbackClient) do(ctx context.Context, call func(ctx context.Context, client AgentClient) error) error {
+	c.mu.Lock()
+	tryGRPC := !c.useHTTP || time.Since(c.switchedAt) >= c.retryGRPC
+	c.mu.Unlock()
+
+	if tryGRPC {
+		// На gRPC отводим половину оставшегося времени, чтобы успеть отправить по HTTP
+		grpcCtx := ctx
+		if deadline, ok := ctx.Deadline(); ok {
+			var cancel context.CancelFunc
+			grpcCtx, cancel = context.WithDeadline(ctx, time.Now().Add(time.Until(deadline)/2))
+			defer cancel()
+		}
+		err := call(grpcCtx, c.grpc)
+		if !isTransportError(err) {
+			c.setHTTP(false)
+			return err
+		}
+		log.Printf("gRPC transport failed: %v", err)
+		c.setHTTP(true)
+	}
+
+	return call(ctx, c.http)
+}
+
+// setHTTP переключает транспорт; при переходе на HTTP запоминает время неудачной попытки gRPC
+func (c *FallbackClient) setHTTP(useHTTP bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if useHTTP {
+		if !c.useHTTP {
+			log.Println("Switched to HTTP ingestion transport")
+		}
+		c.switchedAt = time.Now()
+	} else if c.useHTTP {
+		log.Println("Switched back to gRPC transport")
+	}
+	c.useHTTP = useHTTP
+}
+
+// isTransportError — ошибки, при которых имеет смысл сменить транспорт
+func isTransportError(err error) bool {
+	if err == nil {
+		return false
+	}
+	switch status.Code(err) {
+	case codes.Unavailable, codes.DeadlineExceeded, codes.Internal:
+		return true
+	}
+	return false
+}
@@ -2,34 +2,136 @@ package websocket
 
 import (
 	"encoding/json"
+	"fmt"
 	"log"
 	"net/http"
+	"strings"
 	"sync"
+	"time"
+
+	"github.com/vovakirdan/gohub/internal/labels"
 
 	"github.com/gorilla/websocket"
 )
 
 // Сообщение, которое шлём клиенту
 type WSMetricUpdate struct {
-	Message      string  `json:"message"`
-	ServerID     string  `json:"server_id"`
-	Tag          string  `json:"tag"`
-	CPUUsage     float64 `json:"cpu_usage"`
-	MemoryUsage  float64 `json:"memory_usage"`
-	DiskUsage    float64 `json:"disk_usage"`
-	NetworkUsage float64 `json:"network_usage"`
-	Timestamp    int64   `json:"timestamp"`
+	Type         string            `json:"type"` // всегда "metrics"
+	Message      string            `json:"message"`
+	ServerID     string            `json:"server_id"`
+	Tag          string            `json:"tag"`
+	Labels       map[string]string `json:"labels,omitempty"`
+	CPUUsage     float64           `json:"cpu_usage"`
+	MemoryUsage  float64           `json:"memory_usage"`
+	DiskUsage    float64           `json:"disk_usage"`
+	NetworkUsage float64           `json:"network_usage"`
+	// Сервер в окне обслуживания
+	InMaintenance bool  `json:"in_maintenance,omitempty"`
+	Timestamp     int64 `json:"timestamp"`
+}
+
+// WSServerEvent — смена состояния сервера (online/stale/offline)
+type WSServerEvent struct {
+	Type      string            `json:"type"` // всегда "server_state"
+	Message   string            `json:"message"`
+	ServerID  string            `json:"server_id"`
+	Tag       string            `json:"tag"`
+	Labels    map[string]string `json:"labels,omitempty"`
+	FromState string            `json:"from_state"`
+	ToState   string            `json:"to_state"`
+	LastSeen  int64             `json:"last_seen"`
+	Timestamp int64             `json:"timestamp"`
+}
+
+// WSMaintenance — сервер вошёл в окно обслуживания или вышел из него
+type WSMaintenance struct {
+	Type          string            `json:"type"` // всегда "maintenance"
+	Message       string            `json:"message"`
+	ServerID      string            `json:"server_id"`
+	Tag           string            `json:"tag"`
+	Labels        map[string]string `json:"labels,omitempty"`
+	InMaintenance bool              `json:"in_maintenance"`
+	// Окно обслуживания (пусто при выходе)
+	Window    string `json:"window,omitempty"`
+	Timestamp int64  `json:"timestamp"`
+}
+
+// WSAlert — смена состояния оповещения (pending, firing, resolved)
+type WSAlert struct {
+	Type        string            `json:"type"` // всегда "alert"
+	Message     string            `json:"message"`
+	Rule        string            `json:"rule"`
+	Severity    string            `json:"severity"`
+	ServerID    string            `json:"server_id"`
+	Tag         string            `json:"tag"`
+	Metric      string            `json:"metric"`
+	Labels      map[string]string `json:"labels,omitempty"`
+	Annotations map[string]string `json:"annotations,omitempty"`
+	State       string            `json:"state"`
+	Value       float64           `json:"value"`
+	StartedAt   int64             `json:"started_at"`
+	Timestamp   int64             `json:"timestamp"`
+}
+
+// Типы сообщений /ws, на которые подписывается клиент (/ws?events=metrics,alert,...)
+const (
+	EventMetrics     = "metrics"
+	EventServerState = "server_state"
+	EventAlert       = "alert"
+	EventMaintenance = "maintenance"
+)
+
+// ParseEvents разбирает список типов сообщений через запятую. Пустой список — только обновления метрик,
+// чтобы клиенты, не знающие поля type, не получали события других форм.
+func ParseEvents(s string) (map[string]bool, error) {
+	events := make(map[string]bool)
+	if strings.TrimSpace(s) == "" {
+		events[EventMetrics] = true
+		return events, nil
+	}
+	for _, e := range strings.Split(s, ",") {
+		e = strings.TrimSpace(e)
+		switch e {
+		case EventMetrics, EventServerState, EventAlert, EventMaintenance:
+			events[e] = true
+		case "":
+		default:
+			return nil, fmt.Errorf("unknown event type %q", e)
+		}
+	}
+	return events, nil
+}
+
+// ClientFilter — подписка клиента (задаётся query-параметрами /ws?server_id=&tag=&labels=k=v,...&events=...)
+type ClientFilter struct {
+	ServerID string
+	Tag      string
+	Labels   labels.Labels
+	// Типы сообщений, которые получает клиент
+	Events map[string]bool
+}
+
+// Match проверяет, подходит ли обновление под фильтр
+func (f *ClientFilter) Match(serverID, tag string, l map[string]string) bool {
+	if f.ServerID != "" && f.ServerID != serverID {
+		return false
+	}
+	if f.Tag != "" && f.Tag != tag {
+		return false
+	}
+	return labels.Match(l, f.Labels)
 }
 
 type Hub struct {
 	mu       sync.Mutex
-	clients  map[*websocket.Conn]bool
+	clients  map[*websocket.Conn]*ClientFilter
 	upgrader websocket.Upgrader
+	closed   bool
 }
 
 func NewHub() *Hub {
 	return &Hub{
-		clients: make(map[*websocket.Conn]bool),
+		clients: make(map[*websocket.Conn]*ClientFilter),
 		upgrader: websocket.Upgrader{
 			CheckOrigin: func(r *http.Request) bool { return true },
 		},
@@ -37,13 +139,36 @@ func NewHub() *Hub {
 }
 
 func (h *Hub) HandleConnections(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	selector, err := labels.Parse(q.Get("labels"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	events, err := ParseEvents(q.Get("events"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	filter := &ClientFilter{
+		ServerID: q.Get("server_id"),
+		Tag:      q.Get("tag"),
+		Labels:   selector,
+		Events:   events,
+	}
+
 	ws, err := h.upgrader.Upgrade(w, r, nil)
 	if err != nil {
 		log.Printf("Failed to upgrade WS: %v", err)
 		return
 	}
 	h.mu.Lock()
-	h.clients[ws] = true
+	if h.closed {
+		h.mu.Unlock()
+		closeConn(ws, websocket.CloseGoingAway, "server is shutting down")
+		return
+	}
+	h.clients[ws] = filter
 	h.mu.Unlock()
 
 	log.Println("New WebSocket client connected")
@@ -63,11 +188,38 @@ func (h *Hub) HandleConnections(w http.ResponseWriter, r *http.Request) {
 }
 
 func (h *Hub) BroadcastMetrics(update WSMetricUpdate) {
+	update.Type = EventMetrics
+	h.broadcast(update.Type, update.ServerID, update.Tag, update.Labels, update)
+}
+
+// BroadcastServerEvent рассылает смену состояния сервера
+func (h *Hub) BroadcastServerEvent(ev WSServerEvent) {
+	ev.Type = EventServerState
+	h.broadcast(ev.Type, ev.ServerID, ev.Tag, ev.Labels, ev)
+}
+
+// BroadcastAlert рассылает смену состояния оповещения
+func (h *Hub) BroadcastAlert(a WSAlert) {
+	a.Type = EventAlert
+	h.broadcast(a.Type, a.ServerID, a.Tag, a.Labels, a)
+}
+
+// BroadcastMaintenance рассылает вход сервера в окно обслуживания и выход из него
+func (h *Hub) BroadcastMaintenance(m WSMaintenance) {
+	m.Type = EventMaintenance
+	h.broadcast(m.Type, m.ServerID, m.Tag, m.Labels, m)
+}
+
+// broadcast отправляет сообщение клиентам, подписанным на его тип, чей фильтр подходит под сервер
+func (h *Hub) broadcast(event, serverID, tag string, l map[string]string, msg interface{}) {
 	h.mu.Lock()
 	defer h.mu.Unlock()
 
-	data, _ := json.Marshal(update)
-	for ws := range h.clients {
+	data, _ := json.Marshal(msg)
+	for ws, filter := range h.clients {
+		if !filter.Events[event] || !filter.Match(serverID, tag, l) {
+			continue
+		}
 		if err := ws.WriteMessage(websocket.TextMessage, data); err != nil {
 			log.Printf("WS write error: %v", err)
 			ws.Close()
@@ -75,3 +227,23 @@ func (h *Hub) BroadcastMetrics(update WSMetricUpdate) {
 		}
 	}
 }
+
+// closeConn отправляет клиенту close frame и закрывает соединение
+func closeConn(ws *websocket.Conn, code int, text string) {
+	deadline := time.Now().Add(time.Second)
+	if err := ws.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(code, text), deadline); err != nil {
+		log.Printf("WS close frame error: %v", err)
+	}
+	ws.Close()
+}
+
+// Close отправляет всем клиентам close frame и больше не принимает подключения
+func (h *Hub) Close() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.closed = true
+	for ws := range h.clients {
+		closeConn(ws, websocket.CloseGoingAway, "server is shutting down")
+		delete(h.clients, ws)
+	}
+}
@@ -0,0 +1,571 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.5.1
+// - protoc             v3.12.4
+// source: gohub/metrics/v1/metrics.proto
+
+// Публичный версионированный API gohub.
+// Совместимость: номера и типы полей совпадают с устаревшим package api,
+// поэтому сообщения обоих пакетов взаимозаменяемы на уровне wire-формата.
+// В v1 допускается только добавление полей, сообщений и методов;
+// номера удалённых полей резервируются.
+
+package metricsv1
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.64.0 or later.
+const _ = grpc.SupportPackageIsVersion9
+
+const (
+	MetricsService_SendMetrics_FullMethodName      = "/gohub.metrics.v1.MetricsService/SendMetrics"
+	MetricsService_StreamMetrics_FullMethodName    = "/gohub.metrics.v1.MetricsService/StreamMetrics"
+	MetricsService_ListMetrics_FullMethodName      = "/gohub.metrics.v1.MetricsService/ListMetrics"
+	MetricsService_Heartbeat_FullMethodName        = "/gohub.metrics.v1.MetricsService/Heartbeat"
+	MetricsService_WatchDiagnostics_FullMethodName = "/gohub.metrics.v1.MetricsService/WatchDiagnostics"
+	MetricsService_ReportDiagnostic_FullMethodName = "/gohub.metrics.v1.MetricsService/ReportDiagnostic"
+	MetricsService_ListSamples_FullMethodName      = "/gohub.metrics.v1.MetricsService/ListSamples"
+	MetricsService_QueryRange_FullMethodName       = "/gohub.metrics.v1.MetricsService/QueryRange"
+	MetricsService_ListServers_FullMethodName      = "/gohub.metrics.v1.MetricsService/ListServers"
+	MetricsService_GetServer_FullMethodName        = "/gohub.metrics.v1.MetricsService/GetServer"
+	MetricsService_DeleteServer_FullMethodName     = "/gohub.metrics.v1.MetricsService/DeleteServer"
+	MetricsService_GetFleetSnapshot_FullMethodName = "/gohub.metrics.v1.MetricsService/GetFleetSnapshot"
+)
+
+// MetricsServiceClient is the client API for MetricsService service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+//
+// Сервис с отправкой/получением метрик
+type MetricsServiceClient interface {
+	// 1) Отправка метрик
+	SendMetrics(ctx context.Context, in *MetricsRequest, opts ...grpc.CallOption) (*MetricsResponse, error)
+	// 2) Поток измерений по мере приёма (с фильтрами и догрузкой истории)
+	StreamMetrics(ctx context.Context, in *StreamRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[StoredSample], error)
+	// 3) Получение метрик
+	ListMetrics(ctx context.Context, in *ListMetricsRequest, opts ...grpc.CallOption) (*ListMetricsResponse, error)
+	// 4) Heartbeat агента, независимый от сбора метрик
+	Heartbeat(ctx context.Context, in *HeartbeatRequest, opts ...grpc.CallOption) (*HeartbeatResponse, error)
+	// 5) Диагностика: агент подписывается на запросы выполнения команд
+	WatchDiagnostics(ctx context.Context, in *WatchDiagnosticsRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[DiagnosticRequest], error)
+	// 6) Агент передаёт вывод диагностической команды частями
+	ReportDiagnostic(ctx context.Context, opts ...grpc.CallOption) (grpc.ClientStreamingClient[DiagnosticOutput, DiagnosticAck], error)
+	// 7) Получение произвольных сэмплов
+	ListSamples(ctx context.Context, in *ListSamplesRequest, opts ...grpc.CallOption) (*ListSamplesResponse, error)
+	// 8) Агрегированные ряды за диапазон времени с заданным шагом
+	QueryRange(ctx context.Context, in *QueryRangeRequest, opts ...grpc.CallOption) (*QueryRangeResponse, error)
+	// 9) Реестр серверов
+	ListServers(ctx context.Context, in *ListServersRequest, opts ...grpc.CallOption) (*ListServersResponse, error)
+	GetServer(ctx context.Context, in *GetServerRequest, opts ...grpc.CallOption) (*ServerInfo, error)
+	// Вывод сервера из эксплуатации
+	DeleteServer(ctx context.Context, in *DeleteServerRequest, opts ...grpc.CallOption) (*DeleteServerResponse, error)
+	// 10) Последние значения всех серверов из кеша сервера, без запросов к БД
+	GetFleetSnapshot(ctx context.Context, in *FleetSnapshotRequest, opts ...grpc.CallOption) (*FleetSnapshot, error)
+}
+
+type metricsServiceClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewMetricsServiceClient(cc grpc.ClientConnInterface) MetricsServiceClient {
+	return &metricsServiceClient{cc}
+}
+
+func (c *metricsServiceClient) SendMetrics(ctx context.Context, in *MetricsRequest, opts ...grpc.CallOption) (*MetricsResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(MetricsResponse)
+	err := c.cc.Invoke(ctx, MetricsService_SendMetrics_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *metricsServiceClient) StreamMetrics(ctx context.Context, in *StreamRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[StoredSample], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &MetricsService_ServiceDesc.Streams[0], MetricsService_StreamMetrics_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[StreamRequest, StoredSample]{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type MetricsService_StreamMetricsClient = grpc.ServerStreamingClient[StoredSample]
+
+func (c *metricsServiceClient) ListMetrics(ctx context.Context, in *ListMetricsRequest, opts ...grpc.CallOption) (*ListMetricsResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ListMetricsResponse)
+	err := c.cc.Invoke(ctx, MetricsService_ListMetrics_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *metricsServiceClient) Heartbeat(ctx context.Context, in *HeartbeatRequest, opts ...grpc.CallOption) (*HeartbeatResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(HeartbeatResponse)
+	err := c.cc.Invoke(ctx, MetricsService_Heartbeat_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *metricsServiceClient) WatchDiagnostics(ctx context.Context, in *WatchDiagnosticsRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[DiagnosticRequest], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &MetricsService_ServiceDesc.Streams[1], MetricsService_WatchDiagnostics_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[WatchDiagnosticsRequest, DiagnosticRequest]{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type MetricsService_WatchDiagnosticsClient = grpc.ServerStreamingClient[DiagnosticRequest]
+
+func (c *metricsServiceClient) ReportDiagnostic(ctx context.Context, opts ...grpc.CallOption) (grpc.ClientStreamingClient[DiagnosticOutput, DiagnosticAck], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &MetricsService_ServiceDesc.Streams[2], MetricsService_ReportDiagnostic_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[DiagnosticOutput, DiagnosticAck]{ClientStream: stream}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type MetricsService_ReportDiagnosticClient = grpc.ClientStreamingClient[DiagnosticOutput, DiagnosticAck]
+
+func (c *metricsServiceClient) ListSamples(ctx context.Context, in *ListSamplesRequest, opts ...grpc.CallOption) (*ListSamplesResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ListSamplesResponse)
+	err := c.cc.Invoke(ctx, MetricsService_ListSamples_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *metricsServiceClient) QueryRange(ctx context.Context, in *QueryRangeRequest, opts ...grpc.CallOption) (*QueryRangeResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(QueryRangeResponse)
+	err := c.cc.Invoke(ctx, MetricsService_QueryRange_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *metricsServiceClient) ListServers(ctx context.Context, in *ListServersRequest, opts ...grpc.CallOption) (*ListServersResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ListServersResponse)
+	err := c.cc.Invoke(ctx, MetricsService_ListServers_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *metricsServiceClient) GetServer(ctx context.Context, in *GetServerRequest, opts ...grpc.CallOption) (*ServerInfo, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ServerInfo)
+	err := c.cc.Invoke(ctx, MetricsService_GetServer_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *metricsServiceClient) DeleteServer(ctx context.Context, in *DeleteServerRequest, opts ...grpc.CallOption) (*DeleteServerResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(DeleteServerResponse)
+	err := c.cc.Invoke(ctx, MetricsService_DeleteServer_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *metricsServiceClient) GetFleetSnapshot(ctx context.Context, in *FleetSnapshotRequest, opts ...grpc.CallOption) (*FleetSnapshot, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(FleetSnapshot)
+	err := c.cc.Invoke(ctx, MetricsService_GetFleetSnapshot_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// MetricsServiceServer is the server API for MetricsService service.
+// All implementations must embed UnimplementedMetricsServiceServer
+// for forward compatibility.
+//
+// Сервис с отправкой/получением метрик
+type MetricsServiceServer interface {
+	// 1) Отправка метрик
+	SendMetrics(context.Context, *MetricsRequest) (*MetricsResponse, error)
+	// 2) Поток измерений по мере приёма (с фильтрами и догрузкой истории)
+	StreamMetrics(*StreamRequest, grpc.ServerStreamingServer[StoredSample]) error
+	// 3) Получение метрик
+	ListMetrics(context.Context, *ListMetricsRequest) (*ListMetricsResponse, error)
+	// 4) Heartbeat агента, независимый от сбора метрик
+	Heartbeat(context.Context, *HeartbeatRequest) (*HeartbeatResponse, error)
+	// 5) Диагностика: агент подписывается на запросы выполнения команд
+	WatchDiagnostics(*WatchDiagnosticsRequest, grpc.ServerStreamingServer[DiagnosticRequest]) error
+	// 6) Агент передаёт вывод диагностической команды частями
+	ReportDiagnostic(grpc.ClientStreamingServer[DiagnosticOutput, DiagnosticAck]) error
+	// 7) Получение произвольных сэмплов
+	ListSamples(context.Context, *ListSamplesRequest) (*ListSamplesResponse, error)
+	// 8) Агрегированные ряды за диапазон времени с заданным шагом
+	QueryRange(context.Context, *QueryRangeRequest) (*QueryRangeResponse, error)
+	// 9) Реестр серверов
+	ListServers(context.Context, *ListServersRequest) (*ListServersResponse, error)
+	GetServer(context.Context, *GetServerRequest) (*ServerInfo, error)
+	// Вывод сервера из эксплуатации
+	DeleteServer(context.Context, *DeleteServerRequest) (*DeleteServerResponse, error)
+	// 10) Последние значения всех серверов из кеша сервера, без запросов к БД
+	GetFleetSnapshot(context.Context, *FleetSnapshotRequest) (*FleetSnapshot, error)
+	mustEmbedUnimplementedMetricsServiceServer()
+}
+
+// UnimplementedMetricsServiceServer must be embedded to have
+// forward compatible implementations.
+//
+// NOTE: this should be embedded by value instead of pointer to avoid a nil
+// pointer dereference when methods are called.
+type UnimplementedMetricsServiceServer struct{}
+
+func (UnimplementedMetricsServiceServer) SendMetrics(context.Context, *MetricsRequest) (*MetricsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method SendMetrics not implemented")
+}
+func (UnimplementedMetricsServiceServer) StreamMetrics(*StreamRequest, grpc.ServerStreamingServer[StoredSample]) error {
+	return status.Errorf(codes.Unimplemented, "method StreamMetrics not implemented")
+}
+func (UnimplementedMetricsServiceServer) ListMetrics(context.Context, *ListMetricsRequest) (*ListMetricsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListMetrics not implemented")
+}
+func (UnimplementedMetricsServiceServer) Heartbeat(context.Context, *HeartbeatRequest) (*HeartbeatResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Heartbeat not implemented")
+}
+func (UnimplementedMetricsServiceServer) WatchDiagnostics(*WatchDiagnosticsRequest, grpc.ServerStreamingServer[DiagnosticRequest]) error {
+	return status.Errorf(codes.Unimplemented, "method WatchDiagnostics not implemented")
+}
+func (UnimplementedMetricsServiceServer) ReportDiagnostic(grpc.ClientStreamingServer[DiagnosticOutput, DiagnosticAck]) error {
+	return status.Errorf(codes.Unimplemented, "method ReportDiagnostic not implemented")
+}
+func (UnimplementedMetricsServiceServer) ListSamples(context.Context, *ListSamplesRequest) (*ListSamplesResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListSamples not implemented")
+}
+func (UnimplementedMetricsServiceServer) QueryRange(context.Context, *QueryRangeRequest) (*QueryRangeResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method QueryRange not implemented")
+}
+func (UnimplementedMetricsServiceServer) ListServers(context.Context, *ListServersRequest) (*ListServersResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListServers not implemented")
+}
+func (UnimplementedMetricsServiceServer) GetServer(context.Context, *GetServerRequest) (*ServerInfo, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetServer not implemented")
+}
+func (UnimplementedMetricsServiceServer) DeleteServer(context.Context, *DeleteServerRequest) (*DeleteServerResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method DeleteServer not implemented")
+}
+func (UnimplementedMetricsServiceServer) GetFleetSnapshot(context.Context, *FleetSnapshotRequest) (*FleetSnapshot, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetFleetSnapshot not implemented")
+}
+func (UnimplementedMetricsServiceServer) mustEmbedUnimplementedMetricsServiceServer() {}
+func (UnimplementedMetricsServiceServer) testEmbeddedByValue()                        {}
+
+// UnsafeMetricsServiceServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to MetricsServiceServer will
+// result in compilation errors.
+type UnsafeMetricsServiceServer interface {
+	mustEmbedUnimplementedMetricsServiceServer()
+}
+
+func RegisterMetricsServiceServer(s grpc.ServiceRegistrar, srv MetricsServiceServer) {
+	// If the following call pancis, it indicates UnimplementedMetricsServiceServer was
+	// embedded by pointer and is nil.  This will cause panics if an
+	// unimplemented method is ever invoked, so we test this at initialization
+	// time to prevent it from happening at runtime later due to I/O.
+	if t, ok := srv.(interface{ testEmbeddedByValue() }); ok {
+		t.testEmbeddedByValue()
+	}
+	s.RegisterService(&MetricsService_ServiceDesc, srv)
+}
+
+func _MetricsService_SendMetrics_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(MetricsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(MetricsServiceServer).SendMetrics(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: MetricsService_SendMetrics_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(MetricsServiceServer).SendMetrics(ctx, req.(*MetricsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _MetricsService_StreamMetrics_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(StreamRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(MetricsServiceServer).StreamMetrics(m, &grpc.GenericServerStream[StreamRequest, StoredSample]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type MetricsService_StreamMetricsServer = grpc.ServerStreamingServer[StoredSample]
+
+func _MetricsService_ListMetrics_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListMetricsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(MetricsServiceServer).ListMetrics(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: MetricsService_ListMetrics_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(MetricsServiceServer).ListMetrics(ctx, req.(*ListMetricsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _MetricsService_Heartbeat_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(HeartbeatRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(MetricsServiceServer).Heartbeat(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: MetricsService_Heartbeat_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(MetricsServiceServer).Heartbeat(ctx, req.(*HeartbeatRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _MetricsService_WatchDiagnostics_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(WatchDiagnosticsRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(MetricsServiceServer).WatchDiagnostics(m, &grpc.GenericServerStream[WatchDiagnosticsRequest, DiagnosticRequest]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type MetricsService_WatchDiagnosticsServer = grpc.ServerStreamingServer[DiagnosticRequest]
+
+func _MetricsService_ReportDiagnostic_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(MetricsServiceServer).ReportDiagnostic(&grpc.GenericServerStream[DiagnosticOutput, DiagnosticAck]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type MetricsService_ReportDiagnosticServer = grpc.ClientStreamingServer[DiagnosticOutput, DiagnosticAck]
+
+func _MetricsService_ListSamples_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListSamplesRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(MetricsServiceServer).ListSamples(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: MetricsService_ListSamples_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(MetricsServiceServer).ListSamples(ctx, req.(*ListSamplesRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _MetricsService_QueryRange_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(QueryRangeRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(MetricsServiceServer).QueryRange(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: MetricsService_QueryRange_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(MetricsServiceServer).QueryRange(ctx, req.(*QueryRangeRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _MetricsService_ListServers_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListServersRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(MetricsServiceServer).ListServers(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: MetricsService_ListServers_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(MetricsServiceServer).ListServers(ctx, req.(*ListServersRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _MetricsService_GetServer_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetServerRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(MetricsServiceServer).GetServer(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: MetricsService_GetServer_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(MetricsServiceServer).GetServer(ctx, req.(*GetServerRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _MetricsService_DeleteServer_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(DeleteServerRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(MetricsServiceServer).DeleteServer(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: MetricsService_DeleteServer_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(MetricsServiceServer).DeleteServer(ctx, req.(*DeleteServerRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _MetricsService_GetFleetSnapshot_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(FleetSnapshotRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(MetricsServiceServer).GetFleetSnapshot(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: MetricsService_GetFleetSnapshot_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(MetricsServiceServer).GetFleetSnapshot(ctx, req.(*FleetSnapshotRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// MetricsService_ServiceDesc is the grpc.ServiceDesc for MetricsService service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var MetricsService_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "gohub.metrics.v1.MetricsService",
+	HandlerType: (*MetricsServiceServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "SendMetrics",
+			Handler:    _MetricsService_SendMetrics_Handler,
+		},
+		{
+			MethodName: "ListMetrics",
+			Handler:    _MetricsService_ListMetrics_Handler,
+		},
+		{
+			MethodName: "Heartbeat",
+			Handler:    _MetricsService_Heartbeat_Handler,
+		},
+		{
+			MethodName: "ListSamples",
+			Handler:    _MetricsService_ListSamples_Handler,
+		},
+		{
+			MethodName: "QueryRange",
+			Handler:    _MetricsService_QueryRange_Handler,
+		},
+		{
+			MethodName: "ListServers",
+			Handler:    _MetricsService_ListServers_Handler,
+		},
+		{
+			MethodName: "GetServer",
+			Handler:    _MetricsService_GetServer_Handler,
+		},
+		{
+			MethodName: "DeleteServer",
+			Handler:    _MetricsService_DeleteServer_Handler,
+		},
+		{
+			MethodName: "GetFleetSnapshot",
+			Handler:    _MetricsService_GetFleetSnapshot_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "StreamMetrics",
+			Handler:       _MetricsService_StreamMetrics_Handler,
+			ServerStreams: true,
+		},
+		{
+			StreamName:    "WatchDiagnostics",
+			Handler:       _MetricsService_WatchDiagnostics_Handler,
+			ServerStreams: true,
+		},
+		{
+			StreamName:    "ReportDiagnostic",
+			Handler:       _MetricsService_ReportDiagnostic_Handler,
+			ClientStreams: true,
+		},
+	},
+	Metadata: "gohub/metrics/v1/metrics.proto",
+}
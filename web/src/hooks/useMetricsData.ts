@@ -51,6 +51,10 @@ export function useMetricsData() {
   
   // Handle incoming metric data
   const handleMetricData = useCallback((data: MetricMessage) => {
+    // Other /ws event types (server_state, alert, maintenance) are not metric samples
+    if (data.type && data.type !== 'metrics') {
+      return;
+    }
     dispatch({ type: 'ADD_METRIC_DATA', payload: data });
   }, [dispatch]);
   
@@ -1,4 +1,5 @@
 export interface MetricMessage {
+  type?: string;
   message: string;
   server_id: string;
   tag: string;